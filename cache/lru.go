@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LRU is a fixed size in-process cache whose entries also expire after their own TTL.
+// When full, the least recently used entry is evicted
+type LRU[V any] struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List
+}
+
+type lruEntry[V any] struct {
+	key       string
+	value     V
+	expiresAt time.Time
+}
+
+func NewLRU[V any](capacity int) *LRU[V] {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &LRU[V]{
+		capacity: capacity,
+		items:    make(map[string]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+// Get returns the value stored under key, if present and not expired
+func (cache *LRU[V]) Get(key string) (V, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	var zero V
+	element, ok := cache.items[key]
+	if !ok {
+		return zero, false
+	}
+
+	entry := element.Value.(*lruEntry[V])
+	if time.Now().After(entry.expiresAt) {
+		cache.order.Remove(element)
+		delete(cache.items, key)
+		return zero, false
+	}
+
+	cache.order.MoveToFront(element)
+	return entry.value, true
+}
+
+// Set stores value under key for ttl
+func (cache *LRU[V]) Set(key string, value V, ttl time.Duration) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	expiresAt := time.Now().Add(ttl)
+	if element, ok := cache.items[key]; ok {
+		entry := element.Value.(*lruEntry[V])
+		entry.value = value
+		entry.expiresAt = expiresAt
+		cache.order.MoveToFront(element)
+		return
+	}
+
+	cache.items[key] = cache.order.PushFront(&lruEntry[V]{key: key, value: value, expiresAt: expiresAt})
+
+	if cache.order.Len() > cache.capacity {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.items, oldest.Value.(*lruEntry[V]).key)
+	}
+}
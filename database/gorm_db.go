@@ -18,7 +18,20 @@ func DBConnection(config util.Config) (*gorm.DB, error) {
 		panic("Failed to connect to database!")
 	}
 
-	db.AutoMigrate(&repository.UserGorm{})
+	emailVerificationExisted := db.Migrator().HasColumn(&repository.UserGorm{}, "EmailVerifiedAt")
+	db.AutoMigrate(&repository.UserGorm{}, &repository.RoleGorm{}, &repository.SecurityEventGorm{}, &repository.SigningKeyGorm{}, &repository.RecoveryCodeGorm{}, &repository.PersonalAccessTokenGorm{}, &repository.OAuthClientGorm{}, &repository.FederatedIdentityGorm{})
+
+	if err := seedRoles(db); err != nil {
+		return nil, err
+	}
+	if err := migrateUserRoles(db, config); err != nil {
+		return nil, err
+	}
+	if !emailVerificationExisted {
+		if err := migrateEmailVerification(db); err != nil {
+			return nil, err
+		}
+	}
 
 	return db, nil
 }
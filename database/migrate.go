@@ -0,0 +1,48 @@
+package database
+
+import (
+	"golang-api/entity"
+	"golang-api/repository"
+	"golang-api/util"
+
+	"gorm.io/gorm"
+)
+
+// seedRoles creates the built-in roles that are missing
+func seedRoles(db *gorm.DB) error {
+	for _, role := range entity.DefaultRoles() {
+		roleGorm := repository.NewRoleGorm(role)
+		err := db.Where("name = ?", role.Name).FirstOrCreate(&roleGorm).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateUserRoles assigns the member role to users created before roles existed
+// and promotes the configured admin email, so the installation is never left without an admin
+func migrateUserRoles(db *gorm.DB, config util.Config) error {
+	err := db.Model(&repository.UserGorm{}).
+		Where("role IS NULL OR role = ''").
+		Update("role", entity.RoleMember).Error
+	if err != nil {
+		return err
+	}
+
+	if config.AdminEmail == "" {
+		return nil
+	}
+
+	return db.Model(&repository.UserGorm{}).
+		Where("email = ?", config.AdminEmail).
+		Update("role", entity.RoleAdmin).Error
+}
+
+// migrateEmailVerification trusts the emails of users created before verification existed,
+// so requiring verification does not lock them out. It only runs when the column is added
+func migrateEmailVerification(db *gorm.DB) error {
+	return db.Model(&repository.UserGorm{}).
+		Where("email_verified_at IS NULL").
+		Update("email_verified_at", gorm.Expr("created_at")).Error
+}
@@ -10,9 +10,13 @@ type LoginRequest struct {
 type LoginResponse struct {
 	AccessToken           string    `json:"accessToken"`
 	AccessTokenExpiresAt  time.Time `json:"accessTokenExpiresAt"`
-	RefreshToken          string    `json:"refreshToken"`
+	RefreshToken          string    `json:"refreshToken,omitempty"`
 	RefreshTokenExpiresAt time.Time `json:"refreshTokenExpiresAt"`
 	Email                 string    `json:"email"`
+	// TokenType is DPoP when the tokens are bound to the key of the DPoP proof sent along the request
+	TokenType string `json:"tokenType"`
+	// CSRFToken is set in cookie mode, where the refresh token is in a cookie instead
+	CSRFToken string `json:"csrfToken,omitempty"`
 }
 
 type TokenRequest struct {
@@ -1,5 +1,29 @@
 package dto
 
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
 type ServiceError struct {
 	Message string `json:"message"`
 }
+
+// StepUpErrorCode is the error of RFC 9470, telling the client to authenticate the user again
+const StepUpErrorCode = "insufficient_user_authentication"
+
+// StepUpError answers requests whose user authenticated longer than MaxAge seconds ago
+type StepUpError struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+	MaxAge  int64  `json:"max_age"`
+}
+
+// WriteStepUpChallenge answers 401 with the challenge of RFC 9470, in the WWW-Authenticate header and the body alike
+func WriteStepUpChallenge(rw http.ResponseWriter, maxAge time.Duration) {
+	seconds := int64(maxAge.Seconds())
+	message := "this operation requires a recent login, authenticate again"
+	rw.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="%s", error_description="%s", max_age=%d`, StepUpErrorCode, message, seconds))
+	WriteResponse(rw, http.StatusUnauthorized, StepUpError{Error: StepUpErrorCode, Message: message, MaxAge: seconds})
+}
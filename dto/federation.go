@@ -0,0 +1,42 @@
+package dto
+
+import (
+	"golang-api/entity"
+	"time"
+)
+
+// FederatedProvidersResponse lists the names of the upstream providers users can log in with
+type FederatedProvidersResponse struct {
+	Providers []string `json:"providers"`
+}
+
+// FederatedAuthorizationResponse is where to send the user to link an identity of the provider
+type FederatedAuthorizationResponse struct {
+	AuthorizationURL string `json:"authorizationUrl"`
+}
+
+type FederatedIdentityResponse struct {
+	ID        uint      `json:"id"`
+	Provider  string    `json:"provider"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type FederatedIdentitiesResponse []*FederatedIdentityResponse
+
+func NewFederatedIdentityResponse(federatedIdentity entity.FederatedIdentity) *FederatedIdentityResponse {
+	return &FederatedIdentityResponse{
+		ID:        federatedIdentity.ID,
+		Provider:  federatedIdentity.Provider,
+		Email:     federatedIdentity.Email,
+		CreatedAt: federatedIdentity.CreatedAt,
+	}
+}
+func NewFederatedIdentitiesResponse(federatedIdentities []entity.FederatedIdentity) *FederatedIdentitiesResponse {
+	federatedIdentitiesResponse := FederatedIdentitiesResponse{}
+
+	for _, federatedIdentity := range federatedIdentities {
+		federatedIdentitiesResponse = append(federatedIdentitiesResponse, NewFederatedIdentityResponse(federatedIdentity))
+	}
+	return &federatedIdentitiesResponse
+}
@@ -0,0 +1,28 @@
+package dto
+
+import "time"
+
+type MFACodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type MFALoginRequest struct {
+	ChallengeToken string `json:"challengeToken" validate:"required"`
+	Code           string `json:"code" validate:"required"`
+}
+
+// MFAChallengeResponse is returned by /auth/login instead of the token pair when the user enrolled a second factor
+type MFAChallengeResponse struct {
+	MFARequired        bool      `json:"mfaRequired"`
+	ChallengeToken     string    `json:"challengeToken"`
+	ChallengeExpiresAt time.Time `json:"challengeExpiresAt"`
+}
+
+type TOTPEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauthUri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
@@ -0,0 +1,129 @@
+package dto
+
+import (
+	"golang-api/entity"
+	"time"
+)
+
+// OAuthTokenRequest holds the form parameters of /oauth/token, the grant type decides which ones are used
+type OAuthTokenRequest struct {
+	GrantType    string
+	Scope        string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+}
+
+// AuthorizeRequest holds the query parameters of /oauth/authorize, carried along by the login page
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+}
+
+// OAuthTokenResponse is the RFC 6749 access token response
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// DeviceAuthorizationResponse is the RFC 8628 device authorization response
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// IntrospectionResponse is the RFC 7662 introspection response. Inactive tokens only have active set to false
+type IntrospectionResponse struct {
+	Active      bool     `json:"active"`
+	Scope       string   `json:"scope,omitempty"`
+	ClientID    string   `json:"client_id,omitempty"`
+	Username    string   `json:"username,omitempty"`
+	TokenType   string   `json:"token_type,omitempty"`
+	TokenUse    string   `json:"token_use,omitempty"`
+	ExpiresAt   int64    `json:"exp,omitempty"`
+	IssuedAt    int64    `json:"iat,omitempty"`
+	NotBefore   int64    `json:"nbf,omitempty"`
+	Subject     string   `json:"sub,omitempty"`
+	Issuer      string   `json:"iss,omitempty"`
+	Audience    []string `json:"aud,omitempty"`
+	JTI         string   `json:"jti,omitempty"`
+	Role        string   `json:"role,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	SessionID   string   `json:"sid,omitempty"`
+	AuthTime    int64    `json:"auth_time,omitempty"`
+	AMR         []string `json:"amr,omitempty"`
+	// Confirmation names the DPoP key of a sender constrained token
+	Confirmation *TokenConfirmation `json:"cnf,omitempty"`
+}
+
+// TokenConfirmation is the cnf claim of RFC 7800, jkt is the thumbprint of the DPoP key
+type TokenConfirmation struct {
+	JKT string `json:"jkt"`
+}
+
+// OAuthErrorResponse is the RFC 6749 error response
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name" validate:"required,max=128"`
+	Scopes       []string `json:"scopes" validate:"required,min=1,dive,required"`
+	GrantTypes   []string `json:"grantTypes" validate:"required,min=1,dive,required"`
+	RedirectURIs []string `json:"redirectUris" validate:"dive,url"`
+	Public       bool     `json:"public"`
+}
+
+type OAuthClientResponse struct {
+	ClientID     string    `json:"clientId"`
+	Name         string    `json:"name"`
+	Scopes       []string  `json:"scopes"`
+	GrantTypes   []string  `json:"grantTypes"`
+	RedirectURIs []string  `json:"redirectUris"`
+	Public       bool      `json:"public"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// CreatedOAuthClientResponse is the only response carrying the client secret, public clients have none
+type CreatedOAuthClientResponse struct {
+	OAuthClientResponse
+	ClientSecret string `json:"clientSecret,omitempty"`
+}
+
+type OAuthClientsResponse []*OAuthClientResponse
+
+func NewOAuthClientResponse(client entity.OAuthClient) *OAuthClientResponse {
+	return &OAuthClientResponse{
+		ClientID:     client.ClientID,
+		Name:         client.Name,
+		Scopes:       client.Scopes,
+		GrantTypes:   client.GrantTypes,
+		RedirectURIs: client.RedirectURIs,
+		Public:       client.Public,
+		CreatedAt:    client.CreatedAt,
+	}
+}
+func NewOAuthClientsResponse(clients []entity.OAuthClient) *OAuthClientsResponse {
+	oauthClientsResponse := OAuthClientsResponse{}
+
+	for _, client := range clients {
+		oauthClientsResponse = append(oauthClientsResponse, NewOAuthClientResponse(client))
+	}
+	return &oauthClientsResponse
+}
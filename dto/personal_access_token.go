@@ -0,0 +1,50 @@
+package dto
+
+import (
+	"golang-api/entity"
+	"time"
+)
+
+type CreatePersonalAccessTokenRequest struct {
+	Name      string     `json:"name" validate:"required,max=128"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1,dive,required"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+type PersonalAccessTokenResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// CreatedPersonalAccessTokenResponse is the only response carrying the token itself
+type CreatedPersonalAccessTokenResponse struct {
+	PersonalAccessTokenResponse
+	Token string `json:"token"`
+}
+
+type PersonalAccessTokensResponse []*PersonalAccessTokenResponse
+
+func NewPersonalAccessTokenResponse(personalAccessToken entity.PersonalAccessToken) *PersonalAccessTokenResponse {
+	return &PersonalAccessTokenResponse{
+		ID:         personalAccessToken.ID,
+		Name:       personalAccessToken.Name,
+		Prefix:     personalAccessToken.DisplayPrefix,
+		Scopes:     personalAccessToken.Scopes,
+		ExpiresAt:  personalAccessToken.ExpiresAt,
+		LastUsedAt: personalAccessToken.LastUsedAt,
+		CreatedAt:  personalAccessToken.CreatedAt,
+	}
+}
+func NewPersonalAccessTokensResponse(personalAccessTokens []entity.PersonalAccessToken) *PersonalAccessTokensResponse {
+	personalAccessTokensResponse := PersonalAccessTokensResponse{}
+
+	for _, personalAccessToken := range personalAccessTokens {
+		personalAccessTokensResponse = append(personalAccessTokensResponse, NewPersonalAccessTokenResponse(personalAccessToken))
+	}
+	return &personalAccessTokensResponse
+}
@@ -0,0 +1,53 @@
+package dto
+
+import "golang-api/entity"
+
+type CreateRoleRequest struct {
+	Name        string   `json:"name" validate:"required,max=64,excludes=/"`
+	Description string   `json:"description" validate:"max=256"`
+	Permissions []string `json:"permissions" validate:"required,dive,required,excludes=,"`
+}
+
+type UpdateRoleRequest struct {
+	Name        string   `json:"-"`
+	Description string   `json:"description" validate:"max=256"`
+	Permissions []string `json:"permissions" validate:"omitempty,dive,required,excludes=,"`
+}
+
+type AssignRoleRequest struct {
+	UserID uint   `json:"-"`
+	Role   string `json:"role" validate:"required"`
+}
+
+type RoleResponse struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+	BuiltIn     bool     `json:"builtIn"`
+}
+
+type RolesResponse []*RoleResponse
+
+func NewRoleResponse(role entity.Role) *RoleResponse {
+	return &RoleResponse{
+		Name:        role.Name,
+		Description: role.Description,
+		Permissions: role.Permissions,
+		BuiltIn:     role.BuiltIn,
+	}
+}
+func NewRolesResponse(roles []entity.Role) *RolesResponse {
+	var rolesResponse RolesResponse
+
+	for _, role := range roles {
+		rolesResponse = append(rolesResponse, NewRoleResponse(role))
+	}
+	return &rolesResponse
+}
+func (c *CreateRoleRequest) ToEntity() *entity.Role {
+	return &entity.Role{
+		Name:        c.Name,
+		Description: c.Description,
+		Permissions: c.Permissions,
+	}
+}
@@ -0,0 +1,40 @@
+package dto
+
+import (
+	"golang-api/entity"
+	"time"
+)
+
+type SessionResponse struct {
+	ID              string    `json:"id"`
+	CreatedAt       time.Time `json:"createdAt"`
+	LastRefreshedAt time.Time `json:"lastRefreshedAt"`
+	ExpiresAt       time.Time `json:"expiresAt"`
+	UserAgent       string    `json:"userAgent"`
+	IP              string    `json:"ip"`
+	ClientID        string    `json:"clientId,omitempty"`
+	Current         bool      `json:"current"`
+}
+
+type SessionsResponse []*SessionResponse
+
+func NewSessionResponse(session entity.Session, currentSessionID string) *SessionResponse {
+	return &SessionResponse{
+		ID:              session.ID,
+		CreatedAt:       session.CreatedAt,
+		LastRefreshedAt: session.LastRefreshedAt,
+		ExpiresAt:       session.ExpiresAt,
+		UserAgent:       session.UserAgent,
+		IP:              session.IP,
+		ClientID:        session.ClientID,
+		Current:         session.ID == currentSessionID,
+	}
+}
+func NewSessionsResponse(sessions []entity.Session, currentSessionID string) *SessionsResponse {
+	sessionsResponse := SessionsResponse{}
+
+	for _, session := range sessions {
+		sessionsResponse = append(sessionsResponse, NewSessionResponse(session, currentSessionID))
+	}
+	return &sessionsResponse
+}
@@ -0,0 +1,22 @@
+package dto
+
+import "time"
+
+// Lifecycle states of a signing key
+const (
+	SigningKeyStatusPending  = "pending"
+	SigningKeyStatusActive   = "active"
+	SigningKeyStatusRetiring = "retiring"
+	SigningKeyStatusRetired  = "retired"
+)
+
+type SigningKeyResponse struct {
+	KeyID       string     `json:"kid"`
+	Algorithm   string     `json:"algorithm"`
+	Status      string     `json:"status"`
+	NotBefore   time.Time  `json:"notBefore"`
+	RetireAfter *time.Time `json:"retireAfter,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+type SigningKeysResponse []*SigningKeyResponse
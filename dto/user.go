@@ -1,6 +1,9 @@
 package dto
 
-import "golang-api/entity"
+import (
+	"golang-api/entity"
+	"time"
+)
 
 type CreateUserRequest struct {
 	Email     string `json:"email" validate:"required,email"`
@@ -10,9 +13,13 @@ type CreateUserRequest struct {
 }
 
 type UserResponse struct {
-	Email     string `json:"email"`
-	FirstName string `json:"firstName"`
-	LastName  string `json:"lastName"`
+	ID              uint       `json:"id"`
+	Email           string     `json:"email"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt"`
+	PendingEmail    string     `json:"pendingEmail,omitempty"`
+	FirstName       string     `json:"firstName"`
+	LastName        string     `json:"lastName"`
+	Role            string     `json:"role"`
 }
 type UpdateUserRequest struct {
 	ID        uint   `json:"-"`
@@ -20,15 +27,22 @@ type UpdateUserRequest struct {
 	FirstName string `json:"firstName" validate:"omitempty,gt=2"`
 	LastName  string `json:"lastName" validate:"omitempty,gt=2"`
 	Password  string `json:"password" validate:"omitempty,gt=6"`
+
+	// CallerPermissions are the permissions of the caller, who cannot update users whose role grants more
+	CallerPermissions []string `json:"-"`
 }
 
 type UsersResponse []*UserResponse
 
 func NewUserResponse(user entity.User) *UserResponse {
 	return &UserResponse{
-		Email:     user.Email,
-		FirstName: user.FirstName,
-		LastName:  user.LastName,
+		ID:              user.ID,
+		Email:           user.Email,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		PendingEmail:    user.PendingEmail,
+		FirstName:       user.FirstName,
+		LastName:        user.LastName,
+		Role:            user.Role,
 	}
 }
 func NewUsersResponse(users []entity.User) *UsersResponse {
@@ -36,9 +50,13 @@ func NewUsersResponse(users []entity.User) *UsersResponse {
 
 	for _, user := range users {
 		userResponse := UserResponse{
-			Email:     user.Email,
-			FirstName: user.FirstName,
-			LastName:  user.LastName,
+			ID:              user.ID,
+			Email:           user.Email,
+			EmailVerifiedAt: user.EmailVerifiedAt,
+			PendingEmail:    user.PendingEmail,
+			FirstName:       user.FirstName,
+			LastName:        user.LastName,
+			Role:            user.Role,
 		}
 		usersResponse = append(usersResponse, &userResponse)
 	}
@@ -50,6 +68,7 @@ func (c *CreateUserRequest) ToEntity() *entity.User {
 		FirstName: c.FirstName,
 		LastName:  c.LastName,
 		Password:  c.Password,
+		Role:      entity.RoleMember,
 	}
 }
 func (c *UpdateUserRequest) ToEntity() *entity.User {
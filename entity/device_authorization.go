@@ -0,0 +1,50 @@
+package entity
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// GrantTypeDeviceCode is the grant type of RFC 8628, used to poll /oauth/token
+const GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+// States of a device authorization
+const (
+	DeviceAuthorizationPending  = "pending"
+	DeviceAuthorizationApproved = "approved"
+	DeviceAuthorizationDenied   = "denied"
+)
+
+// ErrDeviceAuthorizationNotFound is returned for unknown, expired or already redeemed device authorizations
+var ErrDeviceAuthorizationNotFound = errors.New("invalid or expired device code")
+
+// DeviceAuthorization is a login started on a device without a browser, waiting for a user to approve it.
+// The device polls with the device code, of which only the hash is stored, and the user types the user code
+type DeviceAuthorization struct {
+	DeviceCodeHash string
+	UserCode       string
+	ClientID       string
+	Scopes         []string
+	Status         string
+	UserEmail      string
+	Interval       time.Duration
+	ExpiresAt      time.Time
+
+	// AuthTime and AMR tell when and how the approving user authenticated, the device session keeps them
+	AuthTime time.Time
+	AMR      []string
+}
+
+type DeviceAuthorizationRepository interface {
+	CreateDeviceAuthorization(ctx context.Context, deviceAuthorization DeviceAuthorization) error
+	GetDeviceAuthorizationByUserCode(ctx context.Context, userCode string) (*DeviceAuthorization, error)
+	// SetDeviceAuthorizationStatus records the user's decision along with the approving user's authentication,
+	// only while the authorization is pending
+	SetDeviceAuthorizationStatus(ctx context.Context, deviceAuthorization DeviceAuthorization) error
+	// PollDeviceAuthorization returns the authorization and the time of the previous poll, recording this one
+	PollDeviceAuthorization(ctx context.Context, deviceCodeHash string) (*DeviceAuthorization, time.Time, error)
+	SetDeviceAuthorizationInterval(ctx context.Context, deviceCodeHash string, interval time.Duration) error
+	// ConsumeDeviceAuthorization deletes the authorization, only the first call succeeds
+	ConsumeDeviceAuthorization(ctx context.Context, deviceAuthorization DeviceAuthorization) error
+}
@@ -0,0 +1,12 @@
+package entity
+
+import (
+	"context"
+	"time"
+)
+
+type DPoPProofRepository interface {
+	// UseDPoPProof records the jti of a proof made with the key until expiresAt.
+	// It returns false when the proof was already used, only the first call succeeds
+	UseDPoPProof(ctx context.Context, jkt string, jti string, expiresAt time.Time) (bool, error)
+}
@@ -0,0 +1,27 @@
+package entity
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrFederatedIdentityNotFound is returned for identities that are not linked to any user
+var ErrFederatedIdentityNotFound = errors.New("federated identity not found")
+
+// FederatedIdentity links a user to the subject of an upstream OpenID Connect provider.
+// Email is the address given by the provider when the identity was linked, shown to tell identities apart
+type FederatedIdentity struct {
+	ID        uint
+	UserID    uint
+	Provider  string
+	Subject   string
+	Email     string
+	CreatedAt time.Time
+}
+
+type FederatedIdentityRepository interface {
+	CreateFederatedIdentity(federatedIdentity FederatedIdentity) (*FederatedIdentity, error)
+	GetFederatedIdentity(provider string, subject string) (*FederatedIdentity, error)
+	GetFederatedIdentities(userID uint) ([]FederatedIdentity, error)
+	DeleteFederatedIdentity(userID uint, ID uint) error
+}
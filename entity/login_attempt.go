@@ -0,0 +1,23 @@
+package entity
+
+import (
+	"context"
+	"time"
+)
+
+// LoginAttempts counts the failed logins of an account or a client IP within the attempt window
+type LoginAttempts struct {
+	Failures    int64
+	LockedUntil time.Time
+	// HardLocked stays set until an admin unlocks the account
+	HardLocked bool
+}
+
+type LoginAttemptRepository interface {
+	GetLoginAttempts(ctx context.Context, key string) (*LoginAttempts, error)
+	// RecordLoginFailure counts a failure and returns the failures within the window
+	RecordLoginFailure(ctx context.Context, key string, window time.Duration) (int64, error)
+	SetLoginLock(ctx context.Context, key string, lockedUntil time.Time) error
+	SetLoginHardLock(ctx context.Context, key string) error
+	ClearLoginAttempts(ctx context.Context, key string) error
+}
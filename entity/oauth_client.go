@@ -0,0 +1,57 @@
+package entity
+
+import (
+	"errors"
+	"time"
+)
+
+// OAuth2 grant types a client can be allowed to use
+const (
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+)
+
+// ErrOAuthClientNotFound is returned for unknown client IDs
+var ErrOAuthClientNotFound = errors.New("oauth client not found")
+
+// OAuthClient is an application registered to request tokens at /oauth/token. Only the hash of its secret is stored.
+// Public clients, like SPAs and mobile apps, cannot keep a secret and have none
+type OAuthClient struct {
+	ID           uint
+	ClientID     string
+	SecretHash   string
+	Name         string
+	Scopes       []string
+	GrantTypes   []string
+	RedirectURIs []string
+	Public       bool
+	CreatedAt    time.Time
+}
+
+// AllowsGrantType reports whether the client was registered for the grant type
+func (client OAuthClient) AllowsGrantType(grantType string) bool {
+	for _, allowed := range client.GrantTypes {
+		if allowed == grantType {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsRedirectURI reports whether the URI is in the client's allowlist, compared exactly
+func (client OAuthClient) AllowsRedirectURI(redirectURI string) bool {
+	for _, allowed := range client.RedirectURIs {
+		if allowed == redirectURI {
+			return true
+		}
+	}
+	return false
+}
+
+type OAuthClientRepository interface {
+	GetOAuthClientByClientID(clientID string) (*OAuthClient, error)
+	GetOAuthClients() ([]OAuthClient, error)
+	CreateOAuthClient(client OAuthClient) (*OAuthClient, error)
+	DeleteOAuthClient(clientID string) error
+}
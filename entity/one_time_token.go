@@ -0,0 +1,37 @@
+package entity
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Purposes of one-time tokens, each one lives in its own namespace
+const (
+	OneTimeTokenMFAChallenge      = "mfa_challenge"
+	OneTimeTokenPasswordReset     = "password_reset"
+	OneTimeTokenEmailVerification = "email_verification"
+	OneTimeTokenAuthorizationCode = "authorization_code"
+	OneTimeTokenFederatedLogin    = "federated_login"
+)
+
+// ErrOneTimeTokenNotFound is returned for unknown, expired or already consumed one-time tokens
+var ErrOneTimeTokenNotFound = errors.New("invalid or expired token")
+
+// OneTimeToken is a short-lived secret handed to a client. Only its hash is stored
+type OneTimeToken struct {
+	Purpose   string
+	TokenHash string
+	Subject   string
+	Data      map[string]string
+	ExpiresAt time.Time
+}
+
+type OneTimeTokenRepository interface {
+	SetOneTimeToken(ctx context.Context, oneTimeToken OneTimeToken) error
+	GetOneTimeToken(ctx context.Context, purpose string, tokenHash string) (*OneTimeToken, error)
+	// ConsumeOneTimeToken atomically returns and deletes the token, so it can be used only once
+	ConsumeOneTimeToken(ctx context.Context, purpose string, tokenHash string) (*OneTimeToken, error)
+	// IncrementOneTimeTokenAttempts counts a failed attempt at using the token and returns the total
+	IncrementOneTimeTokenAttempts(ctx context.Context, purpose string, tokenHash string) (int64, error)
+}
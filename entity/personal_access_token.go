@@ -0,0 +1,34 @@
+package entity
+
+import (
+	"errors"
+	"time"
+)
+
+// PersonalAccessTokenPrefix starts every personal access token, so they are told apart from JWTs and spotted by secret scanners
+const PersonalAccessTokenPrefix = "gapi_pat_"
+
+// ErrPersonalAccessTokenNotFound is returned for unknown or revoked personal access tokens
+var ErrPersonalAccessTokenNotFound = errors.New("personal access token not found")
+
+// PersonalAccessToken is a long-lived token for automation. Only the hash of the secret is stored,
+// DisplayPrefix keeps its first characters so users can recognize it
+type PersonalAccessToken struct {
+	ID            uint
+	UserID        uint
+	Name          string
+	DisplayPrefix string
+	TokenHash     string
+	Scopes        []string
+	ExpiresAt     *time.Time
+	LastUsedAt    *time.Time
+	CreatedAt     time.Time
+}
+
+type PersonalAccessTokenRepository interface {
+	CreatePersonalAccessToken(personalAccessToken PersonalAccessToken) (*PersonalAccessToken, error)
+	GetPersonalAccessTokenByHash(tokenHash string) (*PersonalAccessToken, error)
+	GetPersonalAccessTokens(userID uint) ([]PersonalAccessToken, error)
+	DeletePersonalAccessToken(userID uint, ID uint) error
+	UpdatePersonalAccessTokenLastUsed(ID uint, lastUsedAt time.Time) error
+}
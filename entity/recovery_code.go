@@ -0,0 +1,25 @@
+package entity
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrRecoveryCodeInvalid is returned for unknown or already used recovery codes
+var ErrRecoveryCodeInvalid = errors.New("invalid recovery code")
+
+// RecoveryCode is a single-use code that replaces the TOTP code when the authenticator is lost
+type RecoveryCode struct {
+	ID       uint
+	UserID   uint
+	CodeHash string
+	UsedAt   *time.Time
+}
+
+type RecoveryCodeRepository interface {
+	// ReplaceRecoveryCodes deletes the codes of the user and stores the given ones
+	ReplaceRecoveryCodes(userID uint, codeHashes []string) error
+	// UseRecoveryCode marks an unused code as used, returning ErrRecoveryCodeInvalid if there is none
+	UseRecoveryCode(userID uint, codeHash string) error
+	DeleteRecoveryCodes(userID uint) error
+}
@@ -0,0 +1,89 @@
+package entity
+
+import "strings"
+
+// Permissions that can be granted to a role
+const (
+	PermissionAll             = "*"
+	PermissionUsersRead       = "users:read"
+	PermissionUsersReadSelf   = "users:read:self"
+	PermissionUsersCreate     = "users:create"
+	PermissionUsersUpdate     = "users:update"
+	PermissionUsersUpdateSelf = "users:update:self"
+	PermissionUsersDelete     = "users:delete"
+	PermissionUsersUnlock     = "users:unlock"
+	PermissionRolesRead       = "roles:read"
+	PermissionRolesWrite      = "roles:write"
+	PermissionKeysManage      = "keys:manage"
+	PermissionSessionsManage  = "sessions:manage"
+	PermissionMetricsRead     = "metrics:read"
+	PermissionClientsManage   = "clients:manage"
+)
+
+// Built-in roles, seeded on startup
+const (
+	RoleAdmin    = "admin"
+	RoleOperator = "operator"
+	RoleMember   = "member"
+)
+
+type Role struct {
+	ID          uint
+	Name        string
+	Description string
+	Permissions []string
+	BuiltIn     bool
+}
+
+type RoleRepository interface {
+	GetRoleByName(name string) (*Role, error)
+	GetRoles() ([]Role, error)
+	CreateRole(role Role) (*Role, error)
+	UpdateRole(role Role) (*Role, error)
+	DeleteRole(name string) error
+}
+
+// DefaultRoles returns the built-in roles every installation starts with
+func DefaultRoles() []Role {
+	return []Role{
+		{
+			Name:        RoleAdmin,
+			Description: "Manages every user and role",
+			Permissions: []string{PermissionAll},
+			BuiltIn:     true,
+		},
+		{
+			Name:        RoleOperator,
+			Description: "Reads, creates and updates users",
+			Permissions: []string{PermissionUsersRead, PermissionUsersCreate, PermissionUsersUpdate, PermissionRolesRead},
+			BuiltIn:     true,
+		},
+		{
+			Name:        RoleMember,
+			Description: "Reads and updates its own user",
+			Permissions: []string{PermissionUsersReadSelf, PermissionUsersUpdateSelf},
+			BuiltIn:     true,
+		},
+	}
+}
+
+// GrantsAll checks if every one of permissions is granted by the granted list.
+// A permission on the caller's own user is implied by the same permission on every user
+func GrantsAll(granted []string, permissions []string) bool {
+	for _, permission := range permissions {
+		if !HasPermission(granted, permission) && !HasPermission(granted, strings.TrimSuffix(permission, ":self")) {
+			return false
+		}
+	}
+	return true
+}
+
+// HasPermission checks if the permission is in the given list, either explicitly or through the wildcard
+func HasPermission(permissions []string, permission string) bool {
+	for _, granted := range permissions {
+		if granted == PermissionAll || granted == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,29 @@
+package entity
+
+import "time"
+
+// Types of security event
+const (
+	SecurityEventRefreshTokenReuse   = "refresh_token_reuse"
+	SecurityEventMFAEnabled          = "mfa_enabled"
+	SecurityEventMFADisabled         = "mfa_disabled"
+	SecurityEventRecoveryCodeUsed    = "recovery_code_used"
+	SecurityEventRecoveryCodesIssued = "recovery_codes_issued"
+	SecurityEventPasswordReset       = "password_reset"
+	SecurityEventEmailChanged        = "email_changed"
+	SecurityEventAccountLocked       = "account_locked"
+	SecurityEventIdentityLinked      = "identity_linked"
+	SecurityEventIdentityUnlinked    = "identity_unlinked"
+)
+
+type SecurityEvent struct {
+	ID        uint
+	Type      string
+	UserEmail string
+	Details   string
+	CreatedAt time.Time
+}
+
+type SecurityEventRepository interface {
+	CreateSecurityEvent(securityEvent SecurityEvent) error
+}
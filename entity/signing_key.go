@@ -0,0 +1,21 @@
+package entity
+
+import "time"
+
+// SigningKey is a stored token signing key. KeyMaterial holds the PEM private key, or the secret for HS256,
+// encrypted with SIGNING_KEY_ENCRYPTION_KEY
+type SigningKey struct {
+	ID          uint
+	KeyID       string
+	Algorithm   string
+	KeyMaterial string
+	NotBefore   time.Time
+	RetireAfter *time.Time
+	CreatedAt   time.Time
+}
+
+type SigningKeyRepository interface {
+	GetSigningKeys() ([]SigningKey, error)
+	CreateSigningKey(signingKey SigningKey) (*SigningKey, error)
+	UpdateSigningKey(signingKey SigningKey) (*SigningKey, error)
+}
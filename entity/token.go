@@ -2,21 +2,85 @@ package entity
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// Different types of error returned by the TokenRepository
+var (
+	ErrRefreshTokenNotFound = errors.New("invalid refresh token")
+	ErrRefreshTokenReused   = errors.New("refresh token reuse detected")
+	ErrSessionNotFound      = errors.New("session not found")
+)
+
 type TokenDetails struct {
 	SessionUuid           uuid.UUID
 	AccessToken           string
 	AccessTokenExpiresAt  time.Time
 	RefreshToken          string
 	RefreshTokenExpiresAt time.Time
+	// TokenType is DPoP for tokens bound to a DPoP key, Bearer otherwise
+	TokenType string
+}
+
+// RefreshToken is the stored state of an issued refresh token.
+// Every login starts a token family and each rotation adds a child of the previous token
+type RefreshToken struct {
+	ID        string
+	UserEmail string
+	FamilyID  string
+	ParentID  string
+	Rotation  int
+	Rotated   bool
+	ExpiresAt time.Time
+	// ClientID and Scopes are set for families started by an OAuth client, every rotation keeps them
+	ClientID string
+	Scopes   []string
+	// AuthTime and AMR tell when and how the user logged in, every rotation keeps them
+	AuthTime time.Time
+	AMR      []string
+}
+
+// Session is the token family started by a login, as shown to its user
+type Session struct {
+	ID                   string
+	UserEmail            string
+	CreatedAt            time.Time
+	LastRefreshedAt      time.Time
+	ExpiresAt            time.Time
+	UserAgent            string
+	IP                   string
+	AccessTokenID        string
+	AccessTokenExpiresAt time.Time
+	ClientID             string
+}
+
+// SessionMetadata describes the client a token pair is issued to.
+// An OAuth client gets tokens limited to the scopes the user granted it
+type SessionMetadata struct {
+	UserAgent string
+	IP        string
+	ClientID  string
+	Scopes    []string
+	// JKT is the thumbprint of the DPoP key the tokens are bound to, empty for bearer tokens
+	JKT string
+	// AuthTime and AMR tell when and how the user authenticated to start the session. AuthTime defaults to the issue time
+	AuthTime time.Time
+	AMR      []string
 }
 
 type TokenRepository interface {
-	SetRefreshToken(ctx context.Context, userID string, tokenID string, expiresIn time.Time) error
-	DeleteRefreshToken(ctx context.Context, userID string, prevTokenID string) error
+	SetRefreshToken(ctx context.Context, refreshToken RefreshToken, session Session) error
+	GetRefreshToken(ctx context.Context, userID string, tokenID string) (*RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, userID string, tokenID string) (*RefreshToken, error)
+	DeleteTokenFamily(ctx context.Context, userID string, familyID string) error
+	GetSession(ctx context.Context, userID string, sessionID string) (*Session, error)
+	GetSessions(ctx context.Context, userID string) ([]Session, error)
 	DeleteUserRefreshTokens(ctx context.Context, userID string) error
+	DenylistAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error
+	IsAccessTokenDenylisted(ctx context.Context, tokenID string) (bool, error)
+	SetTokensRevokedAt(ctx context.Context, userID string, revokedAt time.Time, expiration time.Duration) error
+	GetTokensRevokedAt(ctx context.Context, userID string) (time.Time, error)
 }
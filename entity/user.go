@@ -1,11 +1,30 @@
 package entity
 
+import (
+	"errors"
+	"time"
+)
+
+// ErrTOTPStepUsed is returned when a TOTP code of the same or a later time step was already accepted
+var ErrTOTPStepUsed = errors.New("TOTP time step already used")
+
 type User struct {
 	ID        uint
 	FirstName string
 	LastName  string
 	Email     string
 	Password  string
+	Role      string
+
+	// TOTPSecret is set on enrollment, TOTPEnabled once the first code is confirmed
+	TOTPSecret   string
+	TOTPEnabled  bool
+	TOTPLastStep int64
+
+	// EmailVerifiedAt is nil until the user follows a verification link.
+	// A requested email change waits in PendingEmail until the new address is verified
+	EmailVerifiedAt *time.Time
+	PendingEmail    string
 }
 type UserRepository interface {
 	GetUserByID(ID uint) (*User, error)
@@ -14,4 +33,12 @@ type UserRepository interface {
 	CreateUser(User User) (*User, error)
 	UpdateUser(User User) (*User, error)
 	DeleteUser(ID uint) error
+	CountUsersByRole(role string) (int64, error)
+	UpdateUserMFA(User User) error
+	// UseTOTPStep records step as the last accepted TOTP time step, returning ErrTOTPStepUsed unless it is later than the recorded one
+	UseTOTPStep(ID uint, step int64) error
+	UpdateUserPassword(ID uint, password string) error
+	UpdateUserEmail(User User) error
+	// CountLegacyPasswordHashes counts the users whose password hash does not start with currentPrefix
+	CountLegacyPasswordHashes(currentPrefix string) (int64, error)
 }
@@ -2,27 +2,44 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"golang-api/dto"
+	"golang-api/entity"
 	"golang-api/service"
 	"golang-api/util"
+	"io"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
 )
 
 type AuthHandler interface {
 	Login(rw http.ResponseWriter, r *http.Request)
+	LoginMFA(rw http.ResponseWriter, r *http.Request)
 	Logout(rw http.ResponseWriter, r *http.Request)
 	Revoke(rw http.ResponseWriter, r *http.Request)
 	Refresh(rw http.ResponseWriter, r *http.Request)
 }
 
 type authHandler struct {
-	authService service.AuthService
-	config      util.Config
+	authService          service.AuthService
+	mfaService           service.MFAService
+	loginThrottleService service.LoginThrottleService
+	dpopService          service.DPoPService
+	tokenMaker           util.TokenMaker
+	refreshTokenMaker    util.TokenMaker
+	config               util.Config
 }
 
-func NewAuthHandler(authService service.AuthService, config util.Config) AuthHandler {
+func NewAuthHandler(authService service.AuthService, mfaService service.MFAService, loginThrottleService service.LoginThrottleService, dpopService service.DPoPService, tokenMaker util.TokenMaker, refreshTokenMaker util.TokenMaker, config util.Config) AuthHandler {
 	return &authHandler{
 		authService,
+		mfaService,
+		loginThrottleService,
+		dpopService,
+		tokenMaker,
+		refreshTokenMaker,
 		config,
 	}
 }
@@ -39,31 +56,112 @@ func (handler *authHandler) Login(rw http.ResponseWriter, r *http.Request) {
 		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
 		return
 	}
-	isAuthenticated := handler.authService.Login(loginRequest.Email, loginRequest.Password)
-	if !isAuthenticated {
+
+	// A DPoP proof binds the tokens to the client's key, it is checked before spending the credentials
+	jkt, err := dpopThumbprint(r, handler.dpopService, handler.config)
+	if err != nil {
+		writeDPoPError(rw, err)
+		return
+	}
+
+	ip := util.ClientIP(r, handler.config.TrustProxyHeaders)
+	if err := handler.loginThrottleService.Check(r.Context(), loginRequest.Email, ip); err != nil {
+		writeLoginError(rw, err)
+		return
+	}
+
+	user, err := handler.authService.Login(loginRequest.Email, loginRequest.Password)
+	switch {
+	case errors.Is(err, service.ErrEmailNotVerified):
+		dto.WriteResponse(rw, http.StatusForbidden, dto.ServiceError{Message: err.Error()})
+		return
+	// The credentials could not be checked, which must not count as a failed login
+	case errors.Is(err, service.ErrLDAPUnavailable):
+		dto.WriteResponse(rw, http.StatusServiceUnavailable, dto.ServiceError{Message: "Service Unavailable"})
+		return
+	case err != nil:
+		if err := handler.loginThrottleService.RecordFailure(r.Context(), loginRequest.Email, ip); err != nil {
+			log.Printf("Failed to record failed login of %s from %s: %v\n", loginRequest.Email, ip, err)
+		}
+		dto.WriteResponse(rw, http.StatusUnauthorized, dto.ServiceError{Message: "Unauthorized"})
+		return
+	}
+
+	// With a second factor enrolled, the password only buys a challenge to complete at /auth/login/mfa,
+	// the failed logins are kept until it is
+	if user.TOTPEnabled {
+		challenge, err := handler.mfaService.CreateChallenge(r.Context(), *user, util.AMRPassword)
+		if err != nil {
+			dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: "Internal Server Error"})
+			return
+		}
+		dto.WriteResponse(rw, http.StatusOK, challenge)
+		return
+	}
+
+	if err := handler.loginThrottleService.RecordSuccess(r.Context(), user.Email); err != nil {
+		log.Printf("Failed to reset failed logins of %s: %v\n", user.Email, err)
+	}
+
+	handler.writeTokens(rw, r, user.Email, jkt, []string{util.AMRPassword})
+}
+
+// Complete a login with the challenge token and a TOTP or recovery code
+func (handler *authHandler) LoginMFA(rw http.ResponseWriter, r *http.Request) {
+	var loginRequest dto.MFALoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&loginRequest); err != nil {
+		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+		return
+	}
+
+	if err := validate.Struct(&loginRequest); err != nil {
+		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+		return
+	}
+
+	jkt, err := dpopThumbprint(r, handler.dpopService, handler.config)
+	if err != nil {
+		writeDPoPError(rw, err)
+		return
+	}
+
+	user, amr, err := handler.mfaService.VerifyChallenge(r.Context(), loginRequest.ChallengeToken, loginRequest.Code, util.ClientIP(r, handler.config.TrustProxyHeaders))
+	var lockedErr *service.LoginLockedError
+	if errors.As(err, &lockedErr) {
+		writeLoginError(rw, err)
+		return
+	}
+	if err != nil {
 		dto.WriteResponse(rw, http.StatusUnauthorized, dto.ServiceError{Message: "Unauthorized"})
 		return
 	}
 
-	tokenDetails, err := handler.authService.CreateTokens(r.Context(), loginRequest.Email, "")
+	handler.writeTokens(rw, r, user.Email, jkt, amr)
+}
 
+// writeTokens starts a new session for the user, who just authenticated with the methods of amr,
+// and responds with its token pair, bound to the DPoP key of jkt when set
+func (handler *authHandler) writeTokens(rw http.ResponseWriter, r *http.Request, email string, jkt string, amr []string) {
+	sessionMetadata := handler.sessionMetadata(r)
+	sessionMetadata.JKT = jkt
+	sessionMetadata.AMR = amr
+	tokenDetails, err := handler.authService.CreateTokens(r.Context(), email, "", sessionMetadata)
 	if err != nil {
 		dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: "Internal Server Error"})
+		return
 	}
-	dto.WriteResponse(rw, http.StatusCreated, dto.LoginResponse{
-		AccessToken:           tokenDetails.AccessToken,
-		AccessTokenExpiresAt:  tokenDetails.AccessTokenExpiresAt,
-		RefreshToken:          tokenDetails.RefreshToken,
-		RefreshTokenExpiresAt: tokenDetails.RefreshTokenExpiresAt,
-		Email:                 loginRequest.Email,
-	})
+
+	writeLoginResponse(rw, handler.config, tokenDetails, email)
 }
 
-// Remove the given refresh token
+// Remove the session of the given refresh token and revoke the given access token.
+// With the refresh token in a cookie the access token is optional, browsers may have lost it on a reload.
+// An access token bound to a DPoP key needs a proof signed with it, as on the protected endpoints
 func (handler *authHandler) Logout(rw http.ResponseWriter, r *http.Request) {
 	var logoutRequest dto.TokenRequest
 
-	if err := json.NewDecoder(r.Body).Decode(&logoutRequest); err != nil {
+	cookieRefreshToken, hasCookie := refreshTokenCookie(r)
+	if err := json.NewDecoder(r.Body).Decode(&logoutRequest); err != nil && !(hasCookie && errors.Is(err, io.EOF)) {
 		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
 		return
 	}
@@ -73,27 +171,47 @@ func (handler *authHandler) Logout(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := util.VerifyToken(logoutRequest.AccessToken, handler.config.JWTSecretKey)
-	if err != nil {
-		dto.WriteResponse(rw, http.StatusUnauthorized, dto.ServiceError{Message: err.Error()})
-		return
+	var accessPayload *util.JWTPayload
+	if !hasCookie || logoutRequest.AccessToken != "" {
+		var err error
+		accessPayload, err = handler.authService.VerifyAccessToken(r.Context(), logoutRequest.AccessToken)
+		if err != nil {
+			dto.WriteResponse(rw, http.StatusUnauthorized, dto.ServiceError{Message: err.Error()})
+			return
+		}
+		if !checkBoundAccessToken(rw, r, handler.dpopService, handler.config, logoutRequest.AccessToken, accessPayload) {
+			return
+		}
+	}
+
+	if hasCookie {
+		logoutRequest.RefreshToken = cookieRefreshToken
+		clearSessionCookies(rw, handler.config)
 	}
 
-	refreshPayload, err := util.VerifyToken(logoutRequest.RefreshToken, handler.config.JWTSecretKey)
+	refreshPayload, err := handler.refreshTokenMaker.VerifyToken(logoutRequest.RefreshToken)
 	if err != nil {
 		dto.WriteResponse(rw, http.StatusUnauthorized, dto.ServiceError{Message: err.Error()})
 		return
 	}
 
-	if err := handler.authService.Logout(r.Context(), refreshPayload.UserEmail, logoutRequest.RefreshToken); err != nil {
+	if err := handler.authService.Logout(r.Context(), refreshPayload.UserEmail, refreshPayload.ID.String()); err != nil {
 		dto.WriteResponse(rw, http.StatusUnauthorized, dto.ServiceError{Message: "Unauthorized"})
 		return
 	}
 
+	if accessPayload != nil {
+		if err := handler.authService.RevokeAccessToken(r.Context(), accessPayload); err != nil {
+			dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: "Internal Server Error"})
+			return
+		}
+	}
+
 	rw.WriteHeader(http.StatusNoContent)
 }
 
-// Remove all sessions of presented email in access token
+// Remove all sessions of presented email in access token, invalidating every access token issued so far.
+// An access token bound to a DPoP key needs a proof signed with it, as on the protected endpoints
 func (handler *authHandler) Revoke(rw http.ResponseWriter, r *http.Request) {
 	var revokeRequest dto.AccessTokenRequest
 
@@ -107,11 +225,14 @@ func (handler *authHandler) Revoke(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	accessPayload, err := util.VerifyToken(revokeRequest.AccessToken, handler.config.JWTSecretKey)
+	accessPayload, err := handler.authService.VerifyAccessToken(r.Context(), revokeRequest.AccessToken)
 	if err != nil {
 		dto.WriteResponse(rw, http.StatusUnauthorized, dto.ServiceError{Message: err.Error()})
 		return
 	}
+	if !checkBoundAccessToken(rw, r, handler.dpopService, handler.config, revokeRequest.AccessToken, accessPayload) {
+		return
+	}
 
 	if err := handler.authService.Revoke(r.Context(), accessPayload.UserEmail); err != nil {
 		dto.WriteResponse(rw, http.StatusUnauthorized, dto.ServiceError{Message: "Unauthorized"})
@@ -121,44 +242,100 @@ func (handler *authHandler) Revoke(rw http.ResponseWriter, r *http.Request) {
 	rw.WriteHeader(http.StatusNoContent)
 }
 
-// Refresh both tokens if access token is expired and refresh token is still valid
+// Refresh both tokens if access token is expired and refresh token is still valid. Both must belong to the same session.
+// The refresh token cookie of browser clients is enough on its own, their access token lives in memory only.
+// Refresh tokens issued to OAuth clients are rejected, they are refreshed at /oauth/token.
+// A refresh token bound to a DPoP key needs a proof signed with the same key.
+// Replaying a refresh token that was already rotated revokes its whole session
 func (handler *authHandler) Refresh(rw http.ResponseWriter, r *http.Request) {
-	var logoutRequest dto.TokenRequest
+	var accessPayload *util.JWTPayload
+	refreshToken, hasCookie := refreshTokenCookie(r)
+	if !hasCookie {
+		var logoutRequest dto.TokenRequest
 
-	if err := json.NewDecoder(r.Body).Decode(&logoutRequest); err != nil {
-		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
-		return
-	}
+		if err := json.NewDecoder(r.Body).Decode(&logoutRequest); err != nil {
+			dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+			return
+		}
 
-	if err := validate.Struct(&logoutRequest); err != nil {
-		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
-		return
+		if err := validate.Struct(&logoutRequest); err != nil {
+			dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+			return
+		}
+
+		expiredPayload, err := handler.tokenMaker.VerifyToken(logoutRequest.AccessToken)
+		if err == nil {
+			dto.WriteResponse(rw, http.StatusUnauthorized, dto.ServiceError{Message: "access token has not expired"})
+			return
+		}
+		if err != util.ErrExpiredToken {
+			dto.WriteResponse(rw, http.StatusUnauthorized, dto.ServiceError{Message: err.Error()})
+			return
+		}
+		accessPayload = expiredPayload
+		refreshToken = logoutRequest.RefreshToken
 	}
 
-	_, err := util.VerifyToken(logoutRequest.AccessToken, handler.config.JWTSecretKey)
-	if err != util.ErrExpiredToken {
+	refreshPayload, err := handler.refreshTokenMaker.VerifyToken(refreshToken)
+	if err != nil {
 		dto.WriteResponse(rw, http.StatusUnauthorized, dto.ServiceError{Message: err.Error()})
 		return
 	}
+	if accessPayload != nil && (accessPayload.UserEmail != refreshPayload.UserEmail || accessPayload.SessionID != refreshPayload.SessionID) {
+		dto.WriteResponse(rw, http.StatusUnauthorized, dto.ServiceError{Message: "the access token belongs to another session"})
+		return
+	}
+	// Only /oauth/token refreshes the tokens of OAuth clients, it authenticates confidential clients
+	if refreshPayload.ClientID != "" {
+		dto.WriteResponse(rw, http.StatusUnauthorized, dto.ServiceError{Message: "refresh tokens issued to OAuth clients are refreshed at /oauth/token"})
+		return
+	}
 
-	refreshPayload, err := util.VerifyToken(logoutRequest.RefreshToken, handler.config.JWTSecretKey)
+	jkt, err := dpopThumbprint(r, handler.dpopService, handler.config)
 	if err != nil {
-		dto.WriteResponse(rw, http.StatusUnauthorized, dto.ServiceError{Message: err.Error()})
+		writeDPoPError(rw, err)
+		return
+	}
+	if boundJKT := refreshPayload.DPoPThumbprint(); boundJKT != "" && boundJKT != jkt {
+		dto.WriteResponse(rw, http.StatusUnauthorized, dto.ServiceError{Message: "the refresh token is bound to another DPoP key"})
 		return
 	}
 
-	tokenDetails, err := handler.authService.CreateTokens(r.Context(), refreshPayload.UserEmail, logoutRequest.RefreshToken)
+	sessionMetadata := handler.sessionMetadata(r)
+	sessionMetadata.JKT = jkt
+	tokenDetails, err := handler.authService.CreateTokens(r.Context(), refreshPayload.UserEmail, refreshPayload.ID.String(), sessionMetadata)
 
 	if err != nil {
+		if hasCookie {
+			clearSessionCookies(rw, handler.config)
+		}
 		dto.WriteResponse(rw, http.StatusUnauthorized, dto.ServiceError{Message: "Unauthorized"})
 		return
 	}
 
-	dto.WriteResponse(rw, http.StatusCreated, dto.LoginResponse{
-		AccessToken:           tokenDetails.AccessToken,
-		AccessTokenExpiresAt:  tokenDetails.AccessTokenExpiresAt,
-		RefreshToken:          tokenDetails.RefreshToken,
-		RefreshTokenExpiresAt: tokenDetails.RefreshTokenExpiresAt,
-		Email:                 refreshPayload.UserEmail,
-	})
+	writeLoginResponse(rw, handler.config, tokenDetails, refreshPayload.UserEmail)
+}
+
+// writeLoginError answers 429 with Retry-After during a lockout
+func writeLoginError(rw http.ResponseWriter, err error) {
+	var lockedErr *service.LoginLockedError
+	if !errors.As(err, &lockedErr) {
+		dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: "Internal Server Error"})
+		return
+	}
+
+	retryAfter := int64(math.Ceil(lockedErr.RetryAfter.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	rw.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+	dto.WriteResponse(rw, http.StatusTooManyRequests, dto.ServiceError{Message: lockedErr.Error()})
+}
+
+// sessionMetadata describes the client of the request, shown in the session list
+func (handler *authHandler) sessionMetadata(r *http.Request) entity.SessionMetadata {
+	return entity.SessionMetadata{
+		UserAgent: r.UserAgent(),
+		IP:        util.ClientIP(r, handler.config.TrustProxyHeaders),
+	}
 }
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"errors"
+	"golang-api/dto"
+	"golang-api/service"
+	"golang-api/util"
+	"net/http"
+)
+
+// dpopThumbprint verifies the DPoP proof sent to a token endpoint and returns the thumbprint of its key,
+// which the issued tokens are bound to. Requests without a proof get an empty thumbprint and bearer tokens
+func dpopThumbprint(r *http.Request, dpopService service.DPoPService, config util.Config) (string, error) {
+	proof, err := util.DPoPProofHeader(r)
+	if err != nil || proof == "" {
+		return "", err
+	}
+	return dpopService.VerifyProof(r.Context(), proof, r.Method, util.DPoPRequestURI(config.OIDCIssuer, r), "")
+}
+
+// checkBoundAccessToken writes a 401 and returns false unless a DPoP bound access token, presented in the body
+// rather than the Authorization header, comes with a proof for this request signed with its key, as the protected endpoints require
+func checkBoundAccessToken(rw http.ResponseWriter, r *http.Request, dpopService service.DPoPService, config util.Config, accessToken string, accessPayload *util.JWTPayload) bool {
+	jkt := accessPayload.DPoPThumbprint()
+	if jkt == "" {
+		return true
+	}
+
+	proof, err := util.DPoPProofHeader(r)
+	if err == nil {
+		err = dpopService.VerifyBoundProof(r.Context(), proof, r.Method, util.DPoPRequestURI(config.OIDCIssuer, r), accessToken, jkt)
+	}
+	if errors.Is(err, util.ErrInvalidDPoPProof) {
+		rw.Header().Set("WWW-Authenticate", util.DPoPChallenge("invalid_dpop_proof"))
+		dto.WriteResponse(rw, http.StatusUnauthorized, dto.ServiceError{Message: err.Error()})
+		return false
+	}
+	if err != nil {
+		dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: "Internal Server Error"})
+		return false
+	}
+	return true
+}
+
+// writeDPoPError answers 400 for a proof the client got wrong
+func writeDPoPError(rw http.ResponseWriter, err error) {
+	if errors.Is(err, util.ErrInvalidDPoPProof) {
+		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+		return
+	}
+	dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: "Internal Server Error"})
+}
+
+// dpopOAuthError reports an invalid proof to OAuth clients with the invalid_dpop_proof error code
+func dpopOAuthError(err error) error {
+	if errors.Is(err, util.ErrInvalidDPoPProof) {
+		return &service.OAuthError{Code: service.OAuthErrorInvalidDPoPProof, Description: err.Error()}
+	}
+	return err
+}
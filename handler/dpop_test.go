@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"golang-api/dto"
+	"golang-api/entity"
+	"golang-api/util"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+)
+
+// dpopClient holds the key a test client proves possession of
+type dpopClient struct {
+	signingKey *util.SigningKey
+	jwk        util.JWK
+	jkt        string
+}
+
+func newDPoPClient(t *testing.T) *dpopClient {
+	t.Helper()
+	keyMaterial, err := util.GenerateKeyMaterial(util.AlgorithmES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingKey, err := util.ParseSigningKey("", util.AlgorithmES256, keyMaterial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, err := util.NewJWK(signingKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jkt, err := jwk.Thumbprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &dpopClient{signingKey, jwk, jkt}
+}
+
+// proof signs a DPoP proof for the request, bound to the access token
+func (client *dpopClient) proof(t *testing.T, method string, uri string, accessToken string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"jti": uuid.New().String(),
+		"htm": method,
+		"htu": uri,
+		"iat": time.Now().Unix(),
+		"ath": util.DPoPAccessTokenHash(accessToken),
+	})
+	token.Header["typ"] = "dpop+jwt"
+	token.Header["jwk"] = client.jwk
+	proof, err := token.SignedString(client.signingKey.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proof
+}
+
+// loginWithDPoP starts a session whose tokens are bound to the key of the client
+func (server *tokenUseServer) loginWithDPoP(t *testing.T, client *dpopClient) *entity.TokenDetails {
+	t.Helper()
+	tokenDetails, err := server.authService.CreateTokens(context.Background(), "alice@example.com", "", entity.SessionMetadata{AMR: []string{util.AMRPassword}, JKT: client.jkt})
+	if err != nil {
+		t.Fatalf("CreateTokens: %v", err)
+	}
+	return tokenDetails
+}
+
+func TestAccountEndpointsRequireProofOfBoundToken(t *testing.T) {
+	endpoints := []struct {
+		name    string
+		path    string
+		body    func(tokenDetails *entity.TokenDetails) interface{}
+		handler func(server *tokenUseServer) http.HandlerFunc
+	}{
+		{
+			"logout",
+			"/api/v1/auth/logout",
+			func(tokenDetails *entity.TokenDetails) interface{} {
+				return dto.TokenRequest{AccessToken: tokenDetails.AccessToken, RefreshToken: tokenDetails.RefreshToken}
+			},
+			func(server *tokenUseServer) http.HandlerFunc { return server.authHandler.Logout },
+		},
+		{
+			"revoke",
+			"/api/v1/auth/revoke",
+			func(tokenDetails *entity.TokenDetails) interface{} {
+				return dto.AccessTokenRequest{AccessToken: tokenDetails.AccessToken}
+			},
+			func(server *tokenUseServer) http.HandlerFunc { return server.authHandler.Revoke },
+		},
+	}
+
+	for _, endpoint := range endpoints {
+		t.Run(endpoint.name, func(t *testing.T) {
+			server := newTokenUseServer(t)
+			client := newDPoPClient(t)
+			tokenDetails := server.loginWithDPoP(t, client)
+			uri := "https://api.example.com" + endpoint.path
+
+			call := func(proof string) *httptest.ResponseRecorder {
+				body, _ := json.Marshal(endpoint.body(tokenDetails))
+				r := httptest.NewRequest(http.MethodDelete, endpoint.path, bytes.NewReader(body))
+				if proof != "" {
+					r.Header.Set(util.DPoPHeader, proof)
+				}
+				rw := httptest.NewRecorder()
+				endpoint.handler(server)(rw, r)
+				return rw
+			}
+
+			for name, proof := range map[string]string{
+				"without a proof":               "",
+				"with a proof of another key":   newDPoPClient(t).proof(t, http.MethodDelete, uri, tokenDetails.AccessToken),
+				"with a proof of another token": client.proof(t, http.MethodDelete, uri, "another token"),
+			} {
+				rw := call(proof)
+				if rw.Code != http.StatusUnauthorized || !strings.HasPrefix(rw.Header().Get("WWW-Authenticate"), "DPoP ") {
+					t.Errorf("%s: status %d, WWW-Authenticate %q, want a 401 DPoP challenge", name, rw.Code, rw.Header().Get("WWW-Authenticate"))
+				}
+			}
+
+			if rw := call(client.proof(t, http.MethodDelete, uri, tokenDetails.AccessToken)); rw.Code != http.StatusNoContent {
+				t.Errorf("with the proof of the bound key: status %d, want 204: %s", rw.Code, rw.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"golang-api/dto"
+	"golang-api/entity"
+	"golang-api/service"
+	"net/http"
+)
+
+type EmailVerificationHandler interface {
+	VerifyEmail(rw http.ResponseWriter, r *http.Request)
+	ResendVerification(rw http.ResponseWriter, r *http.Request)
+}
+
+type emailVerificationHandler struct {
+	service service.EmailVerificationService
+}
+
+func NewEmailVerificationHandler(service service.EmailVerificationService) EmailVerificationHandler {
+	return &emailVerificationHandler{
+		service: service,
+	}
+}
+
+//	VerifyEmail handles POST requests and verifies the email of a verification link
+func (h *emailVerificationHandler) VerifyEmail(rw http.ResponseWriter, r *http.Request) {
+	var verifyEmailRequest dto.VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&verifyEmailRequest); err != nil {
+		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+		return
+	}
+
+	if err := validate.Struct(&verifyEmailRequest); err != nil {
+		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+		return
+	}
+
+	err := h.service.VerifyEmail(r.Context(), verifyEmailRequest.Token)
+	if errors.Is(err, entity.ErrOneTimeTokenNotFound) {
+		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+		return
+	}
+	if errors.Is(err, service.ErrEmailInUse) {
+		dto.WriteResponse(rw, http.StatusConflict, dto.ServiceError{Message: err.Error()})
+		return
+	}
+	if err != nil {
+		dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: "Internal Server Error"})
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+//	ResendVerification handles POST requests and mails a new verification link if the email belongs to an unverified user
+func (h *emailVerificationHandler) ResendVerification(rw http.ResponseWriter, r *http.Request) {
+	var resendVerificationRequest dto.ResendVerificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&resendVerificationRequest); err != nil {
+		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+		return
+	}
+
+	if err := validate.Struct(&resendVerificationRequest); err != nil {
+		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+		return
+	}
+
+	if err := h.service.ResendVerification(r.Context(), resendVerificationRequest.Email); err != nil {
+		dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: "Internal Server Error"})
+		return
+	}
+
+	rw.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"errors"
+	"golang-api/dto"
+	"golang-api/entity"
+	"golang-api/service"
+	"golang-api/util"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type FederationHandler interface {
+	GetProviders(rw http.ResponseWriter, r *http.Request)
+	Login(rw http.ResponseWriter, r *http.Request)
+	Link(rw http.ResponseWriter, r *http.Request)
+	Callback(rw http.ResponseWriter, r *http.Request)
+	GetIdentities(rw http.ResponseWriter, r *http.Request)
+	DeleteIdentity(rw http.ResponseWriter, r *http.Request)
+}
+
+type federationHandler struct {
+	federationService service.FederationService
+	authService       service.AuthService
+	mfaService        service.MFAService
+	config            util.Config
+}
+
+func NewFederationHandler(federationService service.FederationService, authService service.AuthService, mfaService service.MFAService, config util.Config) FederationHandler {
+	return &federationHandler{
+		federationService,
+		authService,
+		mfaService,
+		config,
+	}
+}
+
+//	GetProviders handles GET requests and returns the names of the identity providers users can log in with
+func (h *federationHandler) GetProviders(rw http.ResponseWriter, r *http.Request) {
+	dto.WriteResponse(rw, http.StatusOK, h.federationService.GetProviders())
+}
+
+//	Login handles GET/{provider} requests and redirects the browser to the identity provider
+func (h *federationHandler) Login(rw http.ResponseWriter, r *http.Request) {
+	authorizationURL, err := h.federationService.StartLogin(r.Context(), mux.Vars(r)["provider"])
+	if err != nil {
+		writeFederationError(rw, err)
+		return
+	}
+
+	rw.Header().Set("Cache-Control", "no-store")
+	http.Redirect(rw, r, authorizationURL, http.StatusFound)
+}
+
+//	Link handles POST/{provider}/link requests and returns the URL of the identity provider where the caller
+//	logs in, the identity is then linked to the caller's account on the callback
+func (h *federationHandler) Link(rw http.ResponseWriter, r *http.Request) {
+	jwtPayload, _ := util.JWTPayloadFromContext(r.Context())
+	if rejectPersonalAccessToken(rw, jwtPayload) {
+		return
+	}
+
+	authorizationURL, err := h.federationService.StartLink(r.Context(), mux.Vars(r)["provider"], jwtPayload.UserID)
+	if err != nil {
+		writeFederationError(rw, err)
+		return
+	}
+
+	dto.WriteResponse(rw, http.StatusOK, dto.FederatedAuthorizationResponse{AuthorizationURL: authorizationURL})
+}
+
+//	Callback handles GET/{provider}/callback requests coming back from the identity provider. It returns the
+//	token pair of a login, an MFA challenge when the user enabled a second factor, or the newly linked identity
+func (h *federationHandler) Callback(rw http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if providerError := query.Get("error"); providerError != "" {
+		dto.WriteResponse(rw, http.StatusUnauthorized, dto.ServiceError{Message: "the identity provider refused the login: " + providerError})
+		return
+	}
+	if query.Get("code") == "" || query.Get("state") == "" {
+		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: "code and state are required"})
+		return
+	}
+
+	federatedLogin, err := h.federationService.Callback(r.Context(), mux.Vars(r)["provider"], query.Get("code"), query.Get("state"))
+	if err != nil {
+		writeFederationError(rw, err)
+		return
+	}
+
+	if federatedLogin.Linked {
+		dto.WriteResponse(rw, http.StatusCreated, dto.NewFederatedIdentityResponse(*federatedLogin.Identity))
+		return
+	}
+
+	// The provider vouches for the first factor only, a second factor enrolled here is still required
+	if federatedLogin.User.TOTPEnabled {
+		challenge, err := h.mfaService.CreateChallenge(r.Context(), *federatedLogin.User, util.AMRFederated)
+		if err != nil {
+			dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: "Internal Server Error"})
+			return
+		}
+		dto.WriteResponse(rw, http.StatusOK, challenge)
+		return
+	}
+
+	sessionMetadata := entity.SessionMetadata{
+		UserAgent: r.UserAgent(),
+		IP:        util.ClientIP(r, h.config.TrustProxyHeaders),
+		AMR:       []string{util.AMRFederated},
+	}
+	tokenDetails, err := h.authService.CreateTokens(r.Context(), federatedLogin.User.Email, "", sessionMetadata)
+	if err != nil {
+		dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: "Internal Server Error"})
+		return
+	}
+
+	writeLoginResponse(rw, h.config, tokenDetails, federatedLogin.User.Email)
+}
+
+//	GetIdentities handles GET requests and returns the identities linked to the caller's account
+func (h *federationHandler) GetIdentities(rw http.ResponseWriter, r *http.Request) {
+	jwtPayload, _ := util.JWTPayloadFromContext(r.Context())
+
+	federatedIdentities, err := h.federationService.GetIdentities(jwtPayload.UserID)
+	if err != nil {
+		dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: "Internal Server Error"})
+		return
+	}
+
+	dto.WriteResponse(rw, http.StatusOK, federatedIdentities)
+}
+
+//	DeleteIdentity handles DELETE/{identityId} requests and unlinks one of the caller's identities
+func (h *federationHandler) DeleteIdentity(rw http.ResponseWriter, r *http.Request) {
+	jwtPayload, _ := util.JWTPayloadFromContext(r.Context())
+	if rejectPersonalAccessToken(rw, jwtPayload) {
+		return
+	}
+
+	identityID, err := strconv.ParseUint(mux.Vars(r)["identityId"], 10, 64)
+	if err != nil {
+		dto.WriteResponse(rw, http.StatusNotFound, dto.ServiceError{Message: "The specified resource does not exist"})
+		return
+	}
+
+	if err := h.federationService.UnlinkIdentity(jwtPayload.UserID, uint(identityID)); err != nil {
+		writeFederationError(rw, err)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func writeFederationError(rw http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrUnknownFederatedProvider), errors.Is(err, entity.ErrFederatedIdentityNotFound):
+		dto.WriteResponse(rw, http.StatusNotFound, dto.ServiceError{Message: "The specified resource does not exist"})
+	case errors.Is(err, service.ErrInvalidFederatedState), errors.Is(err, util.ErrInvalidIDToken):
+		dto.WriteResponse(rw, http.StatusUnauthorized, dto.ServiceError{Message: service.ErrInvalidFederatedState.Error()})
+	case errors.Is(err, service.ErrFederatedEmailRequired), errors.Is(err, service.ErrEmailNotVerified):
+		dto.WriteResponse(rw, http.StatusForbidden, dto.ServiceError{Message: err.Error()})
+	case errors.Is(err, service.ErrFederatedEmailInUse), errors.Is(err, service.ErrFederatedIdentityInUse), errors.Is(err, service.ErrLastLoginMethod):
+		dto.WriteResponse(rw, http.StatusConflict, dto.ServiceError{Message: err.Error()})
+	case errors.Is(err, util.ErrUpstreamOIDC):
+		log.Printf("Federated login failed: %v\n", err)
+		dto.WriteResponse(rw, http.StatusBadGateway, dto.ServiceError{Message: "the identity provider could not be reached"})
+	default:
+		dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: "Internal Server Error"})
+	}
+}
@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"golang-api/dto"
+	"golang-api/service"
+	"net/http"
+)
+
+type LoginThrottleHandler interface {
+	UnlockUser(rw http.ResponseWriter, r *http.Request)
+}
+
+type loginThrottleHandler struct {
+	service service.LoginThrottleService
+}
+
+func NewLoginThrottleHandler(service service.LoginThrottleService) LoginThrottleHandler {
+	return &loginThrottleHandler{
+		service: service,
+	}
+}
+
+//	UnlockUser handles POST requests and clears the failed logins and any lockout of a user
+func (h *loginThrottleHandler) UnlockUser(rw http.ResponseWriter, r *http.Request) {
+	if err := h.service.UnlockUser(r.Context(), getUserID(r)); err != nil {
+		dto.WriteResponse(rw, http.StatusNotFound, dto.ServiceError{Message: "The specified resource does not exist"})
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
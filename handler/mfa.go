@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"golang-api/dto"
+	"golang-api/service"
+	"golang-api/util"
+	"net/http"
+)
+
+type MFAHandler interface {
+	EnrollTOTP(rw http.ResponseWriter, r *http.Request)
+	ConfirmTOTP(rw http.ResponseWriter, r *http.Request)
+	DisableTOTP(rw http.ResponseWriter, r *http.Request)
+	RegenerateRecoveryCodes(rw http.ResponseWriter, r *http.Request)
+}
+
+type mfaHandler struct {
+	service service.MFAService
+	config  util.Config
+}
+
+func NewMFAHandler(service service.MFAService, config util.Config) MFAHandler {
+	return &mfaHandler{
+		service: service,
+		config:  config,
+	}
+}
+
+//	EnrollTOTP handles POST requests and returns a new TOTP secret for the caller's authenticator app
+func (h *mfaHandler) EnrollTOTP(rw http.ResponseWriter, r *http.Request) {
+	jwtPayload, _ := util.JWTPayloadFromContext(r.Context())
+	if rejectPersonalAccessToken(rw, jwtPayload) {
+		return
+	}
+
+	enrollment, err := h.service.EnrollTOTP(jwtPayload.UserID)
+	if err != nil {
+		writeMFAError(rw, err)
+		return
+	}
+
+	dto.WriteResponse(rw, http.StatusCreated, enrollment)
+}
+
+//	ConfirmTOTP handles POST requests, enables the second factor and returns the recovery codes
+func (h *mfaHandler) ConfirmTOTP(rw http.ResponseWriter, r *http.Request) {
+	jwtPayload, _ := util.JWTPayloadFromContext(r.Context())
+	if rejectPersonalAccessToken(rw, jwtPayload) {
+		return
+	}
+
+	code, ok := decodeMFACode(rw, r)
+	if !ok {
+		return
+	}
+
+	recoveryCodes, err := h.service.ConfirmTOTP(r.Context(), jwtPayload.UserID, code, util.ClientIP(r, h.config.TrustProxyHeaders))
+	if err != nil {
+		writeMFAError(rw, err)
+		return
+	}
+
+	dto.WriteResponse(rw, http.StatusOK, recoveryCodes)
+}
+
+//	DisableTOTP handles DELETE requests and removes the second factor of the caller
+func (h *mfaHandler) DisableTOTP(rw http.ResponseWriter, r *http.Request) {
+	jwtPayload, _ := util.JWTPayloadFromContext(r.Context())
+	if rejectPersonalAccessToken(rw, jwtPayload) {
+		return
+	}
+
+	code, ok := decodeMFACode(rw, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DisableTOTP(r.Context(), jwtPayload.UserID, code, util.ClientIP(r, h.config.TrustProxyHeaders)); err != nil {
+		writeMFAError(rw, err)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+//	RegenerateRecoveryCodes handles POST requests and replaces the recovery codes of the caller
+func (h *mfaHandler) RegenerateRecoveryCodes(rw http.ResponseWriter, r *http.Request) {
+	jwtPayload, _ := util.JWTPayloadFromContext(r.Context())
+	if rejectPersonalAccessToken(rw, jwtPayload) {
+		return
+	}
+
+	code, ok := decodeMFACode(rw, r)
+	if !ok {
+		return
+	}
+
+	recoveryCodes, err := h.service.RegenerateRecoveryCodes(r.Context(), jwtPayload.UserID, code, util.ClientIP(r, h.config.TrustProxyHeaders))
+	if err != nil {
+		writeMFAError(rw, err)
+		return
+	}
+
+	dto.WriteResponse(rw, http.StatusOK, recoveryCodes)
+}
+
+func decodeMFACode(rw http.ResponseWriter, r *http.Request) (string, bool) {
+	var codeRequest dto.MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&codeRequest); err != nil {
+		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+		return "", false
+	}
+
+	if err := validate.Struct(&codeRequest); err != nil {
+		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+		return "", false
+	}
+	return codeRequest.Code, true
+}
+
+func writeMFAError(rw http.ResponseWriter, err error) {
+	var lockedErr *service.LoginLockedError
+	switch {
+	case errors.As(err, &lockedErr):
+		writeLoginError(rw, err)
+	case errors.Is(err, service.ErrMFAAlreadyEnabled), errors.Is(err, service.ErrMFANotEnabled), errors.Is(err, service.ErrMFANotEnrolled):
+		dto.WriteResponse(rw, http.StatusConflict, dto.ServiceError{Message: err.Error()})
+	case errors.Is(err, service.ErrInvalidMFACode):
+		dto.WriteResponse(rw, http.StatusUnauthorized, dto.ServiceError{Message: err.Error()})
+	default:
+		dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: "Internal Server Error"})
+	}
+}
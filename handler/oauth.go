@@ -0,0 +1,391 @@
+package handler
+
+import (
+	"errors"
+	"golang-api/dto"
+	"golang-api/entity"
+	"golang-api/service"
+	"golang-api/util"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+// authorizeParams are the parameters of an authorization request, carried along by the login form
+var authorizeParams = []string{"response_type", "client_id", "redirect_uri", "scope", "state", "code_challenge", "code_challenge_method", "nonce"}
+
+type OAuthHandler interface {
+	Authorize(rw http.ResponseWriter, r *http.Request)
+	SubmitAuthorization(rw http.ResponseWriter, r *http.Request)
+	Token(rw http.ResponseWriter, r *http.Request)
+	DeviceCode(rw http.ResponseWriter, r *http.Request)
+	Device(rw http.ResponseWriter, r *http.Request)
+	SubmitDevice(rw http.ResponseWriter, r *http.Request)
+	Introspect(rw http.ResponseWriter, r *http.Request)
+	Revoke(rw http.ResponseWriter, r *http.Request)
+}
+
+type oauthHandler struct {
+	oauthService         service.OAuthService
+	authService          service.AuthService
+	mfaService           service.MFAService
+	loginThrottleService service.LoginThrottleService
+	dpopService          service.DPoPService
+	config               util.Config
+}
+
+func NewOAuthHandler(oauthService service.OAuthService, authService service.AuthService, mfaService service.MFAService, loginThrottleService service.LoginThrottleService, dpopService service.DPoPService, config util.Config) OAuthHandler {
+	return &oauthHandler{
+		oauthService,
+		authService,
+		mfaService,
+		loginThrottleService,
+		dpopService,
+		config,
+	}
+}
+
+//	Authorize handles GET requests of the authorization code flow and shows the login and consent page.
+//	Invalid requests are sent back to the client's redirect URI, unless the redirect URI itself is invalid
+func (h *oauthHandler) Authorize(rw http.ResponseWriter, r *http.Request) {
+	params := authorizationParams(r.URL.Query())
+	authorization, ok := h.validateAuthorization(rw, r, params)
+	if !ok {
+		return
+	}
+
+	writeAuthorizePage(rw, http.StatusOK, newAuthorizePage(authorization, params))
+}
+
+//	SubmitAuthorization handles the form POST of the authorization page. The user logs in, with a second step
+//	if MFA is enabled, and is redirected to the client with an authorization code
+func (h *oauthHandler) SubmitAuthorization(rw http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeAuthorizePage(rw, http.StatusBadRequest, authorizeErrorPage(err.Error()))
+		return
+	}
+
+	params := authorizationParams(r.PostForm)
+	authorization, ok := h.validateAuthorization(rw, r, params)
+	if !ok {
+		return
+	}
+
+	if r.PostForm.Get("action") != "allow" {
+		redirectAuthorization(rw, r, authorization, url.Values{"error": {service.OAuthErrorAccessDenied}})
+		return
+	}
+
+	user, amr := h.authenticate(rw, r, newAuthorizePage(authorization, params))
+	if user == nil {
+		return
+	}
+
+	code, err := h.oauthService.CreateAuthorizationCode(r.Context(), authorization, *user, amr)
+	if err != nil {
+		writeAuthorizePage(rw, http.StatusInternalServerError, authorizeErrorPage("Internal Server Error"))
+		return
+	}
+	redirectAuthorization(rw, r, authorization, url.Values{"code": {code}})
+}
+
+// authenticate logs the user in from the posted form, in two steps if MFA is enabled, and returns the user
+// with the authentication methods used. Until the user is authenticated it writes the page again,
+// with the next step or the error, and returns nil
+func (h *oauthHandler) authenticate(rw http.ResponseWriter, r *http.Request, page authorizePage) (*entity.User, []string) {
+	if challengeToken := r.PostForm.Get("challenge_token"); challengeToken != "" {
+		user, amr, err := h.mfaService.VerifyChallenge(r.Context(), challengeToken, r.PostForm.Get("code"), util.ClientIP(r, h.config.TrustProxyHeaders))
+		var lockedErr *service.LoginLockedError
+		if errors.As(err, &lockedErr) {
+			page.Error = lockedErr.Error()
+			writeAuthorizePage(rw, http.StatusTooManyRequests, page)
+			return nil, nil
+		}
+		if errors.Is(err, service.ErrInvalidMFACode) {
+			page.ChallengeToken = challengeToken
+			page.Error = "Invalid authentication code"
+			writeAuthorizePage(rw, http.StatusUnauthorized, page)
+			return nil, nil
+		}
+		if err != nil {
+			page.Error = "The sign-in expired, please sign in again"
+			writeAuthorizePage(rw, http.StatusUnauthorized, page)
+			return nil, nil
+		}
+		return user, amr
+	}
+
+	user, status, message := h.login(r, r.PostForm.Get("email"), r.PostForm.Get("password"))
+	if user == nil {
+		page.Email = r.PostForm.Get("email")
+		page.Error = message
+		writeAuthorizePage(rw, status, page)
+		return nil, nil
+	}
+
+	if user.TOTPEnabled {
+		challenge, err := h.mfaService.CreateChallenge(r.Context(), *user, util.AMRPassword)
+		if err != nil {
+			writeAuthorizePage(rw, http.StatusInternalServerError, authorizeErrorPage("Internal Server Error"))
+			return nil, nil
+		}
+		page.ChallengeToken = challenge.ChallengeToken
+		writeAuthorizePage(rw, http.StatusOK, page)
+		return nil, nil
+	}
+
+	if err := h.loginThrottleService.RecordSuccess(r.Context(), user.Email); err != nil {
+		log.Printf("Failed to reset failed logins of %s: %v\n", user.Email, err)
+	}
+	return user, []string{util.AMRPassword}
+}
+
+// login checks the password with the same throttling as /auth/login, returning the user or the status and message to show
+func (h *oauthHandler) login(r *http.Request, email string, password string) (*entity.User, int, string) {
+	ip := util.ClientIP(r, h.config.TrustProxyHeaders)
+	err := h.loginThrottleService.Check(r.Context(), email, ip)
+	var lockedErr *service.LoginLockedError
+	if errors.As(err, &lockedErr) {
+		return nil, http.StatusTooManyRequests, lockedErr.Error()
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, "Internal Server Error"
+	}
+
+	user, err := h.authService.Login(email, password)
+	switch {
+	case errors.Is(err, service.ErrEmailNotVerified):
+		return nil, http.StatusForbidden, err.Error()
+	case errors.Is(err, service.ErrLDAPUnavailable):
+		return nil, http.StatusServiceUnavailable, "The directory is unavailable, please try again later"
+	case err != nil:
+		if err := h.loginThrottleService.RecordFailure(r.Context(), email, ip); err != nil {
+			log.Printf("Failed to record failed login of %s from %s: %v\n", email, ip, err)
+		}
+		return nil, http.StatusUnauthorized, "Invalid email or password"
+	}
+	return user, http.StatusOK, ""
+}
+
+// validateAuthorization writes the error response of an invalid authorization request and returns false
+func (h *oauthHandler) validateAuthorization(rw http.ResponseWriter, r *http.Request, params map[string]string) (*service.Authorization, bool) {
+	authorization, err := h.oauthService.ValidateAuthorization(dto.AuthorizeRequest{
+		ResponseType:        params["response_type"],
+		ClientID:            params["client_id"],
+		RedirectURI:         params["redirect_uri"],
+		Scope:               params["scope"],
+		State:               params["state"],
+		CodeChallenge:       params["code_challenge"],
+		CodeChallengeMethod: params["code_challenge_method"],
+		Nonce:               params["nonce"],
+	})
+	if err == nil {
+		return authorization, true
+	}
+
+	var oauthErr *service.OAuthError
+	switch {
+	case errors.Is(err, service.ErrInvalidRedirectURI):
+		writeAuthorizePage(rw, http.StatusBadRequest, authorizeErrorPage(err.Error()))
+	case errors.As(err, &oauthErr):
+		redirectAuthorization(rw, r, authorization, url.Values{"error": {oauthErr.Code}, "error_description": {oauthErr.Description}})
+	default:
+		writeAuthorizePage(rw, http.StatusInternalServerError, authorizeErrorPage("Internal Server Error"))
+	}
+	return nil, false
+}
+
+// redirectAuthorization sends the user back to the client with the result of the authorization request
+func redirectAuthorization(rw http.ResponseWriter, r *http.Request, authorization *service.Authorization, result url.Values) {
+	redirectURL, err := url.Parse(authorization.RedirectURI)
+	if err != nil {
+		writeAuthorizePage(rw, http.StatusInternalServerError, authorizeErrorPage("Internal Server Error"))
+		return
+	}
+
+	if authorization.State != "" {
+		result.Set("state", authorization.State)
+	}
+	query := redirectURL.Query()
+	for name, values := range result {
+		query[name] = values
+	}
+	redirectURL.RawQuery = query.Encode()
+
+	rw.Header().Set("Cache-Control", "no-store")
+	http.Redirect(rw, r, redirectURL.String(), http.StatusFound)
+}
+
+func authorizationParams(values url.Values) map[string]string {
+	params := make(map[string]string, len(authorizeParams))
+	for _, name := range authorizeParams {
+		if value := values.Get(name); value != "" {
+			params[name] = value
+		}
+	}
+	return params
+}
+
+func newAuthorizePage(authorization *service.Authorization, params map[string]string) authorizePage {
+	return authorizePage{
+		Heading:    "Sign in to " + authorization.Client.Name,
+		ClientName: authorization.Client.Name,
+		Scopes:     authorization.Scopes,
+		Form:       true,
+		Params:     params,
+	}
+}
+
+//	Token handles form encoded POST requests of OAuth clients and returns an access token for the requested grant.
+//	Clients authenticate with HTTP Basic or with client_id and client_secret in the form, not both.
+//	Along a DPoP proof the tokens are bound to its key and have the DPoP token type
+func (h *oauthHandler) Token(rw http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(rw, &service.OAuthError{Code: service.OAuthErrorInvalidRequest, Description: err.Error()})
+		return
+	}
+
+	clientID, clientSecret, err := clientCredentials(r)
+	if err != nil {
+		writeOAuthError(rw, err)
+		return
+	}
+
+	jkt, err := dpopThumbprint(r, h.dpopService, h.config)
+	if err != nil {
+		writeOAuthError(rw, dpopOAuthError(err))
+		return
+	}
+	sessionMetadata := h.sessionMetadata(r)
+	sessionMetadata.JKT = jkt
+
+	if r.PostForm.Get("grant_type") == entity.GrantTypeDeviceCode {
+		h.deviceToken(rw, r, clientID, clientSecret, sessionMetadata)
+		return
+	}
+
+	tokenRequest := dto.OAuthTokenRequest{
+		GrantType:    r.PostForm.Get("grant_type"),
+		Scope:        r.PostForm.Get("scope"),
+		Code:         r.PostForm.Get("code"),
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+		RefreshToken: r.PostForm.Get("refresh_token"),
+	}
+	if tokenRequest.GrantType == "" {
+		writeOAuthError(rw, &service.OAuthError{Code: service.OAuthErrorInvalidRequest, Description: "grant_type is required"})
+		return
+	}
+
+	tokenResponse, err := h.oauthService.Token(r.Context(), tokenRequest, clientID, clientSecret, sessionMetadata)
+	if err != nil {
+		writeOAuthError(rw, err)
+		return
+	}
+
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("Pragma", "no-cache")
+	dto.WriteResponse(rw, http.StatusOK, tokenResponse)
+}
+
+//	Introspect handles form encoded POST requests of confidential clients and tells whether the token is active.
+//	Both access and refresh tokens are recognized, token_type_hint is not needed
+func (h *oauthHandler) Introspect(rw http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(rw, &service.OAuthError{Code: service.OAuthErrorInvalidRequest, Description: err.Error()})
+		return
+	}
+
+	clientID, clientSecret, err := clientCredentials(r)
+	if err != nil {
+		writeOAuthError(rw, err)
+		return
+	}
+
+	introspection, err := h.oauthService.Introspect(r.Context(), r.PostForm.Get("token"), clientID, clientSecret)
+	if err != nil {
+		writeOAuthError(rw, err)
+		return
+	}
+
+	rw.Header().Set("Cache-Control", "no-store")
+	dto.WriteResponse(rw, http.StatusOK, introspection)
+}
+
+//	Revoke handles form encoded POST requests of clients and revokes an access or refresh token.
+//	It answers 200 for tokens that are already invalid, as the client has nothing more to do
+func (h *oauthHandler) Revoke(rw http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(rw, &service.OAuthError{Code: service.OAuthErrorInvalidRequest, Description: err.Error()})
+		return
+	}
+
+	clientID, clientSecret, err := clientCredentials(r)
+	if err != nil {
+		writeOAuthError(rw, err)
+		return
+	}
+
+	if err := h.oauthService.Revoke(r.Context(), r.PostForm.Get("token"), clientID, clientSecret); err != nil {
+		writeOAuthError(rw, err)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+}
+
+// sessionMetadata describes the client of the request, shown in the session list
+func (h *oauthHandler) sessionMetadata(r *http.Request) entity.SessionMetadata {
+	return entity.SessionMetadata{
+		UserAgent: r.UserAgent(),
+		IP:        util.ClientIP(r, h.config.TrustProxyHeaders),
+	}
+}
+
+// clientCredentials reads the client authentication of RFC 6749 section 2.3.1.
+// The Basic credentials are form encoded before being base64 encoded
+func clientCredentials(r *http.Request) (string, string, error) {
+	basicID, basicSecret, hasBasic := r.BasicAuth()
+	formID, formSecret := r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+
+	if hasBasic && formSecret != "" {
+		return "", "", &service.OAuthError{Code: service.OAuthErrorInvalidRequest, Description: "only one client authentication method may be used"}
+	}
+	if !hasBasic {
+		if formID == "" {
+			return "", "", &service.OAuthError{Code: service.OAuthErrorInvalidClient, Description: "client authentication is required"}
+		}
+		return formID, formSecret, nil
+	}
+
+	clientID, err := url.QueryUnescape(basicID)
+	if err != nil {
+		return "", "", &service.OAuthError{Code: service.OAuthErrorInvalidClient, Description: "malformed client credentials"}
+	}
+	clientSecret, err := url.QueryUnescape(basicSecret)
+	if err != nil {
+		return "", "", &service.OAuthError{Code: service.OAuthErrorInvalidClient, Description: "malformed client credentials"}
+	}
+	return clientID, clientSecret, nil
+}
+
+// writeOAuthError answers with the RFC 6749 error response. invalid_client is a 401 with a Basic challenge,
+// other OAuth errors are a 400 and unexpected errors a 500
+func writeOAuthError(rw http.ResponseWriter, err error) {
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("Pragma", "no-cache")
+
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		dto.WriteResponse(rw, http.StatusInternalServerError, dto.OAuthErrorResponse{Error: "server_error"})
+		return
+	}
+
+	errorResponse := dto.OAuthErrorResponse{Error: oauthErr.Code, ErrorDescription: oauthErr.Description}
+	if oauthErr.Code == service.OAuthErrorInvalidClient {
+		rw.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		dto.WriteResponse(rw, http.StatusUnauthorized, errorResponse)
+		return
+	}
+	dto.WriteResponse(rw, http.StatusBadRequest, errorResponse)
+}
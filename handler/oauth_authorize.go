@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+)
+
+// authorizePage is the data of the login and consent pages of /oauth/authorize and /oauth/device
+type authorizePage struct {
+	Heading    string
+	ClientName string
+	Scopes     []string
+	Message    string
+	Error      string
+	// Form shows the form, posting Params back along with the user's input
+	Form           bool
+	Params         map[string]string
+	AskUserCode    bool
+	UserCode       string
+	Email          string
+	ChallengeToken string
+}
+
+var authorizeTemplate = template.Must(template.New("authorize").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Heading}}</title>
+<style>
+body { font-family: sans-serif; max-width: 24rem; margin: 4rem auto; padding: 0 1rem; }
+label, input, button { display: block; width: 100%; margin-top: .5rem; box-sizing: border-box; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+<h1>{{.Heading}}</h1>
+{{if .ClientName}}
+<p>{{.ClientName}} requests access to:</p>
+<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>
+{{end}}
+{{if .Message}}<p>{{.Message}}</p>{{end}}
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+{{if .Form}}
+<form method="post">
+{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}
+{{if .AskUserCode}}
+<label for="user_code">Code shown on your device</label>
+<input id="user_code" name="user_code" value="{{.UserCode}}" autocomplete="off" required autofocus>
+<button type="submit" name="action" value="continue">Continue</button>
+{{else}}
+{{if .ChallengeToken}}
+<input type="hidden" name="challenge_token" value="{{.ChallengeToken}}">
+<label for="code">Authentication or recovery code</label>
+<input id="code" name="code" autocomplete="one-time-code" required autofocus>
+{{else}}
+<label for="email">Email</label>
+<input id="email" name="email" type="email" value="{{.Email}}" autocomplete="username" required autofocus>
+<label for="password">Password</label>
+<input id="password" name="password" type="password" autocomplete="current-password" required>
+{{end}}
+<button type="submit" name="action" value="allow">Allow</button>
+<button type="submit" name="action" value="deny" formnovalidate>Deny</button>
+{{end}}
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+// writeAuthorizePage renders the page. It must not be framed by another site, which could trick users into consenting
+func writeAuthorizePage(rw http.ResponseWriter, code int, page authorizePage) {
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("X-Frame-Options", "DENY")
+	rw.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	rw.WriteHeader(code)
+	if err := authorizeTemplate.Execute(rw, page); err != nil {
+		log.Printf("Failed to render the authorization page: %v\n", err)
+	}
+}
+
+func authorizeErrorPage(message string) authorizePage {
+	return authorizePage{Heading: "Authorization failed", Error: message}
+}
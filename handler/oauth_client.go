@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"golang-api/dto"
+	"golang-api/entity"
+	"golang-api/service"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type OAuthClientHandler interface {
+	GetOAuthClients(rw http.ResponseWriter, r *http.Request)
+	CreateOAuthClient(rw http.ResponseWriter, r *http.Request)
+	DeleteOAuthClient(rw http.ResponseWriter, r *http.Request)
+}
+
+type oauthClientHandler struct {
+	service service.OAuthClientService
+}
+
+func NewOAuthClientHandler(service service.OAuthClientService) OAuthClientHandler {
+	return &oauthClientHandler{
+		service: service,
+	}
+}
+
+//	GetOAuthClients handles GET requests and returns the registered OAuth clients, without their secret
+func (h *oauthClientHandler) GetOAuthClients(rw http.ResponseWriter, r *http.Request) {
+	clients, err := h.service.GetClients()
+	if err != nil {
+		dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: err.Error()})
+		return
+	}
+
+	dto.WriteResponse(rw, http.StatusOK, clients)
+}
+
+//	CreateOAuthClient handles POST requests and registers an OAuth client, returning its secret for the only time
+func (h *oauthClientHandler) CreateOAuthClient(rw http.ResponseWriter, r *http.Request) {
+	var createRequest dto.CreateOAuthClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&createRequest); err != nil {
+		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+		return
+	}
+
+	if err := validate.Struct(&createRequest); err != nil {
+		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+		return
+	}
+
+	client, err := h.service.CreateClient(createRequest)
+	if errors.Is(err, service.ErrUnsupportedGrantType) || errors.Is(err, service.ErrInvalidClientMetadata) {
+		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+		return
+	}
+	if err != nil {
+		dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: "Internal Server Error"})
+		return
+	}
+
+	dto.WriteResponse(rw, http.StatusCreated, client)
+}
+
+//	DeleteOAuthClient handles DELETE/{clientId} requests and removes an OAuth client. Its access tokens stay valid until they expire
+func (h *oauthClientHandler) DeleteOAuthClient(rw http.ResponseWriter, r *http.Request) {
+	err := h.service.DeleteClient(mux.Vars(r)["clientId"])
+	if errors.Is(err, entity.ErrOAuthClientNotFound) {
+		dto.WriteResponse(rw, http.StatusNotFound, dto.ServiceError{Message: err.Error()})
+		return
+	}
+	if err != nil {
+		dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: err.Error()})
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
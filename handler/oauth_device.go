@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"errors"
+	"golang-api/dto"
+	"golang-api/entity"
+	"golang-api/service"
+	"log"
+	"net/http"
+)
+
+//	DeviceCode handles form encoded POST requests of devices starting a login, see RFC 8628.
+//	The device shows the user code and verification URI to the user, then polls /oauth/token with the device code
+func (h *oauthHandler) DeviceCode(rw http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(rw, &service.OAuthError{Code: service.OAuthErrorInvalidRequest, Description: err.Error()})
+		return
+	}
+
+	clientID, clientSecret, err := clientCredentials(r)
+	if err != nil {
+		writeOAuthError(rw, err)
+		return
+	}
+
+	deviceAuthorization, err := h.oauthService.CreateDeviceAuthorization(r.Context(), clientID, clientSecret, r.PostForm.Get("scope"))
+	if err != nil {
+		writeOAuthError(rw, err)
+		return
+	}
+
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("Pragma", "no-cache")
+	dto.WriteResponse(rw, http.StatusOK, deviceAuthorization)
+}
+
+//	Device shows the page where users type the code shown on their device.
+//	The verification_uri_complete given to the device fills in the code
+func (h *oauthHandler) Device(rw http.ResponseWriter, r *http.Request) {
+	userCode := r.URL.Query().Get("user_code")
+	if userCode == "" {
+		writeAuthorizePage(rw, http.StatusOK, newUserCodePage("", ""))
+		return
+	}
+
+	request, ok := h.getDeviceAuthorization(rw, r, userCode)
+	if !ok {
+		return
+	}
+	writeAuthorizePage(rw, http.StatusOK, newDevicePage(request))
+}
+
+//	SubmitDevice handles the form POSTs of the device page. Once the code is found the user logs in,
+//	with a second step if MFA is enabled, and the device receives its tokens on its next poll
+func (h *oauthHandler) SubmitDevice(rw http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeAuthorizePage(rw, http.StatusBadRequest, authorizeErrorPage(err.Error()))
+		return
+	}
+
+	request, ok := h.getDeviceAuthorization(rw, r, r.PostForm.Get("user_code"))
+	if !ok {
+		return
+	}
+
+	switch r.PostForm.Get("action") {
+	case "allow":
+	case "deny":
+		if err := h.oauthService.ApproveDeviceAuthorization(r.Context(), request.UserCode, nil, nil); err != nil {
+			log.Printf("Failed to deny the device authorization: %v\n", err)
+			writeAuthorizePage(rw, http.StatusInternalServerError, authorizeErrorPage("Internal Server Error"))
+			return
+		}
+		writeAuthorizePage(rw, http.StatusOK, authorizePage{Heading: "Device denied", Message: "The device was not signed in."})
+		return
+	default:
+		writeAuthorizePage(rw, http.StatusOK, newDevicePage(request))
+		return
+	}
+
+	user, amr := h.authenticate(rw, r, newDevicePage(request))
+	if user == nil {
+		return
+	}
+
+	if err := h.oauthService.ApproveDeviceAuthorization(r.Context(), request.UserCode, user, amr); err != nil {
+		log.Printf("Failed to approve the device authorization: %v\n", err)
+		writeAuthorizePage(rw, http.StatusInternalServerError, authorizeErrorPage("Internal Server Error"))
+		return
+	}
+	writeAuthorizePage(rw, http.StatusOK, authorizePage{Heading: "Device approved", Message: "You are signed in on your device and can close this page."})
+}
+
+// getDeviceAuthorization finds the device authorization of the user code, or asks for the code again
+func (h *oauthHandler) getDeviceAuthorization(rw http.ResponseWriter, r *http.Request, userCode string) (*service.DeviceAuthorizationRequest, bool) {
+	request, err := h.oauthService.GetDeviceAuthorization(r.Context(), userCode)
+	if errors.Is(err, entity.ErrDeviceAuthorizationNotFound) {
+		writeAuthorizePage(rw, http.StatusBadRequest, newUserCodePage(userCode, "The code is invalid or expired"))
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Failed to get the device authorization: %v\n", err)
+		writeAuthorizePage(rw, http.StatusInternalServerError, authorizeErrorPage("Internal Server Error"))
+		return nil, false
+	}
+	return request, true
+}
+
+// deviceToken answers the polls of a device, with the same response as a login once the user approved
+func (h *oauthHandler) deviceToken(rw http.ResponseWriter, r *http.Request, clientID string, clientSecret string, sessionMetadata entity.SessionMetadata) {
+	tokenDetails, email, err := h.oauthService.DeviceToken(r.Context(), r.PostForm.Get("device_code"), clientID, clientSecret, sessionMetadata)
+	if err != nil {
+		writeOAuthError(rw, err)
+		return
+	}
+
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("Pragma", "no-cache")
+	dto.WriteResponse(rw, http.StatusOK, dto.LoginResponse{
+		AccessToken:           tokenDetails.AccessToken,
+		AccessTokenExpiresAt:  tokenDetails.AccessTokenExpiresAt,
+		RefreshToken:          tokenDetails.RefreshToken,
+		RefreshTokenExpiresAt: tokenDetails.RefreshTokenExpiresAt,
+		Email:                 email,
+		TokenType:             tokenDetails.TokenType,
+	})
+}
+
+func newUserCodePage(userCode string, message string) authorizePage {
+	return authorizePage{
+		Heading:     "Sign in on your device",
+		Error:       message,
+		Form:        true,
+		AskUserCode: true,
+		UserCode:    userCode,
+	}
+}
+
+func newDevicePage(request *service.DeviceAuthorizationRequest) authorizePage {
+	return authorizePage{
+		Heading:    "Sign in to " + request.Client.Name,
+		ClientName: request.Client.Name,
+		Scopes:     request.Scopes,
+		Message:    "Only continue if the code " + request.UserCode + " is shown on your device.",
+		Form:       true,
+		Params:     map[string]string{"user_code": request.UserCode},
+	}
+}
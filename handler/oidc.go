@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"errors"
+	"golang-api/dto"
+	"golang-api/service"
+	"golang-api/util"
+	"net/http"
+)
+
+type OIDCHandler interface {
+	UserInfo(rw http.ResponseWriter, r *http.Request)
+}
+
+type oidcHandler struct {
+	service service.OIDCService
+}
+
+func NewOIDCHandler(service service.OIDCService) OIDCHandler {
+	return &oidcHandler{
+		service: service,
+	}
+}
+
+//	UserInfo handles GET and POST requests with an access token granted the openid scope,
+//	and returns the claims of its user allowed by the granted scopes
+func (h *oidcHandler) UserInfo(rw http.ResponseWriter, r *http.Request) {
+	jwtPayload, _ := util.JWTPayloadFromContext(r.Context())
+
+	userInfo, err := h.service.UserInfo(jwtPayload.UserID, jwtPayload.Scopes)
+	if errors.Is(err, service.ErrInsufficientScope) {
+		rw.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+		dto.WriteResponse(rw, http.StatusForbidden, dto.ServiceError{Message: err.Error()})
+		return
+	}
+	if err != nil {
+		dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: "Internal Server Error"})
+		return
+	}
+
+	rw.Header().Set("Cache-Control", "no-store")
+	dto.WriteResponse(rw, http.StatusOK, userInfo)
+}
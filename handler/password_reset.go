@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"golang-api/dto"
+	"golang-api/entity"
+	"golang-api/service"
+	"net/http"
+)
+
+type PasswordResetHandler interface {
+	ForgotPassword(rw http.ResponseWriter, r *http.Request)
+	ResetPassword(rw http.ResponseWriter, r *http.Request)
+}
+
+type passwordResetHandler struct {
+	service service.PasswordResetService
+}
+
+func NewPasswordResetHandler(service service.PasswordResetService) PasswordResetHandler {
+	return &passwordResetHandler{
+		service: service,
+	}
+}
+
+//	ForgotPassword handles POST requests and mails a reset link if the email belongs to a user
+func (h *passwordResetHandler) ForgotPassword(rw http.ResponseWriter, r *http.Request) {
+	var forgotPasswordRequest dto.ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&forgotPasswordRequest); err != nil {
+		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+		return
+	}
+
+	if err := validate.Struct(&forgotPasswordRequest); err != nil {
+		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+		return
+	}
+
+	if err := h.service.ForgotPassword(r.Context(), forgotPasswordRequest.Email); err != nil {
+		dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: "Internal Server Error"})
+		return
+	}
+
+	// Same answer whether the email exists or not
+	rw.WriteHeader(http.StatusAccepted)
+}
+
+//	ResetPassword handles POST requests and sets a new password with a reset token
+func (h *passwordResetHandler) ResetPassword(rw http.ResponseWriter, r *http.Request) {
+	var resetPasswordRequest dto.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&resetPasswordRequest); err != nil {
+		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+		return
+	}
+
+	if err := validate.Struct(&resetPasswordRequest); err != nil {
+		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+		return
+	}
+
+	err := h.service.ResetPassword(r.Context(), resetPasswordRequest.Token, resetPasswordRequest.Password)
+	if errors.Is(err, entity.ErrOneTimeTokenNotFound) {
+		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+		return
+	}
+	if err != nil {
+		dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: "Internal Server Error"})
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
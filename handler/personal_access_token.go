@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"golang-api/dto"
+	"golang-api/entity"
+	"golang-api/service"
+	"golang-api/util"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type PersonalAccessTokenHandler interface {
+	GetPersonalAccessTokens(rw http.ResponseWriter, r *http.Request)
+	CreatePersonalAccessToken(rw http.ResponseWriter, r *http.Request)
+	DeletePersonalAccessToken(rw http.ResponseWriter, r *http.Request)
+}
+
+type personalAccessTokenHandler struct {
+	service service.PersonalAccessTokenService
+}
+
+func NewPersonalAccessTokenHandler(service service.PersonalAccessTokenService) PersonalAccessTokenHandler {
+	return &personalAccessTokenHandler{
+		service: service,
+	}
+}
+
+//	GetPersonalAccessTokens handles GET requests and returns the personal access tokens of the caller, without their secret
+func (h *personalAccessTokenHandler) GetPersonalAccessTokens(rw http.ResponseWriter, r *http.Request) {
+	jwtPayload, _ := util.JWTPayloadFromContext(r.Context())
+
+	personalAccessTokens, err := h.service.GetPersonalAccessTokens(jwtPayload.UserID)
+	if err != nil {
+		dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: err.Error()})
+		return
+	}
+
+	dto.WriteResponse(rw, http.StatusOK, personalAccessTokens)
+}
+
+//	CreatePersonalAccessToken handles POST requests and returns a new personal access token, the only time it is shown
+func (h *personalAccessTokenHandler) CreatePersonalAccessToken(rw http.ResponseWriter, r *http.Request) {
+	jwtPayload, _ := util.JWTPayloadFromContext(r.Context())
+
+	// A leaked token must not be able to mint more tokens
+	if rejectPersonalAccessToken(rw, jwtPayload) {
+		return
+	}
+
+	var createRequest dto.CreatePersonalAccessTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&createRequest); err != nil {
+		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+		return
+	}
+
+	if err := validate.Struct(&createRequest); err != nil {
+		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+		return
+	}
+
+	personalAccessToken, err := h.service.CreatePersonalAccessToken(jwtPayload.UserID, createRequest)
+	if errors.Is(err, service.ErrScopeNotGranted) || errors.Is(err, service.ErrInvalidTokenExpiry) {
+		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+		return
+	}
+	if err != nil {
+		dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: "Internal Server Error"})
+		return
+	}
+
+	dto.WriteResponse(rw, http.StatusCreated, personalAccessToken)
+}
+
+//	DeletePersonalAccessToken handles DELETE/{tokenId} requests and revokes one of the caller's personal access tokens
+func (h *personalAccessTokenHandler) DeletePersonalAccessToken(rw http.ResponseWriter, r *http.Request) {
+	jwtPayload, _ := util.JWTPayloadFromContext(r.Context())
+
+	tokenID, err := strconv.ParseUint(mux.Vars(r)["tokenId"], 10, 64)
+	if err != nil {
+		dto.WriteResponse(rw, http.StatusNotFound, dto.ServiceError{Message: "The specified resource does not exist"})
+		return
+	}
+
+	err = h.service.RevokePersonalAccessToken(jwtPayload.UserID, uint(tokenID))
+	if errors.Is(err, entity.ErrPersonalAccessTokenNotFound) {
+		dto.WriteResponse(rw, http.StatusNotFound, dto.ServiceError{Message: "The specified resource does not exist"})
+		return
+	}
+	if err != nil {
+		dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: "Internal Server Error"})
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// rejectPersonalAccessToken answers 403 to requests authenticated with a personal access token,
+// for endpoints that manage the credentials of the account itself
+func rejectPersonalAccessToken(rw http.ResponseWriter, jwtPayload *util.JWTPayload) bool {
+	if jwtPayload.PersonalAccessTokenID == 0 {
+		return false
+	}
+	dto.WriteResponse(rw, http.StatusForbidden, dto.ServiceError{Message: "this endpoint requires a login session, personal access tokens are not accepted"})
+	return true
+}
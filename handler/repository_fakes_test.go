@@ -0,0 +1,232 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"golang-api/entity"
+	"golang-api/util"
+	"sync"
+	"time"
+)
+
+// The fakes keep their state in memory. They embed the interface they fake, so a method a test
+// does not expect to be called panics instead of silently succeeding
+
+var errFakeNotFound = errors.New("record not found")
+
+type fakeUserRepository struct {
+	entity.UserRepository
+	users []entity.User
+}
+
+func (repository *fakeUserRepository) GetUserByEmail(email string) (*entity.User, error) {
+	for _, user := range repository.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return nil, errFakeNotFound
+}
+
+type fakeRoleRepository struct {
+	entity.RoleRepository
+}
+
+func (fakeRoleRepository) GetRoleByName(name string) (*entity.Role, error) {
+	for _, role := range entity.DefaultRoles() {
+		if role.Name == name {
+			return &role, nil
+		}
+	}
+	return nil, errFakeNotFound
+}
+
+type fakeOAuthClientRepository struct {
+	entity.OAuthClientRepository
+	clients []entity.OAuthClient
+}
+
+func (repository *fakeOAuthClientRepository) GetOAuthClientByClientID(clientID string) (*entity.OAuthClient, error) {
+	for _, client := range repository.clients {
+		if client.ClientID == clientID {
+			return &client, nil
+		}
+	}
+	return nil, entity.ErrOAuthClientNotFound
+}
+
+// fakeTokenRepository follows the redis repository: refresh tokens outlive the family they belong to,
+// which is the session, and are only valid while it exists
+type fakeTokenRepository struct {
+	mu            sync.Mutex
+	refreshTokens map[string]entity.RefreshToken
+	sessions      map[string]entity.Session
+	denylist      map[string]time.Time
+	revokedAt     map[string]time.Time
+}
+
+func newFakeTokenRepository() *fakeTokenRepository {
+	return &fakeTokenRepository{
+		refreshTokens: map[string]entity.RefreshToken{},
+		sessions:      map[string]entity.Session{},
+		denylist:      map[string]time.Time{},
+		revokedAt:     map[string]time.Time{},
+	}
+}
+
+func (repository *fakeTokenRepository) SetRefreshToken(ctx context.Context, refreshToken entity.RefreshToken, session entity.Session) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	refreshToken.Rotated = false
+	repository.refreshTokens[refreshToken.UserEmail+":"+refreshToken.ID] = refreshToken
+
+	key := refreshToken.UserEmail + ":" + refreshToken.FamilyID
+	if previous, ok := repository.sessions[key]; ok {
+		session.CreatedAt = previous.CreatedAt
+	} else {
+		session.CreatedAt = time.Now()
+	}
+	session.ID = refreshToken.FamilyID
+	session.UserEmail = refreshToken.UserEmail
+	session.LastRefreshedAt = time.Now()
+	session.ExpiresAt = refreshToken.ExpiresAt
+	session.ClientID = refreshToken.ClientID
+	repository.sessions[key] = session
+	return nil
+}
+
+func (repository *fakeTokenRepository) GetRefreshToken(ctx context.Context, userEmail string, tokenID string) (*entity.RefreshToken, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	refreshToken, ok := repository.refreshTokens[userEmail+":"+tokenID]
+	if !ok {
+		return nil, entity.ErrRefreshTokenNotFound
+	}
+	return &refreshToken, nil
+}
+
+func (repository *fakeTokenRepository) RotateRefreshToken(ctx context.Context, userEmail string, tokenID string) (*entity.RefreshToken, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	key := userEmail + ":" + tokenID
+	refreshToken, ok := repository.refreshTokens[key]
+	if !ok {
+		return nil, entity.ErrRefreshTokenNotFound
+	}
+	if _, ok := repository.sessions[userEmail+":"+refreshToken.FamilyID]; !ok {
+		return nil, entity.ErrRefreshTokenNotFound
+	}
+	if refreshToken.Rotated {
+		return &refreshToken, entity.ErrRefreshTokenReused
+	}
+	refreshToken.Rotated = true
+	repository.refreshTokens[key] = refreshToken
+	return &refreshToken, nil
+}
+
+func (repository *fakeTokenRepository) DeleteTokenFamily(ctx context.Context, userEmail string, familyID string) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	delete(repository.sessions, userEmail+":"+familyID)
+	return nil
+}
+
+func (repository *fakeTokenRepository) GetSession(ctx context.Context, userEmail string, sessionID string) (*entity.Session, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	session, ok := repository.sessions[userEmail+":"+sessionID]
+	if !ok {
+		return nil, entity.ErrSessionNotFound
+	}
+	return &session, nil
+}
+
+func (repository *fakeTokenRepository) GetSessions(ctx context.Context, userEmail string) ([]entity.Session, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	var sessions []entity.Session
+	for _, session := range repository.sessions {
+		if session.UserEmail == userEmail {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+func (repository *fakeTokenRepository) DeleteUserRefreshTokens(ctx context.Context, userEmail string) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	for key, session := range repository.sessions {
+		if session.UserEmail == userEmail {
+			delete(repository.sessions, key)
+		}
+	}
+	return nil
+}
+
+func (repository *fakeTokenRepository) DenylistAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	repository.denylist[tokenID] = expiresAt
+	return nil
+}
+
+func (repository *fakeTokenRepository) IsAccessTokenDenylisted(ctx context.Context, tokenID string) (bool, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	expiresAt, ok := repository.denylist[tokenID]
+	return ok && time.Now().Before(expiresAt), nil
+}
+
+func (repository *fakeTokenRepository) SetTokensRevokedAt(ctx context.Context, userEmail string, revokedAt time.Time, expiration time.Duration) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	repository.revokedAt[userEmail] = revokedAt
+	return nil
+}
+
+func (repository *fakeTokenRepository) GetTokensRevokedAt(ctx context.Context, userEmail string) (time.Time, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	return repository.revokedAt[userEmail], nil
+}
+
+// testKeyProvider signs and verifies with a single key
+type testKeyProvider struct {
+	signingKey *util.SigningKey
+}
+
+func (keys testKeyProvider) SigningKey() (*util.SigningKey, error) {
+	return keys.signingKey, nil
+}
+
+func (keys testKeyProvider) VerificationKey(kid string) (*util.SigningKey, error) {
+	if kid != keys.signingKey.ID {
+		return nil, util.ErrKeyNotFound
+	}
+	return keys.signingKey, nil
+}
+
+func (keys testKeyProvider) VerificationKeys() []*util.SigningKey {
+	return []*util.SigningKey{keys.signingKey}
+}
+
+type fakeDPoPProofRepository struct {
+	mu   sync.Mutex
+	used map[string]bool
+}
+
+func newFakeDPoPProofRepository() *fakeDPoPProofRepository {
+	return &fakeDPoPProofRepository{used: map[string]bool{}}
+}
+
+func (repository *fakeDPoPProofRepository) UseDPoPProof(ctx context.Context, jkt string, jti string, expiresAt time.Time) (bool, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	key := jkt + ":" + jti
+	if repository.used[key] {
+		return false, nil
+	}
+	repository.used[key] = true
+	return true, nil
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLoginInTheSecondOfARevokeWorks(t *testing.T) {
+	server := newTokenUseServer(t)
+	before := server.login(t)
+
+	// Stay clear of a second boundary, so the revocation and both logins share their iat
+	if time.Now().Nanosecond() > int(800*time.Millisecond) {
+		time.Sleep(time.Second - time.Duration(time.Now().Nanosecond()))
+	}
+	beforeRevoke := server.login(t)
+	if err := server.authService.Revoke(context.Background(), "alice@example.com"); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	after := server.login(t)
+
+	payload, err := server.tokenMaker.VerifyToken(after.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous, err := server.tokenMaker.VerifyToken(beforeRevoke.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !payload.IssuedAt.Equal(previous.IssuedAt) {
+		t.Skip("the logins crossed a second boundary")
+	}
+
+	if rw := server.callSecure(t, after.AccessToken); rw.Code != http.StatusOK {
+		t.Errorf("token issued right after the revocation: status %d, want 200: %s", rw.Code, rw.Body)
+	}
+	if rw := server.refresh(t, after.RefreshToken); rw.Code != http.StatusCreated {
+		t.Errorf("refresh token issued right after the revocation: status %d, want 201: %s", rw.Code, rw.Body)
+	}
+	for name, accessToken := range map[string]string{"earlier second": before.AccessToken, "same second": beforeRevoke.AccessToken} {
+		if rw := server.callSecure(t, accessToken); rw.Code != http.StatusUnauthorized {
+			t.Errorf("token issued before the revocation in the %s: status %d, want 401", name, rw.Code)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"golang-api/dto"
+	"golang-api/service"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type RoleHandler interface {
+	GetRoles(rw http.ResponseWriter, r *http.Request)
+	GetRole(rw http.ResponseWriter, r *http.Request)
+	CreateRole(rw http.ResponseWriter, r *http.Request)
+	UpdateRole(rw http.ResponseWriter, r *http.Request)
+	DeleteRole(rw http.ResponseWriter, r *http.Request)
+	AssignRole(rw http.ResponseWriter, r *http.Request)
+}
+
+type roleHandler struct {
+	service service.RoleService
+}
+
+func NewRoleHandler(service service.RoleService) RoleHandler {
+	return &roleHandler{
+		service: service,
+	}
+}
+
+//	GetRoles handles GET requests and returns all the roles from the data store
+func (h *roleHandler) GetRoles(rw http.ResponseWriter, r *http.Request) {
+	roles, err := h.service.GetRoles()
+	if err != nil {
+		dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: err.Error()})
+		return
+	}
+
+	dto.WriteResponse(rw, http.StatusOK, roles)
+}
+
+//	GetRole handles GET/{roleName} requests and returns a role from the data store
+func (h *roleHandler) GetRole(rw http.ResponseWriter, r *http.Request) {
+	role, err := h.service.GetRole(mux.Vars(r)["roleName"])
+	if err != nil {
+		dto.WriteResponse(rw, http.StatusNotFound, dto.ServiceError{Message: "The specified resource does not exist"})
+		return
+	}
+
+	dto.WriteResponse(rw, http.StatusOK, role)
+}
+
+//	CreateRole handles POST requests and creates a custom role into the data store
+func (h *roleHandler) CreateRole(rw http.ResponseWriter, r *http.Request) {
+	var createRoleRequest dto.CreateRoleRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&createRoleRequest); err != nil {
+		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+		return
+	}
+
+	if err := validate.Struct(&createRoleRequest); err != nil {
+		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+		return
+	}
+
+	role, err := h.service.CreateRole(createRoleRequest)
+	if err != nil {
+		dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: err.Error()})
+		return
+	}
+
+	dto.WriteResponse(rw, http.StatusCreated, role)
+}
+
+//	UpdateRole handles PATCH requests and updates the description or permissions of a custom role
+func (h *roleHandler) UpdateRole(rw http.ResponseWriter, r *http.Request) {
+	var updateRoleRequest dto.UpdateRoleRequest
+	updateRoleRequest.Name = mux.Vars(r)["roleName"]
+
+	if err := json.NewDecoder(r.Body).Decode(&updateRoleRequest); err != nil {
+		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+		return
+	}
+
+	if err := validate.Struct(&updateRoleRequest); err != nil {
+		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+		return
+	}
+
+	role, err := h.service.UpdateRole(updateRoleRequest)
+	if err != nil {
+		writeRoleError(rw, err)
+		return
+	}
+	dto.WriteResponse(rw, http.StatusOK, role)
+}
+
+//	DeleteRole handles DELETE requests and removes a custom role that is no longer assigned
+func (h *roleHandler) DeleteRole(rw http.ResponseWriter, r *http.Request) {
+	if err := h.service.DeleteRole(mux.Vars(r)["roleName"]); err != nil {
+		writeRoleError(rw, err)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+//	AssignRole handles PUT requests and sets the role of a user
+func (h *roleHandler) AssignRole(rw http.ResponseWriter, r *http.Request) {
+	var assignRoleRequest dto.AssignRoleRequest
+	assignRoleRequest.UserID = getUserID(r)
+
+	if err := json.NewDecoder(r.Body).Decode(&assignRoleRequest); err != nil {
+		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+		return
+	}
+
+	if err := validate.Struct(&assignRoleRequest); err != nil {
+		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+		return
+	}
+
+	user, err := h.service.AssignRole(assignRoleRequest)
+	if errors.Is(err, service.ErrLastAdmin) {
+		dto.WriteResponse(rw, http.StatusConflict, dto.ServiceError{Message: err.Error()})
+		return
+	}
+	if err != nil {
+		dto.WriteResponse(rw, http.StatusBadRequest, dto.ServiceError{Message: err.Error()})
+		return
+	}
+	dto.WriteResponse(rw, http.StatusOK, user)
+}
+
+func writeRoleError(rw http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrBuiltInRole), errors.Is(err, service.ErrRoleInUse):
+		dto.WriteResponse(rw, http.StatusConflict, dto.ServiceError{Message: err.Error()})
+	default:
+		dto.WriteResponse(rw, http.StatusNotFound, dto.ServiceError{Message: "The specified resource does not exist"})
+	}
+}
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"errors"
+	"golang-api/dto"
+	"golang-api/entity"
+	"golang-api/service"
+	"golang-api/util"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type SessionHandler interface {
+	GetSessions(rw http.ResponseWriter, r *http.Request)
+	DeleteSession(rw http.ResponseWriter, r *http.Request)
+	GetUserSessions(rw http.ResponseWriter, r *http.Request)
+	DeleteUserSession(rw http.ResponseWriter, r *http.Request)
+}
+
+type sessionHandler struct {
+	service service.SessionService
+}
+
+func NewSessionHandler(service service.SessionService) SessionHandler {
+	return &sessionHandler{
+		service: service,
+	}
+}
+
+//	GetSessions handles GET requests and returns the active sessions of the caller
+func (h *sessionHandler) GetSessions(rw http.ResponseWriter, r *http.Request) {
+	jwtPayload, _ := util.JWTPayloadFromContext(r.Context())
+
+	sessions, err := h.service.GetSessions(r.Context(), jwtPayload.UserEmail, jwtPayload.SessionID)
+	if err != nil {
+		dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: err.Error()})
+		return
+	}
+
+	dto.WriteResponse(rw, http.StatusOK, sessions)
+}
+
+//	DeleteSession handles DELETE/{sessionId} requests and terminates one of the caller's sessions
+func (h *sessionHandler) DeleteSession(rw http.ResponseWriter, r *http.Request) {
+	jwtPayload, _ := util.JWTPayloadFromContext(r.Context())
+
+	err := h.service.TerminateSession(r.Context(), jwtPayload.UserEmail, mux.Vars(r)["sessionId"])
+	if err != nil {
+		writeSessionError(rw, err)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+//	GetUserSessions handles GET requests and returns the active sessions of any user
+func (h *sessionHandler) GetUserSessions(rw http.ResponseWriter, r *http.Request) {
+	sessions, err := h.service.GetUserSessions(r.Context(), getUserID(r))
+	if err != nil {
+		dto.WriteResponse(rw, http.StatusNotFound, dto.ServiceError{Message: "The specified resource does not exist"})
+		return
+	}
+
+	dto.WriteResponse(rw, http.StatusOK, sessions)
+}
+
+//	DeleteUserSession handles DELETE/{sessionId} requests and terminates a session of any user
+func (h *sessionHandler) DeleteUserSession(rw http.ResponseWriter, r *http.Request) {
+	err := h.service.TerminateUserSession(r.Context(), getUserID(r), mux.Vars(r)["sessionId"])
+	if err != nil {
+		writeSessionError(rw, err)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func writeSessionError(rw http.ResponseWriter, err error) {
+	if errors.Is(err, entity.ErrSessionNotFound) {
+		dto.WriteResponse(rw, http.StatusNotFound, dto.ServiceError{Message: "The specified resource does not exist"})
+		return
+	}
+	dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: err.Error()})
+}
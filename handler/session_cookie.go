@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"golang-api/dto"
+	"golang-api/entity"
+	"golang-api/util"
+	"net/http"
+	"time"
+)
+
+// writeLoginResponse responds with the token pair of a new or refreshed session. In cookie mode the refresh token
+// is set in an HttpOnly cookie instead, along with a new CSRF token for the following requests
+func writeLoginResponse(rw http.ResponseWriter, config util.Config, tokenDetails *entity.TokenDetails, email string) {
+	loginResponse := dto.LoginResponse{
+		AccessToken:           tokenDetails.AccessToken,
+		AccessTokenExpiresAt:  tokenDetails.AccessTokenExpiresAt,
+		RefreshToken:          tokenDetails.RefreshToken,
+		RefreshTokenExpiresAt: tokenDetails.RefreshTokenExpiresAt,
+		Email:                 email,
+		TokenType:             tokenDetails.TokenType,
+	}
+
+	if config.SessionMode == util.SessionModeCookie {
+		csrfToken, err := util.GenerateRandomToken(32)
+		if err != nil {
+			dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: "Internal Server Error"})
+			return
+		}
+		http.SetCookie(rw, util.NewSessionCookie(config, util.RefreshTokenCookie, tokenDetails.RefreshToken, util.RefreshCookiePath, tokenDetails.RefreshTokenExpiresAt, true))
+		http.SetCookie(rw, util.NewSessionCookie(config, util.CSRFTokenCookie, csrfToken, "/", tokenDetails.RefreshTokenExpiresAt, false))
+		loginResponse.RefreshToken = ""
+		loginResponse.CSRFToken = csrfToken
+	}
+
+	dto.WriteResponse(rw, http.StatusCreated, loginResponse)
+}
+
+// clearSessionCookies deletes the cookies of the cookie session mode
+func clearSessionCookies(rw http.ResponseWriter, config util.Config) {
+	http.SetCookie(rw, util.NewSessionCookie(config, util.RefreshTokenCookie, "", util.RefreshCookiePath, time.Time{}, true))
+	http.SetCookie(rw, util.NewSessionCookie(config, util.CSRFTokenCookie, "", "/", time.Time{}, false))
+}
+
+// refreshTokenCookie returns the refresh token of the cookie session mode, if the request carries one
+func refreshTokenCookie(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(util.RefreshTokenCookie)
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
+	return cookie.Value, true
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"golang-api/dto"
+	"golang-api/service"
+	"net/http"
+)
+
+type SigningKeyHandler interface {
+	GetSigningKeys(rw http.ResponseWriter, r *http.Request)
+	RotateSigningKey(rw http.ResponseWriter, r *http.Request)
+}
+
+type signingKeyHandler struct {
+	service service.SigningKeyService
+}
+
+func NewSigningKeyHandler(service service.SigningKeyService) SigningKeyHandler {
+	return &signingKeyHandler{
+		service: service,
+	}
+}
+
+//	GetSigningKeys handles GET requests and returns the signing keys with their validity windows, never the key material
+func (h *signingKeyHandler) GetSigningKeys(rw http.ResponseWriter, r *http.Request) {
+	signingKeys, err := h.service.GetSigningKeys()
+	if err != nil {
+		dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: err.Error()})
+		return
+	}
+
+	dto.WriteResponse(rw, http.StatusOK, signingKeys)
+}
+
+//	RotateSigningKey handles POST requests and schedules a new signing key, retiring the current one
+func (h *signingKeyHandler) RotateSigningKey(rw http.ResponseWriter, r *http.Request) {
+	signingKey, err := h.service.RotateSigningKey()
+	if err != nil {
+		dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: err.Error()})
+		return
+	}
+
+	dto.WriteResponse(rw, http.StatusCreated, signingKey)
+}
@@ -0,0 +1,285 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"golang-api/dto"
+	"golang-api/entity"
+	"golang-api/middleware"
+	"golang-api/service"
+	"golang-api/util"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator"
+)
+
+const (
+	testClientID     = "resource-server"
+	testClientSecret = "resource-server-secret"
+)
+
+// tokenUseServer serves the endpoints a token may be presented to, backed by in-memory repositories
+type tokenUseServer struct {
+	authHandler       AuthHandler
+	oauthHandler      OAuthHandler
+	secure            http.Handler
+	authService       service.AuthService
+	tokenMaker        util.TokenMaker
+	refreshTokenMaker util.TokenMaker
+	tokenRepository   *fakeTokenRepository
+}
+
+func newTokenUseServer(t *testing.T) *tokenUseServer {
+	t.Helper()
+	config := util.Config{
+		AccessTokenDuration:  time.Minute,
+		RefreshTokenDuration: 5 * time.Minute,
+		TokenAudience:        "golang-api",
+		OIDCIssuer:           "https://api.example.com",
+		RefreshTokenKey:      strings.Repeat("2a", 32),
+		// Untyped tokens are still accepted, a typed token must never pass for the other kind regardless
+		AcceptLegacyTokens: true,
+	}
+
+	signingKey, err := util.ParseSigningKey("test", util.AlgorithmHS256, []byte(strings.Repeat("k", 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := testKeyProvider{signingKey}
+	tokenMaker, err := util.NewTokenMaker(config, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshTokenMaker, err := util.NewRefreshTokenMaker(config, tokenMaker)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userRepository := &fakeUserRepository{users: []entity.User{{ID: 1, Email: "alice@example.com", Role: entity.RoleMember}}}
+	tokenRepository := newFakeTokenRepository()
+	oauthClientRepository := &fakeOAuthClientRepository{clients: []entity.OAuthClient{{
+		ClientID:   testClientID,
+		SecretHash: util.HashToken(testClientSecret),
+	}}}
+
+	authService := service.NewAuthService(userRepository, fakeRoleRepository{}, tokenRepository, nil, tokenMaker, refreshTokenMaker, nil, config)
+	oauthService := service.NewOAuthService(service.NewOAuthClientService(oauthClientRepository), authService, nil, nil, tokenRepository, nil, nil, tokenMaker, refreshTokenMaker, keys, config)
+	dpopService := service.NewDPoPService(newFakeDPoPProofRepository(), config)
+	jwtMiddleware := middleware.NewJwtMiddleware(authService, nil, dpopService, config)
+	// The handlers share the validator NewUserHandler sets up
+	validate = validator.New()
+
+	return &tokenUseServer{
+		authHandler:  NewAuthHandler(authService, nil, nil, dpopService, tokenMaker, refreshTokenMaker, config),
+		oauthHandler: NewOAuthHandler(oauthService, authService, nil, nil, nil, config),
+		secure: jwtMiddleware.AuthorizeJWT()(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			rw.WriteHeader(http.StatusOK)
+		})),
+		authService:       authService,
+		tokenMaker:        tokenMaker,
+		refreshTokenMaker: refreshTokenMaker,
+		tokenRepository:   tokenRepository,
+	}
+}
+
+// login starts a session, as /auth/login does once the password is checked
+func (server *tokenUseServer) login(t *testing.T) *entity.TokenDetails {
+	t.Helper()
+	tokenDetails, err := server.authService.CreateTokens(context.Background(), "alice@example.com", "", entity.SessionMetadata{AMR: []string{util.AMRPassword}})
+	if err != nil {
+		t.Fatalf("CreateTokens: %v", err)
+	}
+	return tokenDetails
+}
+
+// expiredAccessToken is the access token of the session a client sends along its refresh token once it expired
+func (server *tokenUseServer) expiredAccessToken(t *testing.T, sessionID string) string {
+	t.Helper()
+	subject := util.TokenSubject{UserID: 1, Email: "alice@example.com", Role: entity.RoleMember, SessionID: sessionID}
+	token, _, err := server.tokenMaker.CreateToken(subject, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// refresh posts the refresh token along an expired access token of its session
+func (server *tokenUseServer) refresh(t *testing.T, refreshToken string) *httptest.ResponseRecorder {
+	t.Helper()
+	var sessionID string
+	if refreshPayload, err := server.refreshTokenMaker.VerifyToken(refreshToken); err == nil {
+		sessionID = refreshPayload.SessionID
+	}
+	return server.refreshWith(t, server.expiredAccessToken(t, sessionID), refreshToken)
+}
+
+func (server *tokenUseServer) refreshWith(t *testing.T, accessToken string, refreshToken string) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(dto.TokenRequest{AccessToken: accessToken, RefreshToken: refreshToken})
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/auth/refresh", bytes.NewReader(body))
+	rw := httptest.NewRecorder()
+	server.authHandler.Refresh(rw, r)
+	return rw
+}
+
+func (server *tokenUseServer) callSecure(t *testing.T, accessToken string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/secure/users", nil)
+	r.Header.Set("Authorization", "Bearer "+accessToken)
+	rw := httptest.NewRecorder()
+	server.secure.ServeHTTP(rw, r)
+	return rw
+}
+
+func (server *tokenUseServer) introspect(t *testing.T, token string) dto.IntrospectionResponse {
+	t.Helper()
+	rw := httptest.NewRecorder()
+	server.oauthHandler.Introspect(rw, clientRequest("/api/v1/oauth/introspect", token))
+	if rw.Code != http.StatusOK {
+		t.Fatalf("introspect: status %d: %s", rw.Code, rw.Body)
+	}
+	var introspection dto.IntrospectionResponse
+	if err := json.NewDecoder(rw.Body).Decode(&introspection); err != nil {
+		t.Fatal(err)
+	}
+	return introspection
+}
+
+func (server *tokenUseServer) revoke(t *testing.T, token string) {
+	t.Helper()
+	rw := httptest.NewRecorder()
+	server.oauthHandler.Revoke(rw, clientRequest("/api/v1/oauth/revoke", token))
+	if rw.Code != http.StatusOK {
+		t.Fatalf("revoke: status %d: %s", rw.Code, rw.Body)
+	}
+}
+
+// clientRequest is a form encoded POST of the token, authenticated as the confidential test client
+func clientRequest(target string, token string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(url.Values{"token": {token}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth(testClientID, testClientSecret)
+	return r
+}
+
+func TestRefreshRejectsAccessToken(t *testing.T) {
+	server := newTokenUseServer(t)
+	tokens := server.login(t)
+
+	if rw := server.refresh(t, tokens.AccessToken); rw.Code != http.StatusUnauthorized {
+		t.Errorf("refresh with an access token: status %d, want 401", rw.Code)
+	}
+	// Rejected by its type already, before any refresh token state is looked up
+	if _, err := server.refreshTokenMaker.VerifyToken(tokens.AccessToken); err != util.ErrInvalidToken {
+		t.Errorf("access token verified as a refresh token: err = %v, want ErrInvalidToken", err)
+	}
+	if _, err := server.tokenMaker.VerifyToken(tokens.RefreshToken); err != util.ErrInvalidToken {
+		t.Errorf("refresh token verified as an access token: err = %v, want ErrInvalidToken", err)
+	}
+	if rw := server.refresh(t, tokens.RefreshToken); rw.Code != http.StatusCreated {
+		t.Errorf("refresh with the refresh token: status %d, want 201: %s", rw.Code, rw.Body)
+	}
+}
+
+func TestSecureRejectsRefreshToken(t *testing.T) {
+	server := newTokenUseServer(t)
+	tokens := server.login(t)
+
+	if rw := server.callSecure(t, tokens.RefreshToken); rw.Code != http.StatusUnauthorized {
+		t.Errorf("refresh token as Bearer: status %d, want 401", rw.Code)
+	}
+	if rw := server.callSecure(t, tokens.AccessToken); rw.Code != http.StatusOK {
+		t.Errorf("access token as Bearer: status %d, want 200: %s", rw.Code, rw.Body)
+	}
+}
+
+func TestIntrospectTellsTokenUse(t *testing.T) {
+	server := newTokenUseServer(t)
+	tokens := server.login(t)
+
+	refreshIntrospection := server.introspect(t, tokens.RefreshToken)
+	if !refreshIntrospection.Active || refreshIntrospection.TokenUse != util.TokenUseRefresh {
+		t.Errorf("refresh token introspected as %+v, want an active %s", refreshIntrospection, util.TokenUseRefresh)
+	}
+	accessIntrospection := server.introspect(t, tokens.AccessToken)
+	if !accessIntrospection.Active || accessIntrospection.TokenUse != util.TokenUseAccess {
+		t.Errorf("access token introspected as %+v, want an active %s", accessIntrospection, util.TokenUseAccess)
+	}
+	if refreshIntrospection.JTI == accessIntrospection.JTI {
+		t.Errorf("both tokens introspected with jti %s", refreshIntrospection.JTI)
+	}
+}
+
+func TestRevokeRefreshTokenEndsSession(t *testing.T) {
+	server := newTokenUseServer(t)
+	tokens := server.login(t)
+
+	server.revoke(t, tokens.RefreshToken)
+
+	if introspection := server.introspect(t, tokens.RefreshToken); introspection.Active {
+		t.Errorf("revoked refresh token introspected as active")
+	}
+	if rw := server.refresh(t, tokens.RefreshToken); rw.Code != http.StatusUnauthorized {
+		t.Errorf("refresh with the revoked refresh token: status %d, want 401", rw.Code)
+	}
+	// The last access token of the session goes along with it
+	if rw := server.callSecure(t, tokens.AccessToken); rw.Code != http.StatusUnauthorized {
+		t.Errorf("access token of the revoked session: status %d, want 401", rw.Code)
+	}
+}
+
+func TestRevokeAccessTokenKeepsSession(t *testing.T) {
+	server := newTokenUseServer(t)
+	tokens := server.login(t)
+
+	server.revoke(t, tokens.AccessToken)
+
+	if rw := server.callSecure(t, tokens.AccessToken); rw.Code != http.StatusUnauthorized {
+		t.Errorf("revoked access token: status %d, want 401", rw.Code)
+	}
+	if introspection := server.introspect(t, tokens.RefreshToken); !introspection.Active {
+		t.Errorf("refresh token introspected as inactive after revoking the access token")
+	}
+	if rw := server.refresh(t, tokens.RefreshToken); rw.Code != http.StatusCreated {
+		t.Errorf("refresh after revoking the access token: status %d, want 201: %s", rw.Code, rw.Body)
+	}
+}
+
+func TestRefreshRejectsAccessTokenOfAnotherSession(t *testing.T) {
+	server := newTokenUseServer(t)
+	tokens := server.login(t)
+	other := server.login(t)
+
+	if rw := server.refreshWith(t, server.expiredAccessToken(t, other.SessionUuid.String()), tokens.RefreshToken); rw.Code != http.StatusUnauthorized {
+		t.Errorf("refresh along an access token of another session: status %d, want 401", rw.Code)
+	}
+	if rw := server.refreshWith(t, server.expiredAccessToken(t, tokens.SessionUuid.String()), tokens.RefreshToken); rw.Code != http.StatusCreated {
+		t.Errorf("refresh along an access token of the session: status %d, want 201: %s", rw.Code, rw.Body)
+	}
+}
+
+func TestRefreshRejectsOAuthClientToken(t *testing.T) {
+	server := newTokenUseServer(t)
+	tokens, err := server.authService.CreateTokens(context.Background(), "alice@example.com", "", entity.SessionMetadata{
+		ClientID: testClientID,
+		Scopes:   []string{"openid"},
+		AMR:      []string{util.AMRPassword},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rw := server.refresh(t, tokens.RefreshToken); rw.Code != http.StatusUnauthorized {
+		t.Errorf("refresh token of an OAuth client at /auth/refresh: status %d, want 401", rw.Code)
+	}
+	// The session is left alone, the client still refreshes it at /oauth/token
+	if introspection := server.introspect(t, tokens.RefreshToken); !introspection.Active {
+		t.Errorf("refresh token of the OAuth client introspected as inactive")
+	}
+}
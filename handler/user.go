@@ -2,8 +2,10 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"golang-api/dto"
 	"golang-api/service"
+	"golang-api/util"
 	"net/http"
 	"strconv"
 
@@ -23,12 +25,14 @@ type UserHandler interface {
 
 type userHandler struct {
 	service service.UserService
+	config  util.Config
 }
 
-func NewUserHandler(service service.UserService) UserHandler {
+func NewUserHandler(service service.UserService, config util.Config) UserHandler {
 	validate = validator.New()
 	return &userHandler{
 		service: service,
+		config:  config,
 	}
 }
 
@@ -56,7 +60,8 @@ func (u *userHandler) GetUser(rw http.ResponseWriter, r *http.Request) {
 	dto.WriteResponse(rw, http.StatusOK, user)
 }
 
-//	DeleteUser handles DELETE requests and removes users from the database
+//	DeleteUser handles DELETE requests and removes users from the database. Users whose role outranks
+//	the caller and the last admin cannot be deleted
 func (u *userHandler) DeleteUser(rw http.ResponseWriter, r *http.Request) {
 	userId := getUserID(r)
 	if _, err := u.service.GetUserByID(userId); err != nil {
@@ -64,14 +69,25 @@ func (u *userHandler) DeleteUser(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := u.service.DeleteUser(userId); err != nil {
+	jwtPayload, _ := util.JWTPayloadFromContext(r.Context())
+	err := u.service.DeleteUser(userId, jwtPayload.Permissions)
+	if errors.Is(err, service.ErrRoleOutranked) {
+		dto.WriteResponse(rw, http.StatusForbidden, dto.ServiceError{Message: err.Error()})
+		return
+	}
+	if errors.Is(err, service.ErrLastAdmin) {
+		dto.WriteResponse(rw, http.StatusConflict, dto.ServiceError{Message: err.Error()})
+		return
+	}
+	if err != nil {
 		dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: err.Error()})
 		return
 	}
 	rw.WriteHeader(http.StatusNoContent)
 }
 
-//	UpdateUser handles PATCH requests and update the given fields of a user into the data store
+//	UpdateUser handles PATCH requests and update the given fields of a user into the data store.
+//	Changing the email or password needs a recent login of the caller
 func (u *userHandler) UpdateUser(rw http.ResponseWriter, r *http.Request) {
 	var updateUserRequest dto.UpdateUserRequest
 	userId := getUserID(r)
@@ -87,7 +103,24 @@ func (u *userHandler) UpdateUser(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	jwtPayload, _ := util.JWTPayloadFromContext(r.Context())
+	updateUserRequest.CallerPermissions = jwtPayload.Permissions
+	if updateUserRequest.Email != "" || updateUserRequest.Password != "" {
+		if !jwtPayload.AuthenticatedWithin(u.config.StepUpMaxAge) {
+			dto.WriteStepUpChallenge(rw, u.config.StepUpMaxAge)
+			return
+		}
+	}
+
 	user, err := u.service.UpdateUser(updateUserRequest)
+	if errors.Is(err, service.ErrEmailInUse) {
+		dto.WriteResponse(rw, http.StatusConflict, dto.ServiceError{Message: err.Error()})
+		return
+	}
+	if errors.Is(err, service.ErrRoleOutranked) {
+		dto.WriteResponse(rw, http.StatusForbidden, dto.ServiceError{Message: err.Error()})
+		return
+	}
 	if err != nil {
 		dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: err.Error()})
 		return
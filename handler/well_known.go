@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"golang-api/dto"
+	"golang-api/entity"
+	"golang-api/service"
+	"golang-api/util"
+	"net/http"
+)
+
+type WellKnownHandler interface {
+	JWKS(rw http.ResponseWriter, r *http.Request)
+	OpenIDConfiguration(rw http.ResponseWriter, r *http.Request)
+}
+
+type wellKnownHandler struct {
+	keys   util.KeyProvider
+	config util.Config
+}
+
+func NewWellKnownHandler(keys util.KeyProvider, config util.Config) WellKnownHandler {
+	return &wellKnownHandler{
+		keys:   keys,
+		config: config,
+	}
+}
+
+// JWKS publishes the public keys trusted to verify tokens, so other services can validate them without a shared secret
+func (handler *wellKnownHandler) JWKS(rw http.ResponseWriter, r *http.Request) {
+	jwkSet, err := util.NewJWKSet(handler.keys.VerificationKeys())
+	if err != nil {
+		dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: "Internal Server Error"})
+		return
+	}
+
+	rw.Header().Set("Cache-Control", "public, max-age=300")
+	dto.WriteResponse(rw, http.StatusOK, jwkSet)
+}
+
+// OpenIDConfiguration publishes the OpenID Connect discovery document, from which clients learn every endpoint
+func (handler *wellKnownHandler) OpenIDConfiguration(rw http.ResponseWriter, r *http.Request) {
+	issuer := handler.config.OIDCIssuer
+
+	// ID tokens are signed like access tokens, by any of the published keys.
+	// Discovery requires RS256 in the list whatever the keys, so it is never empty, even with a symmetric key ring
+	algorithms := []string{util.AlgorithmRS256}
+	seen := map[string]bool{util.AlgorithmRS256: true}
+	for _, signingKey := range handler.keys.VerificationKeys() {
+		if signingKey.IsSymmetric() || seen[signingKey.Method.Alg()] {
+			continue
+		}
+		seen[signingKey.Method.Alg()] = true
+		algorithms = append(algorithms, signingKey.Method.Alg())
+	}
+
+	rw.Header().Set("Cache-Control", "public, max-age=300")
+	dto.WriteResponse(rw, http.StatusOK, dto.OpenIDConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/api/v1/oauth/authorize",
+		TokenEndpoint:                     issuer + "/api/v1/oauth/token",
+		UserinfoEndpoint:                  issuer + "/api/v1/oauth/userinfo",
+		IntrospectionEndpoint:             issuer + "/api/v1/oauth/introspect",
+		RevocationEndpoint:                issuer + "/api/v1/oauth/revoke",
+		DeviceAuthorizationEndpoint:       issuer + "/api/v1/oauth/device/code",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		ScopesSupported:                   []string{service.ScopeOpenID, service.ScopeProfile, service.ScopeEmail},
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{entity.GrantTypeAuthorizationCode, entity.GrantTypeRefreshToken, entity.GrantTypeClientCredentials, entity.GrantTypeDeviceCode},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  algorithms,
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "name", "given_name", "family_name", "email", "email_verified"},
+		DPoPSigningAlgValuesSupported:     util.DPoPSigningAlgorithms(),
+	})
+}
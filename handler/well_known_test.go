@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"encoding/json"
+	"golang-api/dto"
+	"golang-api/util"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiscoveryAlwaysListsRS256(t *testing.T) {
+	hmacKey, err := util.ParseSigningKey("hmac", util.AlgorithmHS256, []byte(strings.Repeat("k", 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyMaterial, err := util.GenerateKeyMaterial(util.AlgorithmES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaKey, err := util.ParseSigningKey("", util.AlgorithmES256, keyMaterial)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		signingKey *util.SigningKey
+		want       []string
+	}{
+		{"symmetric key ring", hmacKey, []string{util.AlgorithmRS256}},
+		{"ES256 key ring", ecdsaKey, []string{util.AlgorithmRS256, util.AlgorithmES256}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := NewWellKnownHandler(testKeyProvider{test.signingKey}, util.Config{OIDCIssuer: "https://api.example.com"})
+			rw := httptest.NewRecorder()
+			handler.OpenIDConfiguration(rw, httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil))
+
+			var configuration dto.OpenIDConfiguration
+			if err := json.NewDecoder(rw.Body).Decode(&configuration); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(configuration.IDTokenSigningAlgValuesSupported, test.want) {
+				t.Errorf("id_token_signing_alg_values_supported = %v, want %v", configuration.IDTokenSigningAlgValuesSupported, test.want)
+			}
+		})
+	}
+}
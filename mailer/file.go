@@ -0,0 +1,32 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type fileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer returns a mailer that writes every email as an .eml file to the outbox directory, for local development
+func NewFileMailer(dir string, from string) (Mailer, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &fileMailer{
+		dir:  dir,
+		from: from,
+	}, nil
+}
+
+func (mailer *fileMailer) Send(ctx context.Context, message Message) error {
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), uuid.New().String())
+	return os.WriteFile(filepath.Join(mailer.dir, name), formatMessage(mailer.from, message), 0o600)
+}
@@ -0,0 +1,20 @@
+package mailer
+
+import (
+	"context"
+	"log"
+)
+
+type logMailer struct {
+	from string
+}
+
+// NewLogMailer returns a mailer that only prints emails to the log, for local development
+func NewLogMailer(from string) Mailer {
+	return &logMailer{from}
+}
+
+func (mailer *logMailer) Send(ctx context.Context, message Message) error {
+	log.Printf("Mail from %s to %s: %s\n%s\n", mailer.from, message.To, message.Subject, message.Body)
+	return nil
+}
@@ -0,0 +1,40 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"golang-api/util"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails to users
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// Mailer implementations, selected with MAILER
+const (
+	MailerSMTP = "smtp"
+	MailerFile = "file"
+	MailerLog  = "log"
+)
+
+// NewMailer returns the mailer selected by the configuration, the log mailer by default
+func NewMailer(config util.Config) (Mailer, error) {
+	switch config.Mailer {
+	case MailerSMTP:
+		return NewSMTPMailer(config.SMTPHost, config.SMTPPort, config.SMTPUsername, config.SMTPPassword, config.MailFrom), nil
+	case MailerFile:
+		return NewFileMailer(config.MailOutboxDir, config.MailFrom)
+	case MailerLog, "":
+		return NewLogMailer(config.MailFrom), nil
+	default:
+		return nil, fmt.Errorf("unsupported mailer %s", config.Mailer)
+	}
+}
@@ -0,0 +1,30 @@
+package mailer
+
+import (
+	"context"
+	"net"
+	"net/smtp"
+)
+
+type smtpMailer struct {
+	address string
+	auth    smtp.Auth
+	from    string
+}
+
+// NewSMTPMailer returns a mailer that relays through an SMTP server, authenticating when a username is given
+func NewSMTPMailer(host string, port string, username string, password string, from string) Mailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &smtpMailer{
+		address: net.JoinHostPort(host, port),
+		auth:    auth,
+		from:    from,
+	}
+}
+
+func (mailer *smtpMailer) Send(ctx context.Context, message Message) error {
+	return smtp.SendMail(mailer.address, mailer.auth, mailer.from, []string{message.To}, formatMessage(mailer.from, message))
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"golang-api/database"
+	"golang-api/entity"
 	"golang-api/handler"
+	"golang-api/mailer"
 	"golang-api/middleware"
 	"golang-api/repository"
 	"golang-api/service"
@@ -35,30 +38,156 @@ func startHTTPServer(config util.Config) {
 		os.Exit(1)
 	}
 
+	signingKey, err := util.LoadSigningKey(config)
+	if err != nil {
+		log.Printf("Error loading signing key: %s\n", err)
+		os.Exit(1)
+	}
+
+	passwordHashers, err := util.NewPasswordHasherRegistry(config)
+	if err != nil {
+		log.Printf("Error configuring password hashing: %s\n", err)
+		os.Exit(1)
+	}
+
 	userRepository := repository.NewUserRepository(db)
-	tokenRepository := repository.NewRedisCache(config.RedisHost, config.RedisPort, 0)
-	userService := service.NewUserService(userRepository)
-	authService := service.NewAuthService(userRepository, tokenRepository, config)
-	jwtMiddleware := middleware.NewJwtMiddleware(config)
-	userHandler := handler.NewUserHandler(userService)
-	authHandler := handler.NewAuthHandler(authService, config)
+	roleRepository := repository.NewRoleRepository(db)
+	securityEventRepository := repository.NewSecurityEventRepository(db)
+	signingKeyRepository := repository.NewSigningKeyRepository(db)
+	recoveryCodeRepository := repository.NewRecoveryCodeRepository(db)
+	personalAccessTokenRepository := repository.NewPersonalAccessTokenRepository(db)
+	oauthClientRepository := repository.NewOAuthClientRepository(db)
+	federatedIdentityRepository := repository.NewFederatedIdentityRepository(db)
+	keys, err := service.NewSigningKeyService(signingKeyRepository, signingKey, config)
+	if err != nil {
+		log.Printf("Error loading signing keys: %s\n", err)
+		os.Exit(1)
+	}
+	mailSender, err := mailer.NewMailer(config)
+	if err != nil {
+		log.Printf("Error creating mailer: %s\n", err)
+		os.Exit(1)
+	}
+	tokenMaker, err := util.NewTokenMaker(config, keys)
+	if err != nil {
+		log.Printf("Error configuring the token format: %s\n", err)
+		os.Exit(1)
+	}
+	refreshTokenMaker, err := util.NewRefreshTokenMaker(config, tokenMaker)
+	if err != nil {
+		log.Printf("Error configuring the refresh tokens: %s\n", err)
+		os.Exit(1)
+	}
+	redisClient := repository.NewRedisClient(config.RedisHost, config.RedisPort, 0)
+	tokenRepository := repository.NewRedisTokenRepository(redisClient)
+	oneTimeTokenRepository := repository.NewRedisOneTimeTokenRepository(redisClient)
+	loginAttemptRepository := repository.NewRedisLoginAttemptRepository(redisClient)
+	deviceAuthorizationRepository := repository.NewRedisDeviceAuthorizationRepository(redisClient)
+	dpopProofRepository := repository.NewRedisDPoPProofRepository(redisClient)
+	roleService := service.NewRoleService(roleRepository, userRepository)
+	sessionService := service.NewSessionService(userRepository, tokenRepository, config)
+	authenticator, err := service.NewAuthenticator(userRepository, roleRepository, passwordHashers, config)
+	if err != nil {
+		log.Printf("Error configuring authenticators: %s\n", err)
+		os.Exit(1)
+	}
+	authService := service.NewAuthService(userRepository, roleRepository, tokenRepository, securityEventRepository, tokenMaker, refreshTokenMaker, authenticator, config)
+	loginThrottleService := service.NewLoginThrottleService(loginAttemptRepository, userRepository, securityEventRepository, config)
+	mfaService := service.NewMFAService(userRepository, recoveryCodeRepository, oneTimeTokenRepository, securityEventRepository, loginThrottleService, config)
+	emailVerificationService := service.NewEmailVerificationService(userRepository, oneTimeTokenRepository, securityEventRepository, authService, mailSender, config)
+	userService := service.NewUserService(userRepository, roleRepository, emailVerificationService, passwordHashers)
+	passwordResetService := service.NewPasswordResetService(userRepository, oneTimeTokenRepository, securityEventRepository, authService, passwordHashers, mailSender, config)
+	personalAccessTokenService := service.NewPersonalAccessTokenService(personalAccessTokenRepository, userRepository, roleRepository)
+	oauthClientService := service.NewOAuthClientService(oauthClientRepository)
+	oidcService := service.NewOIDCService(userService, keys, config)
+	oauthService := service.NewOAuthService(oauthClientService, authService, oidcService, personalAccessTokenService, tokenRepository, oneTimeTokenRepository, deviceAuthorizationRepository, tokenMaker, refreshTokenMaker, keys, config)
+	federationService := service.NewFederationService(userRepository, federatedIdentityRepository, oneTimeTokenRepository, securityEventRepository, config)
+	dpopService := service.NewDPoPService(dpopProofRepository, config)
+	jwtMiddleware := middleware.NewJwtMiddleware(authService, personalAccessTokenService, dpopService, config)
+	userHandler := handler.NewUserHandler(userService, config)
+	roleHandler := handler.NewRoleHandler(roleService)
+	sessionHandler := handler.NewSessionHandler(sessionService)
+	authHandler := handler.NewAuthHandler(authService, mfaService, loginThrottleService, dpopService, tokenMaker, refreshTokenMaker, config)
+	mfaHandler := handler.NewMFAHandler(mfaService, config)
+	passwordResetHandler := handler.NewPasswordResetHandler(passwordResetService)
+	emailVerificationHandler := handler.NewEmailVerificationHandler(emailVerificationService)
+	loginThrottleHandler := handler.NewLoginThrottleHandler(loginThrottleService)
+	personalAccessTokenHandler := handler.NewPersonalAccessTokenHandler(personalAccessTokenService)
+	oauthHandler := handler.NewOAuthHandler(oauthService, authService, mfaService, loginThrottleService, dpopService, config)
+	oauthClientHandler := handler.NewOAuthClientHandler(oauthClientService)
+	oidcHandler := handler.NewOIDCHandler(oidcService)
+	wellKnownHandler := handler.NewWellKnownHandler(keys, config)
+	signingKeyHandler := handler.NewSigningKeyHandler(keys)
+	federationHandler := handler.NewFederationHandler(federationService, authService, mfaService, config)
+
+	publishMetrics(userService)
 
 	router := mux.NewRouter()
 	base := router.PathPrefix("/api/v1").Subrouter()
 
 	secure := base.NewRoute().PathPrefix("/secure").Subrouter()
 	secure.Use(jwtMiddleware.AuthorizeJWT())
-	secure.HandleFunc("/users", userHandler.GetUsers).Methods(http.MethodGet)
-	secure.HandleFunc("/users", userHandler.CreateUser).Methods(http.MethodPost)
-	secure.HandleFunc("/users/{userId}", userHandler.DeleteUser).Methods(http.MethodDelete)
-	secure.HandleFunc("/users/{userId}", userHandler.GetUser).Methods(http.MethodGet)
-	secure.HandleFunc("/users/{userId}", userHandler.UpdateUser).Methods(http.MethodPatch)
+	secure.Handle("/users", requirePermission(entity.PermissionUsersRead, userHandler.GetUsers)).Methods(http.MethodGet)
+	secure.Handle("/users", requirePermission(entity.PermissionUsersCreate, userHandler.CreateUser)).Methods(http.MethodPost)
+	secure.Handle("/users/{userId}", requirePermission(entity.PermissionUsersDelete, requireRecentAuth(config.StepUpMaxAge, userHandler.DeleteUser))).Methods(http.MethodDelete)
+	secure.Handle("/users/{userId}", requirePermissionOrSelf(entity.PermissionUsersRead, entity.PermissionUsersReadSelf, userHandler.GetUser)).Methods(http.MethodGet)
+	secure.Handle("/users/{userId}", requirePermissionOrSelf(entity.PermissionUsersUpdate, entity.PermissionUsersUpdateSelf, userHandler.UpdateUser)).Methods(http.MethodPatch)
+	secure.Handle("/users/{userId}/sessions", requirePermission(entity.PermissionSessionsManage, sessionHandler.GetUserSessions)).Methods(http.MethodGet)
+	secure.Handle("/users/{userId}/sessions/{sessionId}", requirePermission(entity.PermissionSessionsManage, sessionHandler.DeleteUserSession)).Methods(http.MethodDelete)
+	secure.Handle("/users/{userId}/unlock", requirePermission(entity.PermissionUsersUnlock, loginThrottleHandler.UnlockUser)).Methods(http.MethodPost)
+	secure.Handle("/users/{userId}/role", requirePermission(entity.PermissionRolesWrite, roleHandler.AssignRole)).Methods(http.MethodPut)
+	secure.Handle("/roles", requirePermission(entity.PermissionRolesRead, roleHandler.GetRoles)).Methods(http.MethodGet)
+	secure.Handle("/roles", requirePermission(entity.PermissionRolesWrite, roleHandler.CreateRole)).Methods(http.MethodPost)
+	secure.Handle("/roles/{roleName}", requirePermission(entity.PermissionRolesRead, roleHandler.GetRole)).Methods(http.MethodGet)
+	secure.Handle("/roles/{roleName}", requirePermission(entity.PermissionRolesWrite, roleHandler.UpdateRole)).Methods(http.MethodPatch)
+	secure.Handle("/roles/{roleName}", requirePermission(entity.PermissionRolesWrite, roleHandler.DeleteRole)).Methods(http.MethodDelete)
+	secure.Handle("/keys", requirePermission(entity.PermissionKeysManage, signingKeyHandler.GetSigningKeys)).Methods(http.MethodGet)
+	secure.Handle("/metrics", requirePermission(entity.PermissionMetricsRead, expvar.Handler().ServeHTTP)).Methods(http.MethodGet)
+	secure.Handle("/keys/rotate", requirePermission(entity.PermissionKeysManage, signingKeyHandler.RotateSigningKey)).Methods(http.MethodPost)
+	secure.Handle("/clients", requirePermission(entity.PermissionClientsManage, oauthClientHandler.GetOAuthClients)).Methods(http.MethodGet)
+	secure.Handle("/clients", requirePermission(entity.PermissionClientsManage, oauthClientHandler.CreateOAuthClient)).Methods(http.MethodPost)
+	secure.Handle("/clients/{clientId}", requirePermission(entity.PermissionClientsManage, oauthClientHandler.DeleteOAuthClient)).Methods(http.MethodDelete)
 
 	auth := base.NewRoute().PathPrefix("/auth").Subrouter()
+	auth.Use(middleware.RequireCSRFToken())
 	auth.HandleFunc("/login", authHandler.Login).Methods(http.MethodPost)
+	auth.HandleFunc("/login/mfa", authHandler.LoginMFA).Methods(http.MethodPost)
 	auth.HandleFunc("/logout", authHandler.Logout).Methods(http.MethodDelete)
 	auth.HandleFunc("/revoke", authHandler.Revoke).Methods(http.MethodDelete)
 	auth.HandleFunc("/refresh", authHandler.Refresh).Methods(http.MethodPost)
+	auth.HandleFunc("/password/forgot", passwordResetHandler.ForgotPassword).Methods(http.MethodPost)
+	auth.HandleFunc("/password/reset", passwordResetHandler.ResetPassword).Methods(http.MethodPost)
+	auth.HandleFunc("/email/verify", emailVerificationHandler.VerifyEmail).Methods(http.MethodPost)
+	auth.HandleFunc("/email/verify/resend", emailVerificationHandler.ResendVerification).Methods(http.MethodPost)
+	auth.HandleFunc("/federated", federationHandler.GetProviders).Methods(http.MethodGet)
+	auth.HandleFunc("/federated/{provider}", federationHandler.Login).Methods(http.MethodGet)
+	auth.HandleFunc("/federated/{provider}/callback", federationHandler.Callback).Methods(http.MethodGet)
+	auth.Handle("/federated/{provider}/link", jwtMiddleware.AuthorizeUser()(http.HandlerFunc(federationHandler.Link))).Methods(http.MethodPost)
+	auth.Handle("/identities", jwtMiddleware.AuthorizeUser()(http.HandlerFunc(federationHandler.GetIdentities))).Methods(http.MethodGet)
+	auth.Handle("/identities/{identityId}", jwtMiddleware.AuthorizeUser()(http.HandlerFunc(federationHandler.DeleteIdentity))).Methods(http.MethodDelete)
+	auth.Handle("/sessions", jwtMiddleware.AuthorizeUser()(http.HandlerFunc(sessionHandler.GetSessions))).Methods(http.MethodGet)
+	auth.Handle("/sessions/{sessionId}", jwtMiddleware.AuthorizeUser()(http.HandlerFunc(sessionHandler.DeleteSession))).Methods(http.MethodDelete)
+	auth.Handle("/tokens", jwtMiddleware.AuthorizeUser()(http.HandlerFunc(personalAccessTokenHandler.GetPersonalAccessTokens))).Methods(http.MethodGet)
+	auth.Handle("/tokens", jwtMiddleware.AuthorizeUser()(http.HandlerFunc(personalAccessTokenHandler.CreatePersonalAccessToken))).Methods(http.MethodPost)
+	auth.Handle("/tokens/{tokenId}", jwtMiddleware.AuthorizeUser()(http.HandlerFunc(personalAccessTokenHandler.DeletePersonalAccessToken))).Methods(http.MethodDelete)
+	auth.Handle("/mfa/totp", jwtMiddleware.AuthorizeUser()(requireRecentAuth(config.StepUpMaxAge, mfaHandler.EnrollTOTP))).Methods(http.MethodPost)
+	auth.Handle("/mfa/totp", jwtMiddleware.AuthorizeUser()(requireRecentAuth(config.StepUpMaxAge, mfaHandler.DisableTOTP))).Methods(http.MethodDelete)
+	auth.Handle("/mfa/totp/confirm", jwtMiddleware.AuthorizeUser()(requireRecentAuth(config.StepUpMaxAge, mfaHandler.ConfirmTOTP))).Methods(http.MethodPost)
+	auth.Handle("/mfa/recovery-codes", jwtMiddleware.AuthorizeUser()(requireRecentAuth(config.StepUpMaxAge, mfaHandler.RegenerateRecoveryCodes))).Methods(http.MethodPost)
+
+	oauth := base.NewRoute().PathPrefix("/oauth").Subrouter()
+	oauth.HandleFunc("/authorize", oauthHandler.Authorize).Methods(http.MethodGet)
+	oauth.HandleFunc("/authorize", oauthHandler.SubmitAuthorization).Methods(http.MethodPost)
+	oauth.HandleFunc("/token", oauthHandler.Token).Methods(http.MethodPost)
+	oauth.HandleFunc("/device/code", oauthHandler.DeviceCode).Methods(http.MethodPost)
+	oauth.HandleFunc("/device", oauthHandler.Device).Methods(http.MethodGet)
+	oauth.HandleFunc("/device", oauthHandler.SubmitDevice).Methods(http.MethodPost)
+	oauth.HandleFunc("/introspect", oauthHandler.Introspect).Methods(http.MethodPost)
+	oauth.HandleFunc("/revoke", oauthHandler.Revoke).Methods(http.MethodPost)
+	oauth.Handle("/userinfo", jwtMiddleware.AuthorizeUser()(http.HandlerFunc(oidcHandler.UserInfo))).Methods(http.MethodGet, http.MethodPost)
+
+	router.HandleFunc("/.well-known/jwks.json", wellKnownHandler.JWKS).Methods(http.MethodGet)
+	router.HandleFunc("/.well-known/openid-configuration", wellKnownHandler.OpenIDConfiguration).Methods(http.MethodGet)
 
 	// Swagger
 	router.PathPrefix("/swagger/").Handler(http.StripPrefix("/swagger/", http.FileServer(http.Dir("./docs/swagger-ui-4.11.1"))))
@@ -103,3 +232,29 @@ func startHTTPServer(config util.Config) {
 	server.Shutdown(ctx)
 
 }
+
+// requirePermission guards a route with the given permission
+func requirePermission(permission string, handlerFunc http.HandlerFunc) http.Handler {
+	return middleware.RequirePermission(permission)(handlerFunc)
+}
+
+// requirePermissionOrSelf guards a {userId} route with permission, or selfPermission for the caller's own user
+func requirePermissionOrSelf(permission string, selfPermission string, handlerFunc http.HandlerFunc) http.Handler {
+	return middleware.RequirePermissionOrSelf(permission, selfPermission)(handlerFunc)
+}
+
+// requireRecentAuth guards a sensitive route with a login within maxAge
+func requireRecentAuth(maxAge time.Duration, handlerFunc http.HandlerFunc) http.HandlerFunc {
+	return middleware.RequireRecentAuth(maxAge)(handlerFunc).ServeHTTP
+}
+
+// publishMetrics exposes application metrics next to the expvar defaults, served at /secure/metrics
+func publishMetrics(userService service.UserService) {
+	expvar.Publish("legacy_password_hashes", expvar.Func(func() interface{} {
+		count, err := userService.CountLegacyPasswordHashes()
+		if err != nil {
+			return nil
+		}
+		return count
+	}))
+}
@@ -1,40 +1,108 @@
 package middleware
 
 import (
+	"errors"
 	"golang-api/dto"
+	"golang-api/service"
 	"golang-api/util"
 
 	"net/http"
 )
 
 type JwtMiddleware struct {
-	config util.Config
+	authService                service.AuthService
+	personalAccessTokenService service.PersonalAccessTokenService
+	dpopService                service.DPoPService
+	config                     util.Config
 }
 
-func NewJwtMiddleware(config util.Config) *JwtMiddleware {
-	return &JwtMiddleware{config}
+func NewJwtMiddleware(authService service.AuthService, personalAccessTokenService service.PersonalAccessTokenService, dpopService service.DPoPService, config util.Config) *JwtMiddleware {
+	return &JwtMiddleware{authService, personalAccessTokenService, dpopService, config}
 }
 
-// AuthorizeJWT validates the token from the http request, returning a 401 if it's not valid
+// AuthorizeJWT validates the token from the http request, returning a 401 if it's not valid or was revoked.
+// Personal access tokens are accepted as well, told apart by their prefix.
+// Tokens bound to a DPoP key must come with the DPoP scheme and a fresh proof signed with that key.
+// The token payload is stored in the request context for the handlers and guards down the chain
 func (middleware *JwtMiddleware) AuthorizeJWT() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
 			authorizationHeader := r.Header.Get("authorization")
 
-			accessToken, err := util.ValidateBearerHeader(authorizationHeader)
+			authorizationScheme, accessToken, err := util.ValidateAuthorizationHeader(authorizationHeader)
 
 			if err != nil {
 				dto.WriteResponse(rw, http.StatusUnauthorized, dto.ServiceError{Message: err.Error()})
 				return
 			}
 
-			_, err = util.VerifyToken(accessToken, middleware.config.JWTSecretKey)
+			var jwtPayload *util.JWTPayload
+			if service.IsPersonalAccessToken(accessToken) {
+				jwtPayload, err = middleware.personalAccessTokenService.VerifyPersonalAccessToken(accessToken)
+			} else {
+				jwtPayload, err = middleware.authService.VerifyAccessToken(r.Context(), accessToken)
+			}
 			if err != nil {
 				dto.WriteResponse(rw, http.StatusUnauthorized, dto.ServiceError{Message: err.Error()})
 				return
 			}
+			if !middleware.checkDPoP(rw, r, authorizationScheme, accessToken, jwtPayload) {
+				return
+			}
 
-			next.ServeHTTP(rw, r)
+			next.ServeHTTP(rw, r.WithContext(util.ContextWithJWTPayload(r.Context(), jwtPayload)))
 		})
 	}
 }
+
+// checkDPoP writes a 401 and returns false unless the scheme matches the binding of the token,
+// and a bound token comes with a proof for this request signed with its key
+func (middleware *JwtMiddleware) checkDPoP(rw http.ResponseWriter, r *http.Request, authorizationScheme string, accessToken string, jwtPayload *util.JWTPayload) bool {
+	jkt := jwtPayload.DPoPThumbprint()
+	if jkt == "" {
+		if authorizationScheme == util.AuthorizationSchemeDPoP {
+			writeDPoPError(rw, "invalid_token", "the token is not bound to a DPoP key, use the Bearer scheme")
+			return false
+		}
+		return true
+	}
+	if authorizationScheme != util.AuthorizationSchemeDPoP {
+		writeDPoPError(rw, "invalid_token", "the token is bound to a DPoP key, use the DPoP scheme")
+		return false
+	}
+
+	proof, err := util.DPoPProofHeader(r)
+	if err == nil {
+		err = middleware.dpopService.VerifyBoundProof(r.Context(), proof, r.Method, util.DPoPRequestURI(middleware.config.OIDCIssuer, r), accessToken, jkt)
+	}
+	if errors.Is(err, util.ErrInvalidDPoPProof) {
+		writeDPoPError(rw, "invalid_dpop_proof", err.Error())
+		return false
+	}
+	if err != nil {
+		dto.WriteResponse(rw, http.StatusInternalServerError, dto.ServiceError{Message: "Internal Server Error"})
+		return false
+	}
+	return true
+}
+
+func writeDPoPError(rw http.ResponseWriter, code string, message string) {
+	rw.Header().Set("WWW-Authenticate", util.DPoPChallenge(code))
+	dto.WriteResponse(rw, http.StatusUnauthorized, dto.ServiceError{Message: message})
+}
+
+// AuthorizeUser is AuthorizeJWT for endpoints acting on the caller's own account,
+// service principals have none and get a 403
+func (middleware *JwtMiddleware) AuthorizeUser() func(http.Handler) http.Handler {
+	authorizeJWT := middleware.AuthorizeJWT()
+	return func(next http.Handler) http.Handler {
+		return authorizeJWT(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			jwtPayload, _ := util.JWTPayloadFromContext(r.Context())
+			if jwtPayload.IsService() {
+				dto.WriteResponse(rw, http.StatusForbidden, dto.ServiceError{Message: "this endpoint requires a user, service tokens are not accepted"})
+				return
+			}
+			next.ServeHTTP(rw, r)
+		}))
+	}
+}
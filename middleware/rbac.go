@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"golang-api/dto"
+	"golang-api/entity"
+	"golang-api/util"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// RequirePermission allows the request only if the token grants the given permission, returning a 403 otherwise.
+// It must run after AuthorizeJWT
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			jwtPayload, ok := util.JWTPayloadFromContext(r.Context())
+			if !ok {
+				dto.WriteResponse(rw, http.StatusUnauthorized, dto.ServiceError{Message: "Unauthorized"})
+				return
+			}
+
+			if !entity.HasPermission(jwtPayload.Permissions, permission) {
+				dto.WriteResponse(rw, http.StatusForbidden, dto.ServiceError{Message: "Forbidden"})
+				return
+			}
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// RequirePermissionOrSelf allows the request if the token grants permission, or grants selfPermission
+// and the {userId} route variable is the caller's own user. It must run after AuthorizeJWT
+func RequirePermissionOrSelf(permission string, selfPermission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			jwtPayload, ok := util.JWTPayloadFromContext(r.Context())
+			if !ok {
+				dto.WriteResponse(rw, http.StatusUnauthorized, dto.ServiceError{Message: "Unauthorized"})
+				return
+			}
+
+			if entity.HasPermission(jwtPayload.Permissions, permission) {
+				next.ServeHTTP(rw, r)
+				return
+			}
+
+			userID, err := strconv.ParseUint(mux.Vars(r)["userId"], 10, 64)
+			if err == nil && uint(userID) == jwtPayload.UserID && entity.HasPermission(jwtPayload.Permissions, selfPermission) {
+				next.ServeHTTP(rw, r)
+				return
+			}
+
+			dto.WriteResponse(rw, http.StatusForbidden, dto.ServiceError{Message: "Forbidden"})
+		})
+	}
+}
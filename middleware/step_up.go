@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"golang-api/dto"
+	"golang-api/util"
+	"net/http"
+	"time"
+)
+
+// RequireRecentAuth allows the request only if the user authenticated within maxAge, answering with
+// an insufficient_user_authentication challenge otherwise. Refreshed tokens keep the auth_time of their login,
+// so only a new login satisfies it. It must run after AuthorizeJWT
+func RequireRecentAuth(maxAge time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			jwtPayload, ok := util.JWTPayloadFromContext(r.Context())
+			if !ok {
+				dto.WriteResponse(rw, http.StatusUnauthorized, dto.ServiceError{Message: "Unauthorized"})
+				return
+			}
+
+			if !jwtPayload.AuthenticatedWithin(maxAge) {
+				dto.WriteStepUpChallenge(rw, maxAge)
+				return
+			}
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
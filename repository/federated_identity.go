@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"errors"
+	"golang-api/entity"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type FederatedIdentityGorm struct {
+	ID        uint      `gorm:"primary_key;auto_increment"`
+	UserID    uint      `gorm:"index;not null"`
+	Provider  string    `gorm:"type:varchar(64);uniqueIndex:idx_federated_identities_provider_subject"`
+	Subject   string    `gorm:"type:varchar(256);uniqueIndex:idx_federated_identities_provider_subject"`
+	Email     string    `gorm:"type:varchar(256)"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+func (FederatedIdentityGorm) TableName() string {
+	return "federated_identities"
+}
+
+func (f FederatedIdentityGorm) ToEntity() (*entity.FederatedIdentity, error) {
+	return &entity.FederatedIdentity{
+		ID:        f.ID,
+		UserID:    f.UserID,
+		Provider:  f.Provider,
+		Subject:   f.Subject,
+		Email:     f.Email,
+		CreatedAt: f.CreatedAt,
+	}, nil
+}
+
+func NewFederatedIdentityGorm(f entity.FederatedIdentity) FederatedIdentityGorm {
+	return FederatedIdentityGorm{
+		ID:        f.ID,
+		UserID:    f.UserID,
+		Provider:  f.Provider,
+		Subject:   f.Subject,
+		Email:     f.Email,
+		CreatedAt: f.CreatedAt,
+	}
+}
+
+type federatedIdentityRepository struct {
+	DB *gorm.DB
+}
+
+func NewFederatedIdentityRepository(db *gorm.DB) entity.FederatedIdentityRepository {
+	return &federatedIdentityRepository{
+		DB: db,
+	}
+}
+
+func (federatedIdentityRepository *federatedIdentityRepository) CreateFederatedIdentity(federatedIdentity entity.FederatedIdentity) (*entity.FederatedIdentity, error) {
+	federatedIdentityGorm := NewFederatedIdentityGorm(federatedIdentity)
+	err := federatedIdentityRepository.DB.Create(&federatedIdentityGorm).Error
+	if err != nil {
+		return nil, err
+	}
+	return federatedIdentityGorm.ToEntity()
+}
+
+func (federatedIdentityRepository *federatedIdentityRepository) GetFederatedIdentity(provider string, subject string) (*entity.FederatedIdentity, error) {
+	federatedIdentityGorm := &FederatedIdentityGorm{}
+	err := federatedIdentityRepository.DB.First(&federatedIdentityGorm, "provider = ? AND subject = ?", provider, subject).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, entity.ErrFederatedIdentityNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return federatedIdentityGorm.ToEntity()
+}
+
+func (federatedIdentityRepository *federatedIdentityRepository) GetFederatedIdentities(userID uint) ([]entity.FederatedIdentity, error) {
+	var federatedIdentitiesGorm []FederatedIdentityGorm
+	var federatedIdentities []entity.FederatedIdentity
+	err := federatedIdentityRepository.DB.Where("user_id = ?", userID).Order("id").Find(&federatedIdentitiesGorm).Error
+
+	for _, federatedIdentityGorm := range federatedIdentitiesGorm {
+		federatedIdentity, err := federatedIdentityGorm.ToEntity()
+		if err != nil {
+			return nil, err
+		}
+		federatedIdentities = append(federatedIdentities, *federatedIdentity)
+	}
+	return federatedIdentities, err
+}
+
+func (federatedIdentityRepository *federatedIdentityRepository) DeleteFederatedIdentity(userID uint, ID uint) error {
+	result := federatedIdentityRepository.DB.Where("user_id = ?", userID).Delete(&FederatedIdentityGorm{}, ID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return entity.ErrFederatedIdentityNotFound
+	}
+	return nil
+}
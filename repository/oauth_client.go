@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"errors"
+	"golang-api/entity"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type OAuthClientGorm struct {
+	ID           uint      `gorm:"primary_key;auto_increment"`
+	ClientID     string    `gorm:"type:varchar(64);UNIQUE"`
+	SecretHash   string    `gorm:"type:varchar(64)"`
+	Name         string    `gorm:"type:varchar(128)"`
+	Scopes       string    `gorm:"type:text"`
+	GrantTypes   string    `gorm:"type:text"`
+	RedirectURIs string    `gorm:"type:text"` // space separated, redirect URIs may contain commas
+	Public       bool      `gorm:"default:false"`
+	CreatedAt    time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+func (OAuthClientGorm) TableName() string {
+	return "oauth_clients"
+}
+
+func (c OAuthClientGorm) ToEntity() (*entity.OAuthClient, error) {
+	return &entity.OAuthClient{
+		ID:           c.ID,
+		ClientID:     c.ClientID,
+		SecretHash:   c.SecretHash,
+		Name:         c.Name,
+		Scopes:       splitList(c.Scopes),
+		GrantTypes:   splitList(c.GrantTypes),
+		RedirectURIs: strings.Fields(c.RedirectURIs),
+		Public:       c.Public,
+		CreatedAt:    c.CreatedAt,
+	}, nil
+}
+
+func NewOAuthClientGorm(c entity.OAuthClient) OAuthClientGorm {
+	return OAuthClientGorm{
+		ID:           c.ID,
+		ClientID:     c.ClientID,
+		SecretHash:   c.SecretHash,
+		Name:         c.Name,
+		Scopes:       strings.Join(c.Scopes, ","),
+		GrantTypes:   strings.Join(c.GrantTypes, ","),
+		RedirectURIs: strings.Join(c.RedirectURIs, " "),
+		Public:       c.Public,
+		CreatedAt:    c.CreatedAt,
+	}
+}
+
+// splitList reads a comma separated column, empty meaning no element
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+type oauthClientRepository struct {
+	DB *gorm.DB
+}
+
+func NewOAuthClientRepository(db *gorm.DB) entity.OAuthClientRepository {
+	return &oauthClientRepository{
+		DB: db,
+	}
+}
+
+func (oauthClientRepository *oauthClientRepository) GetOAuthClientByClientID(clientID string) (*entity.OAuthClient, error) {
+	oauthClientGorm := &OAuthClientGorm{}
+	err := oauthClientRepository.DB.First(&oauthClientGorm, "client_id = ?", clientID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, entity.ErrOAuthClientNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return oauthClientGorm.ToEntity()
+}
+
+func (oauthClientRepository *oauthClientRepository) GetOAuthClients() ([]entity.OAuthClient, error) {
+	var oauthClientsGorm []OAuthClientGorm
+	var oauthClients []entity.OAuthClient
+	err := oauthClientRepository.DB.Order("id").Find(&oauthClientsGorm).Error
+
+	for _, oauthClientGorm := range oauthClientsGorm {
+		oauthClient, err := oauthClientGorm.ToEntity()
+		if err != nil {
+			return nil, err
+		}
+		oauthClients = append(oauthClients, *oauthClient)
+	}
+	return oauthClients, err
+}
+
+func (oauthClientRepository *oauthClientRepository) CreateOAuthClient(client entity.OAuthClient) (*entity.OAuthClient, error) {
+	oauthClientGorm := NewOAuthClientGorm(client)
+	err := oauthClientRepository.DB.Create(&oauthClientGorm).Error
+	if err != nil {
+		return nil, err
+	}
+	return oauthClientGorm.ToEntity()
+}
+
+func (oauthClientRepository *oauthClientRepository) DeleteOAuthClient(clientID string) error {
+	result := oauthClientRepository.DB.Where("client_id = ?", clientID).Delete(&OAuthClientGorm{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return entity.ErrOAuthClientNotFound
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"errors"
+	"golang-api/entity"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type PersonalAccessTokenGorm struct {
+	ID            uint   `gorm:"primary_key;auto_increment"`
+	UserID        uint   `gorm:"index;not null"`
+	Name          string `gorm:"type:varchar(128)"`
+	DisplayPrefix string `gorm:"type:varchar(32)"`
+	TokenHash     string `gorm:"type:varchar(64);UNIQUE"`
+	Scopes        string `gorm:"type:text"`
+	ExpiresAt     *time.Time
+	LastUsedAt    *time.Time
+	CreatedAt     time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+func (PersonalAccessTokenGorm) TableName() string {
+	return "personal_access_tokens"
+}
+
+func (t PersonalAccessTokenGorm) ToEntity() (*entity.PersonalAccessToken, error) {
+	var scopes []string
+	if t.Scopes != "" {
+		scopes = strings.Split(t.Scopes, ",")
+	}
+	return &entity.PersonalAccessToken{
+		ID:            t.ID,
+		UserID:        t.UserID,
+		Name:          t.Name,
+		DisplayPrefix: t.DisplayPrefix,
+		TokenHash:     t.TokenHash,
+		Scopes:        scopes,
+		ExpiresAt:     t.ExpiresAt,
+		LastUsedAt:    t.LastUsedAt,
+		CreatedAt:     t.CreatedAt,
+	}, nil
+}
+
+func NewPersonalAccessTokenGorm(t entity.PersonalAccessToken) PersonalAccessTokenGorm {
+	return PersonalAccessTokenGorm{
+		ID:            t.ID,
+		UserID:        t.UserID,
+		Name:          t.Name,
+		DisplayPrefix: t.DisplayPrefix,
+		TokenHash:     t.TokenHash,
+		Scopes:        strings.Join(t.Scopes, ","),
+		ExpiresAt:     t.ExpiresAt,
+		LastUsedAt:    t.LastUsedAt,
+		CreatedAt:     t.CreatedAt,
+	}
+}
+
+type personalAccessTokenRepository struct {
+	DB *gorm.DB
+}
+
+func NewPersonalAccessTokenRepository(db *gorm.DB) entity.PersonalAccessTokenRepository {
+	return &personalAccessTokenRepository{
+		DB: db,
+	}
+}
+
+func (personalAccessTokenRepository *personalAccessTokenRepository) CreatePersonalAccessToken(personalAccessToken entity.PersonalAccessToken) (*entity.PersonalAccessToken, error) {
+	personalAccessTokenGorm := NewPersonalAccessTokenGorm(personalAccessToken)
+	err := personalAccessTokenRepository.DB.Create(&personalAccessTokenGorm).Error
+	if err != nil {
+		return nil, err
+	}
+	return personalAccessTokenGorm.ToEntity()
+}
+
+func (personalAccessTokenRepository *personalAccessTokenRepository) GetPersonalAccessTokenByHash(tokenHash string) (*entity.PersonalAccessToken, error) {
+	personalAccessTokenGorm := &PersonalAccessTokenGorm{}
+	err := personalAccessTokenRepository.DB.First(&personalAccessTokenGorm, "token_hash = ?", tokenHash).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, entity.ErrPersonalAccessTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return personalAccessTokenGorm.ToEntity()
+}
+
+func (personalAccessTokenRepository *personalAccessTokenRepository) GetPersonalAccessTokens(userID uint) ([]entity.PersonalAccessToken, error) {
+	var personalAccessTokensGorm []PersonalAccessTokenGorm
+	var personalAccessTokens []entity.PersonalAccessToken
+	err := personalAccessTokenRepository.DB.Where("user_id = ?", userID).Order("id").Find(&personalAccessTokensGorm).Error
+
+	for _, personalAccessTokenGorm := range personalAccessTokensGorm {
+		personalAccessToken, err := personalAccessTokenGorm.ToEntity()
+		if err != nil {
+			return nil, err
+		}
+		personalAccessTokens = append(personalAccessTokens, *personalAccessToken)
+	}
+	return personalAccessTokens, err
+}
+
+func (personalAccessTokenRepository *personalAccessTokenRepository) DeletePersonalAccessToken(userID uint, ID uint) error {
+	result := personalAccessTokenRepository.DB.Where("user_id = ?", userID).Delete(&PersonalAccessTokenGorm{}, ID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return entity.ErrPersonalAccessTokenNotFound
+	}
+	return nil
+}
+
+func (personalAccessTokenRepository *personalAccessTokenRepository) UpdatePersonalAccessTokenLastUsed(ID uint, lastUsedAt time.Time) error {
+	return personalAccessTokenRepository.DB.Model(&PersonalAccessTokenGorm{}).Where("id = ?", ID).Update("last_used_at", lastUsedAt).Error
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"golang-api/entity"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type RecoveryCodeGorm struct {
+	ID        uint   `gorm:"primary_key;auto_increment"`
+	UserID    uint   `gorm:"index"`
+	CodeHash  string `gorm:"type:varchar(64)"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+func (RecoveryCodeGorm) TableName() string {
+	return "recovery_codes"
+}
+
+type recoveryCodeRepository struct {
+	DB *gorm.DB
+}
+
+func NewRecoveryCodeRepository(db *gorm.DB) entity.RecoveryCodeRepository {
+	return &recoveryCodeRepository{
+		DB: db,
+	}
+}
+
+func (recoveryCodeRepository *recoveryCodeRepository) ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	return recoveryCodeRepository.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCodeGorm{}).Error; err != nil {
+			return err
+		}
+
+		recoveryCodesGorm := make([]RecoveryCodeGorm, 0, len(codeHashes))
+		for _, codeHash := range codeHashes {
+			recoveryCodesGorm = append(recoveryCodesGorm, RecoveryCodeGorm{UserID: userID, CodeHash: codeHash})
+		}
+		return tx.Create(&recoveryCodesGorm).Error
+	})
+}
+
+func (recoveryCodeRepository *recoveryCodeRepository) UseRecoveryCode(userID uint, codeHash string) error {
+	// The used_at IS NULL condition makes concurrent uses of the same code race safely
+	result := recoveryCodeRepository.DB.Model(&RecoveryCodeGorm{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return entity.ErrRecoveryCodeInvalid
+	}
+	return nil
+}
+
+func (recoveryCodeRepository *recoveryCodeRepository) DeleteRecoveryCodes(userID uint) error {
+	return recoveryCodeRepository.DB.Where("user_id = ?", userID).Delete(&RecoveryCodeGorm{}).Error
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"golang-api/entity"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -15,53 +17,229 @@ type redisTokenRepository struct {
 	Client *redis.Client
 }
 
-func NewRedisCache(host string, port string, db int) entity.TokenRepository {
-	client := redis.NewClient(&redis.Options{
+// NewRedisClient returns a client shared by every redis backed repository
+func NewRedisClient(host string, port string, db int) *redis.Client {
+	return redis.NewClient(&redis.Options{
 		Addr:     fmt.Sprintf("%s:%s", host, port),
 		Password: "",
 		DB:       db,
 	})
+}
+
+func NewRedisTokenRepository(client *redis.Client) entity.TokenRepository {
 	return &redisTokenRepository{
 		Client: client,
 	}
 }
 
-func (redisRepository *redisTokenRepository) DeleteRefreshToken(ctx context.Context, userEmail string, tokenID string) error {
-	key := fmt.Sprintf("%s:%s", userEmail, tokenID)
+// refresh_token:{userEmail}:{tokenID} holds a hash with the family, parent, rotation counter
+// and a rotated flag that stays set until the token expires, so replays can be detected
+func refreshTokenKey(userEmail string, tokenID string) string {
+	return fmt.Sprintf("refresh_token:%s:%s", userEmail, tokenID)
+}
 
-	result := redisRepository.Client.Del(ctx, key)
+// token_family:{userEmail}:{familyID} exists while the family is alive, deleting it revokes every token in the family.
+// It also holds the session metadata shown to the user
+func tokenFamilyKey(userEmail string, familyID string) string {
+	return fmt.Sprintf("token_family:%s:%s", userEmail, familyID)
+}
 
-	if err := result.Err(); err != nil {
-		log.Printf("Could not delete refresh token to redis for userEmail/tokenID: %s/%s: %v\n", userEmail, tokenID, err)
-		return err
+// globEscaper escapes the glob metacharacters of SCAN MATCH patterns
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// scanPattern matches the keys starting with prefix. The prefix holds an email, whose glob metacharacters
+// are escaped so that a user named a*@example.com cannot list or delete the keys of every other user starting with a
+func scanPattern(prefix string) string {
+	return globEscaper.Replace(prefix) + "*"
+}
+
+// denylist:{tokenID} exists until the revoked access token would have expired anyway
+func denylistKey(tokenID string) string {
+	return fmt.Sprintf("denylist:%s", tokenID)
+}
+
+// tokens_revoked_at:{userEmail} holds the unix time in nanoseconds of the last "revoke all sessions"
+func tokensRevokedAtKey(userEmail string) string {
+	return fmt.Sprintf("tokens_revoked_at:%s", userEmail)
+}
+
+func (redisRepository *redisTokenRepository) SetRefreshToken(ctx context.Context, refreshToken entity.RefreshToken, session entity.Session) error {
+	tokenKey := refreshTokenKey(refreshToken.UserEmail, refreshToken.ID)
+	familyKey := tokenFamilyKey(refreshToken.UserEmail, refreshToken.FamilyID)
+	now := time.Now()
+
+	pipe := redisRepository.Client.TxPipeline()
+	pipe.HSet(ctx, tokenKey,
+		"family_id", refreshToken.FamilyID,
+		"parent_id", refreshToken.ParentID,
+		"rotation", refreshToken.Rotation,
+		"rotated", 0,
+		"expires_at", refreshToken.ExpiresAt.Unix(),
+		"client_id", refreshToken.ClientID,
+		"scopes", strings.Join(refreshToken.Scopes, " "),
+		"auth_time", refreshToken.AuthTime.Unix(),
+		"amr", strings.Join(refreshToken.AMR, " "),
+	)
+	pipe.ExpireAt(ctx, tokenKey, refreshToken.ExpiresAt)
+	pipe.HSetNX(ctx, familyKey, "created_at", now.Unix())
+	pipe.HSet(ctx, familyKey,
+		"token_id", refreshToken.ID,
+		"rotation", refreshToken.Rotation,
+		"last_refreshed_at", now.Unix(),
+		"expires_at", refreshToken.ExpiresAt.Unix(),
+		"user_agent", session.UserAgent,
+		"ip", session.IP,
+		"access_token_id", session.AccessTokenID,
+		"access_token_expires_at", session.AccessTokenExpiresAt.Unix(),
+		"client_id", refreshToken.ClientID,
+	)
+	pipe.ExpireAt(ctx, familyKey, refreshToken.ExpiresAt)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Could not SET refresh token to redis for userEmail/tokenID: %s/%s: %v\n", refreshToken.UserEmail, refreshToken.ID, err)
+		return errors.New("could not SET refresh token to redis for userEmail/tokenID")
 	}
+	return nil
+}
 
-	// Val returns count of deleted keys.
-	// If no key was deleted, the refresh token is invalid
-	if result.Val() < 1 {
-		log.Printf("Refresh token to redis for userEmail/tokenID: %s/%s does not exist\n", userEmail, tokenID)
-		return errors.New("invalid refresh token")
+func (redisRepository *redisTokenRepository) GetRefreshToken(ctx context.Context, userEmail string, tokenID string) (*entity.RefreshToken, error) {
+	values, err := redisRepository.Client.HGetAll(ctx, refreshTokenKey(userEmail, tokenID)).Result()
+	if err != nil {
+		log.Printf("Could not GET refresh token from redis for userEmail/tokenID: %s/%s: %v\n", userEmail, tokenID, err)
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, entity.ErrRefreshTokenNotFound
+	}
+
+	rotation, _ := strconv.Atoi(values["rotation"])
+	rotated, _ := strconv.Atoi(values["rotated"])
+
+	return &entity.RefreshToken{
+		ID:        tokenID,
+		UserEmail: userEmail,
+		FamilyID:  values["family_id"],
+		ParentID:  values["parent_id"],
+		Rotation:  rotation,
+		Rotated:   rotated > 0,
+		ExpiresAt: unixField(values, "expires_at"),
+		ClientID:  values["client_id"],
+		Scopes:    strings.Fields(values["scopes"]),
+		AuthTime:  unixField(values, "auth_time"),
+		AMR:       strings.Fields(values["amr"]),
+	}, nil
+}
+
+// RotateRefreshToken marks the token as used and returns it.
+// A token can be rotated only once, later attempts return the token along with ErrRefreshTokenReused
+func (redisRepository *redisTokenRepository) RotateRefreshToken(ctx context.Context, userEmail string, tokenID string) (*entity.RefreshToken, error) {
+	refreshToken, err := redisRepository.GetRefreshToken(ctx, userEmail, tokenID)
+	if err != nil {
+		return nil, err
 	}
 
+	// A missing family means it was revoked or logged out
+	exists, err := redisRepository.Client.Exists(ctx, tokenFamilyKey(userEmail, refreshToken.FamilyID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		return nil, entity.ErrRefreshTokenNotFound
+	}
+
+	// HINCRBY is atomic, so only the first of two concurrent rotations sees 1
+	rotated, err := redisRepository.Client.HIncrBy(ctx, refreshTokenKey(userEmail, tokenID), "rotated", 1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if rotated > 1 {
+		return refreshToken, entity.ErrRefreshTokenReused
+	}
+
+	return refreshToken, nil
+}
+
+func (redisRepository *redisTokenRepository) DeleteTokenFamily(ctx context.Context, userEmail string, familyID string) error {
+	if err := redisRepository.Client.Del(ctx, tokenFamilyKey(userEmail, familyID)).Err(); err != nil {
+		log.Printf("Could not delete token family from redis for userEmail/familyID: %s/%s: %v\n", userEmail, familyID, err)
+		return err
+	}
 	return nil
 }
 
-func (redisRepository *redisTokenRepository) DeleteUserRefreshTokens(ctx context.Context, userEmail string) error {
-	pattern := fmt.Sprintf("%s*", userEmail)
+func (redisRepository *redisTokenRepository) GetSession(ctx context.Context, userEmail string, sessionID string) (*entity.Session, error) {
+	values, err := redisRepository.Client.HGetAll(ctx, tokenFamilyKey(userEmail, sessionID)).Result()
+	if err != nil {
+		log.Printf("Could not GET session from redis for userEmail/sessionID: %s/%s: %v\n", userEmail, sessionID, err)
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, entity.ErrSessionNotFound
+	}
+	return newSession(userEmail, sessionID, values), nil
+}
 
-	iter := redisRepository.Client.Scan(ctx, 0, pattern, 5).Iterator()
-	failCount := 0
+func (redisRepository *redisTokenRepository) GetSessions(ctx context.Context, userEmail string) ([]entity.Session, error) {
+	var sessions []entity.Session
+	prefix := tokenFamilyKey(userEmail, "")
 
+	iter := redisRepository.Client.Scan(ctx, 0, scanPattern(prefix), 10).Iterator()
 	for iter.Next(ctx) {
-		if err := redisRepository.Client.Del(ctx, iter.Val()).Err(); err != nil {
-			log.Printf("Failed to delete refresh token: %s\n", iter.Val())
-			failCount++
+		sessionID := strings.TrimPrefix(iter.Val(), prefix)
+		session, err := redisRepository.GetSession(ctx, userEmail, sessionID)
+		if errors.Is(err, entity.ErrSessionNotFound) {
+			// expired between SCAN and HGETALL
+			continue
 		}
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
 	}
-
-	// check last value
 	if err := iter.Err(); err != nil {
-		log.Printf("Failed to delete refresh token: %s\n", iter.Val())
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func newSession(userEmail string, sessionID string, values map[string]string) *entity.Session {
+	return &entity.Session{
+		ID:                   sessionID,
+		UserEmail:            userEmail,
+		CreatedAt:            unixField(values, "created_at"),
+		LastRefreshedAt:      unixField(values, "last_refreshed_at"),
+		ExpiresAt:            unixField(values, "expires_at"),
+		UserAgent:            values["user_agent"],
+		IP:                   values["ip"],
+		AccessTokenID:        values["access_token_id"],
+		AccessTokenExpiresAt: unixField(values, "access_token_expires_at"),
+		ClientID:             values["client_id"],
+	}
+}
+
+func unixField(values map[string]string, field string) time.Time {
+	seconds, _ := strconv.ParseInt(values[field], 10, 64)
+	return time.Unix(seconds, 0)
+}
+
+func (redisRepository *redisTokenRepository) DeleteUserRefreshTokens(ctx context.Context, userEmail string) error {
+	failCount := 0
+
+	for _, pattern := range []string{scanPattern(refreshTokenKey(userEmail, "")), scanPattern(tokenFamilyKey(userEmail, ""))} {
+		iter := redisRepository.Client.Scan(ctx, 0, pattern, 5).Iterator()
+
+		for iter.Next(ctx) {
+			if err := redisRepository.Client.Del(ctx, iter.Val()).Err(); err != nil {
+				log.Printf("Failed to delete refresh token: %s\n", iter.Val())
+				failCount++
+			}
+		}
+
+		// check last value
+		if err := iter.Err(); err != nil {
+			log.Printf("Failed to delete refresh token: %s\n", iter.Val())
+		}
 	}
 
 	if failCount > 0 {
@@ -71,11 +249,42 @@ func (redisRepository *redisTokenRepository) DeleteUserRefreshTokens(ctx context
 	return nil
 }
 
-func (redisRepository *redisTokenRepository) SetRefreshToken(ctx context.Context, userEmail string, tokenID string, expiresIn time.Time) error {
-	now := time.Now()
-	key := fmt.Sprintf("%s:%s", userEmail, tokenID)
-	if err := redisRepository.Client.Set(ctx, key, 0, expiresIn.Sub(now)).Err(); err != nil {
-		return errors.New("could not SET refresh token to redis for userEmail/tokenID")
+func (redisRepository *redisTokenRepository) DenylistAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	expiration := time.Until(expiresAt)
+	if expiration <= 0 {
+		return nil
+	}
+	if err := redisRepository.Client.Set(ctx, denylistKey(tokenID), 1, expiration).Err(); err != nil {
+		log.Printf("Could not SET denylisted access token to redis for tokenID: %s: %v\n", tokenID, err)
+		return err
 	}
 	return nil
 }
+
+func (redisRepository *redisTokenRepository) IsAccessTokenDenylisted(ctx context.Context, tokenID string) (bool, error) {
+	exists, err := redisRepository.Client.Exists(ctx, denylistKey(tokenID)).Result()
+	if err != nil {
+		return false, err
+	}
+	return exists > 0, nil
+}
+
+func (redisRepository *redisTokenRepository) SetTokensRevokedAt(ctx context.Context, userEmail string, revokedAt time.Time, expiration time.Duration) error {
+	if err := redisRepository.Client.Set(ctx, tokensRevokedAtKey(userEmail), revokedAt.UnixNano(), expiration).Err(); err != nil {
+		log.Printf("Could not SET revocation time to redis for userEmail: %s: %v\n", userEmail, err)
+		return err
+	}
+	return nil
+}
+
+// GetTokensRevokedAt returns the zero time when the user never revoked all sessions
+func (redisRepository *redisTokenRepository) GetTokensRevokedAt(ctx context.Context, userEmail string) (time.Time, error) {
+	revokedAt, err := redisRepository.Client.Get(ctx, tokensRevokedAtKey(userEmail)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, revokedAt), nil
+}
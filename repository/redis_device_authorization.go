@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang-api/entity"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type redisDeviceAuthorizationRepository struct {
+	Client *redis.Client
+}
+
+func NewRedisDeviceAuthorizationRepository(client *redis.Client) entity.DeviceAuthorizationRepository {
+	return &redisDeviceAuthorizationRepository{
+		Client: client,
+	}
+}
+
+// device_authorization:{deviceCodeHash} holds a hash with the user code, client, scopes, status,
+// approving user with its auth_time and amr, polling interval and last poll
+func deviceAuthorizationKey(deviceCodeHash string) string {
+	return fmt.Sprintf("device_authorization:%s", deviceCodeHash)
+}
+
+// device_user_code:{userCode} points to the device code hash, for the approval page
+func deviceUserCodeKey(userCode string) string {
+	return fmt.Sprintf("device_user_code:%s", userCode)
+}
+
+func (redisRepository *redisDeviceAuthorizationRepository) CreateDeviceAuthorization(ctx context.Context, deviceAuthorization entity.DeviceAuthorization) error {
+	key := deviceAuthorizationKey(deviceAuthorization.DeviceCodeHash)
+	userCodeKey := deviceUserCodeKey(deviceAuthorization.UserCode)
+
+	// A user code must point to a single device, a collision is reported rather than overwritten
+	created, err := redisRepository.Client.SetNX(ctx, userCodeKey, deviceAuthorization.DeviceCodeHash, time.Until(deviceAuthorization.ExpiresAt)).Result()
+	if err != nil {
+		return err
+	}
+	if !created {
+		return errors.New("user code already in use")
+	}
+
+	pipe := redisRepository.Client.TxPipeline()
+	pipe.HSet(ctx, key,
+		"user_code", deviceAuthorization.UserCode,
+		"client_id", deviceAuthorization.ClientID,
+		"scopes", strings.Join(deviceAuthorization.Scopes, " "),
+		"status", deviceAuthorization.Status,
+		"user_email", "",
+		"auth_time", 0,
+		"amr", "",
+		"interval", int64(deviceAuthorization.Interval.Seconds()),
+		"last_polled_at", 0,
+		"expires_at", deviceAuthorization.ExpiresAt.Unix(),
+	)
+	pipe.ExpireAt(ctx, key, deviceAuthorization.ExpiresAt)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Could not SET device authorization to redis for user code %s: %v\n", deviceAuthorization.UserCode, err)
+		return err
+	}
+	return nil
+}
+
+func (redisRepository *redisDeviceAuthorizationRepository) GetDeviceAuthorizationByUserCode(ctx context.Context, userCode string) (*entity.DeviceAuthorization, error) {
+	deviceCodeHash, err := redisRepository.Client.Get(ctx, deviceUserCodeKey(userCode)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, entity.ErrDeviceAuthorizationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := redisRepository.Client.HGetAll(ctx, deviceAuthorizationKey(deviceCodeHash)).Result()
+	if err != nil {
+		return nil, err
+	}
+	return newDeviceAuthorization(deviceCodeHash, values)
+}
+
+func (redisRepository *redisDeviceAuthorizationRepository) SetDeviceAuthorizationStatus(ctx context.Context, deviceAuthorization entity.DeviceAuthorization) error {
+	key := deviceAuthorizationKey(deviceAuthorization.DeviceCodeHash)
+
+	currentStatus, err := redisRepository.Client.HGet(ctx, key, "status").Result()
+	if errors.Is(err, redis.Nil) {
+		return entity.ErrDeviceAuthorizationNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if currentStatus != entity.DeviceAuthorizationPending {
+		return entity.ErrDeviceAuthorizationNotFound
+	}
+
+	var authTime int64
+	if !deviceAuthorization.AuthTime.IsZero() {
+		authTime = deviceAuthorization.AuthTime.Unix()
+	}
+	return redisRepository.Client.HSet(ctx, key,
+		"status", deviceAuthorization.Status,
+		"user_email", deviceAuthorization.UserEmail,
+		"auth_time", authTime,
+		"amr", strings.Join(deviceAuthorization.AMR, " "),
+	).Err()
+}
+
+func (redisRepository *redisDeviceAuthorizationRepository) PollDeviceAuthorization(ctx context.Context, deviceCodeHash string) (*entity.DeviceAuthorization, time.Time, error) {
+	key := deviceAuthorizationKey(deviceCodeHash)
+
+	values, err := redisRepository.Client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	deviceAuthorization, err := newDeviceAuthorization(deviceCodeHash, values)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	// Setting the expiration again keeps HSET from leaving a key without TTL if it expired meanwhile
+	pipe := redisRepository.Client.TxPipeline()
+	pipe.HSet(ctx, key, "last_polled_at", time.Now().Unix())
+	pipe.ExpireAt(ctx, key, deviceAuthorization.ExpiresAt)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, time.Time{}, err
+	}
+	return deviceAuthorization, unixField(values, "last_polled_at"), nil
+}
+
+func (redisRepository *redisDeviceAuthorizationRepository) SetDeviceAuthorizationInterval(ctx context.Context, deviceCodeHash string, interval time.Duration) error {
+	return redisRepository.Client.HSet(ctx, deviceAuthorizationKey(deviceCodeHash), "interval", int64(interval.Seconds())).Err()
+}
+
+func (redisRepository *redisDeviceAuthorizationRepository) ConsumeDeviceAuthorization(ctx context.Context, deviceAuthorization entity.DeviceAuthorization) error {
+	deleted, err := redisRepository.Client.Del(ctx, deviceAuthorizationKey(deviceAuthorization.DeviceCodeHash)).Result()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return entity.ErrDeviceAuthorizationNotFound
+	}
+
+	if err := redisRepository.Client.Del(ctx, deviceUserCodeKey(deviceAuthorization.UserCode)).Err(); err != nil {
+		log.Printf("Failed to delete device user code %s: %v\n", deviceAuthorization.UserCode, err)
+	}
+	return nil
+}
+
+func newDeviceAuthorization(deviceCodeHash string, values map[string]string) (*entity.DeviceAuthorization, error) {
+	if len(values) == 0 {
+		return nil, entity.ErrDeviceAuthorizationNotFound
+	}
+
+	interval, _ := strconv.ParseInt(values["interval"], 10, 64)
+	deviceAuthorization := &entity.DeviceAuthorization{
+		DeviceCodeHash: deviceCodeHash,
+		UserCode:       values["user_code"],
+		ClientID:       values["client_id"],
+		Scopes:         strings.Fields(values["scopes"]),
+		Status:         values["status"],
+		UserEmail:      values["user_email"],
+		AMR:            strings.Fields(values["amr"]),
+		Interval:       time.Duration(interval) * time.Second,
+		ExpiresAt:      unixField(values, "expires_at"),
+	}
+	// Authorizations approved before auth_time was stored have none
+	if authTime := unixField(values, "auth_time"); authTime.Unix() != 0 {
+		deviceAuthorization.AuthTime = authTime
+	}
+	return deviceAuthorization, nil
+}
@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"golang-api/entity"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type redisDPoPProofRepository struct {
+	Client *redis.Client
+}
+
+func NewRedisDPoPProofRepository(client *redis.Client) entity.DPoPProofRepository {
+	return &redisDPoPProofRepository{
+		Client: client,
+	}
+}
+
+// dpop_proof:{jkt}:{jti} exists while a proof could still be accepted, so it cannot be replayed
+func dpopProofKey(jkt string, jti string) string {
+	return fmt.Sprintf("dpop_proof:%s:%s", jkt, jti)
+}
+
+func (redisRepository *redisDPoPProofRepository) UseDPoPProof(ctx context.Context, jkt string, jti string, expiresAt time.Time) (bool, error) {
+	return redisRepository.Client.SetNX(ctx, dpopProofKey(jkt, jti), 1, time.Until(expiresAt)).Result()
+}
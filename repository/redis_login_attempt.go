@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"golang-api/entity"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type redisLoginAttemptRepository struct {
+	Client *redis.Client
+}
+
+func NewRedisLoginAttemptRepository(client *redis.Client) entity.LoginAttemptRepository {
+	return &redisLoginAttemptRepository{
+		Client: client,
+	}
+}
+
+// login_attempts:{key} holds a hash with the failures, the end of the current lock and the hard lock flag.
+// It expires with the attempt window, except once hard locked
+func loginAttemptsKey(key string) string {
+	return fmt.Sprintf("login_attempts:%s", key)
+}
+
+func (redisRepository *redisLoginAttemptRepository) GetLoginAttempts(ctx context.Context, key string) (*entity.LoginAttempts, error) {
+	values, err := redisRepository.Client.HGetAll(ctx, loginAttemptsKey(key)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	failures, _ := strconv.ParseInt(values["failures"], 10, 64)
+	loginAttempts := &entity.LoginAttempts{
+		Failures:   failures,
+		HardLocked: values["hard_locked"] == "1",
+	}
+	if values["locked_until"] != "" {
+		loginAttempts.LockedUntil = unixField(values, "locked_until")
+	}
+	return loginAttempts, nil
+}
+
+func (redisRepository *redisLoginAttemptRepository) RecordLoginFailure(ctx context.Context, key string, window time.Duration) (int64, error) {
+	redisKey := loginAttemptsKey(key)
+
+	pipe := redisRepository.Client.TxPipeline()
+	failures := pipe.HIncrBy(ctx, redisKey, "failures", 1)
+	// A hard lock has no expiration, the window only applies to plain counters
+	hardLocked := pipe.HExists(ctx, redisKey, "hard_locked")
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	if !hardLocked.Val() {
+		if err := redisRepository.Client.Expire(ctx, redisKey, window).Err(); err != nil {
+			return 0, err
+		}
+	}
+	return failures.Val(), nil
+}
+
+func (redisRepository *redisLoginAttemptRepository) SetLoginLock(ctx context.Context, key string, lockedUntil time.Time) error {
+	return redisRepository.Client.HSet(ctx, loginAttemptsKey(key), "locked_until", lockedUntil.Unix()).Err()
+}
+
+func (redisRepository *redisLoginAttemptRepository) SetLoginHardLock(ctx context.Context, key string) error {
+	redisKey := loginAttemptsKey(key)
+
+	pipe := redisRepository.Client.TxPipeline()
+	pipe.HSet(ctx, redisKey, "hard_locked", 1)
+	pipe.Persist(ctx, redisKey)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (redisRepository *redisLoginAttemptRepository) ClearLoginAttempts(ctx context.Context, key string) error {
+	return redisRepository.Client.Del(ctx, loginAttemptsKey(key)).Err()
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"golang-api/entity"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type redisOneTimeTokenRepository struct {
+	Client *redis.Client
+}
+
+func NewRedisOneTimeTokenRepository(client *redis.Client) entity.OneTimeTokenRepository {
+	return &redisOneTimeTokenRepository{
+		Client: client,
+	}
+}
+
+// one_time_token:{purpose}:{tokenHash} holds a hash with the subject, the failed attempts
+// and the token data under data: prefixed fields
+func oneTimeTokenKey(purpose string, tokenHash string) string {
+	return fmt.Sprintf("one_time_token:%s:%s", purpose, tokenHash)
+}
+
+const oneTimeTokenDataPrefix = "data:"
+
+func (redisRepository *redisOneTimeTokenRepository) SetOneTimeToken(ctx context.Context, oneTimeToken entity.OneTimeToken) error {
+	key := oneTimeTokenKey(oneTimeToken.Purpose, oneTimeToken.TokenHash)
+
+	values := []interface{}{"subject", oneTimeToken.Subject, "expires_at", oneTimeToken.ExpiresAt.Unix(), "attempts", 0}
+	for field, value := range oneTimeToken.Data {
+		values = append(values, oneTimeTokenDataPrefix+field, value)
+	}
+
+	pipe := redisRepository.Client.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.HSet(ctx, key, values...)
+	pipe.ExpireAt(ctx, key, oneTimeToken.ExpiresAt)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Could not SET %s token to redis: %v\n", oneTimeToken.Purpose, err)
+		return err
+	}
+	return nil
+}
+
+func (redisRepository *redisOneTimeTokenRepository) GetOneTimeToken(ctx context.Context, purpose string, tokenHash string) (*entity.OneTimeToken, error) {
+	values, err := redisRepository.Client.HGetAll(ctx, oneTimeTokenKey(purpose, tokenHash)).Result()
+	if err != nil {
+		return nil, err
+	}
+	return newOneTimeToken(purpose, tokenHash, values)
+}
+
+func (redisRepository *redisOneTimeTokenRepository) ConsumeOneTimeToken(ctx context.Context, purpose string, tokenHash string) (*entity.OneTimeToken, error) {
+	key := oneTimeTokenKey(purpose, tokenHash)
+
+	pipe := redisRepository.Client.TxPipeline()
+	getCmd := pipe.HGetAll(ctx, key)
+	pipe.Del(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	return newOneTimeToken(purpose, tokenHash, getCmd.Val())
+}
+
+func (redisRepository *redisOneTimeTokenRepository) IncrementOneTimeTokenAttempts(ctx context.Context, purpose string, tokenHash string) (int64, error) {
+	key := oneTimeTokenKey(purpose, tokenHash)
+
+	// HINCRBY would recreate an expired token without a TTL, so only increment existing ones
+	exists, err := redisRepository.Client.Exists(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if exists == 0 {
+		return 0, entity.ErrOneTimeTokenNotFound
+	}
+	return redisRepository.Client.HIncrBy(ctx, key, "attempts", 1).Result()
+}
+
+func newOneTimeToken(purpose string, tokenHash string, values map[string]string) (*entity.OneTimeToken, error) {
+	if len(values) == 0 {
+		return nil, entity.ErrOneTimeTokenNotFound
+	}
+
+	oneTimeToken := &entity.OneTimeToken{
+		Purpose:   purpose,
+		TokenHash: tokenHash,
+		Subject:   values["subject"],
+		Data:      map[string]string{},
+		ExpiresAt: unixField(values, "expires_at"),
+	}
+	for field, value := range values {
+		if strings.HasPrefix(field, oneTimeTokenDataPrefix) {
+			oneTimeToken.Data[strings.TrimPrefix(field, oneTimeTokenDataPrefix)] = value
+		}
+	}
+
+	if time.Now().After(oneTimeToken.ExpiresAt) {
+		return nil, entity.ErrOneTimeTokenNotFound
+	}
+	return oneTimeToken, nil
+}
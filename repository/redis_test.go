@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"path"
+	"testing"
+)
+
+func TestScanPatternEscapesEmail(t *testing.T) {
+	tests := []struct {
+		email   string
+		key     string
+		matches bool
+	}{
+		{"alice@example.com", "token_family:alice@example.com:session", true},
+		{"a*@example.com", "token_family:a*@example.com:session", true},
+		{"a*@example.com", "token_family:alice@example.com:session", false},
+		{"?lice@example.com", "token_family:alice@example.com:session", false},
+		{"[a-z]lice@example.com", "token_family:alice@example.com:session", false},
+		{"[a-z]lice@example.com", "token_family:[a-z]lice@example.com:session", true},
+		{`a\*@example.com`, `token_family:a\*@example.com:session`, true},
+		{`a\*@example.com`, "token_family:a*@example.com:session", false},
+	}
+	for _, test := range tests {
+		// path.Match implements the same glob syntax as SCAN MATCH for keys without a slash
+		matched, err := path.Match(scanPattern(tokenFamilyKey(test.email, "")), test.key)
+		if err != nil {
+			t.Fatalf("%s: %v", test.email, err)
+		}
+		if matched != test.matches {
+			t.Errorf("pattern of %s matched %s: %v, want %v", test.email, test.key, matched, test.matches)
+		}
+	}
+}
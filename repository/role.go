@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"golang-api/entity"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type RoleGorm struct {
+	ID          uint      `gorm:"primary_key;auto_increment"`
+	Name        string    `gorm:"type:varchar(64);UNIQUE"`
+	Description string    `gorm:"type:varchar(256)"`
+	Permissions string    `gorm:"type:text"`
+	BuiltIn     bool      `gorm:"default:false"`
+	CreatedAt   time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+	UpdatedAt   time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+func (RoleGorm) TableName() string {
+	return "roles"
+}
+
+func (r RoleGorm) ToEntity() (*entity.Role, error) {
+	var permissions []string
+	if r.Permissions != "" {
+		permissions = strings.Split(r.Permissions, ",")
+	}
+	return &entity.Role{
+		ID:          r.ID,
+		Name:        r.Name,
+		Description: r.Description,
+		Permissions: permissions,
+		BuiltIn:     r.BuiltIn,
+	}, nil
+}
+
+func NewRoleGorm(r entity.Role) RoleGorm {
+	return RoleGorm{
+		ID:          r.ID,
+		Name:        r.Name,
+		Description: r.Description,
+		Permissions: strings.Join(r.Permissions, ","),
+		BuiltIn:     r.BuiltIn,
+	}
+}
+
+type roleRepository struct {
+	DB *gorm.DB
+}
+
+func NewRoleRepository(db *gorm.DB) entity.RoleRepository {
+	return &roleRepository{
+		DB: db,
+	}
+}
+
+func (roleRepository *roleRepository) GetRoleByName(name string) (*entity.Role, error) {
+	roleGorm := &RoleGorm{}
+	err := roleRepository.DB.First(&roleGorm, "name = ?", name).Error
+	if err != nil {
+		return &entity.Role{}, err
+	}
+	return roleGorm.ToEntity()
+}
+
+func (roleRepository *roleRepository) GetRoles() ([]entity.Role, error) {
+	var rolesGorm []RoleGorm
+	var roles []entity.Role
+	err := roleRepository.DB.Order("id").Find(&rolesGorm).Error
+
+	for _, roleGorm := range rolesGorm {
+		role, err := roleGorm.ToEntity()
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, *role)
+	}
+	return roles, err
+}
+
+func (roleRepository *roleRepository) CreateRole(role entity.Role) (*entity.Role, error) {
+	roleGorm := NewRoleGorm(role)
+	err := roleRepository.DB.Create(&roleGorm).Error
+	if err != nil {
+		return nil, err
+	}
+	return roleGorm.ToEntity()
+}
+
+func (roleRepository *roleRepository) UpdateRole(role entity.Role) (*entity.Role, error) {
+	roleGorm := NewRoleGorm(role)
+	err := roleRepository.DB.Model(&roleGorm).Select("Description", "Permissions").Updates(&roleGorm).Error
+	if err != nil {
+		return nil, err
+	}
+	return roleGorm.ToEntity()
+}
+
+func (roleRepository *roleRepository) DeleteRole(name string) error {
+	return roleRepository.DB.Where("name = ?", name).Delete(&RoleGorm{}).Error
+}
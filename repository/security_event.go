@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"golang-api/entity"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type SecurityEventGorm struct {
+	ID        uint      `gorm:"primary_key;auto_increment"`
+	Type      string    `gorm:"type:varchar(64);index"`
+	UserEmail string    `gorm:"type:varchar(256);index"`
+	Details   string    `gorm:"type:text"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+func (SecurityEventGorm) TableName() string {
+	return "security_events"
+}
+
+func NewSecurityEventGorm(e entity.SecurityEvent) SecurityEventGorm {
+	return SecurityEventGorm{
+		ID:        e.ID,
+		Type:      e.Type,
+		UserEmail: e.UserEmail,
+		Details:   e.Details,
+		CreatedAt: e.CreatedAt,
+	}
+}
+
+type securityEventRepository struct {
+	DB *gorm.DB
+}
+
+func NewSecurityEventRepository(db *gorm.DB) entity.SecurityEventRepository {
+	return &securityEventRepository{
+		DB: db,
+	}
+}
+
+func (securityEventRepository *securityEventRepository) CreateSecurityEvent(securityEvent entity.SecurityEvent) error {
+	securityEventGorm := NewSecurityEventGorm(securityEvent)
+	return securityEventRepository.DB.Create(&securityEventGorm).Error
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"golang-api/entity"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type SigningKeyGorm struct {
+	ID          uint      `gorm:"primary_key;auto_increment"`
+	KeyID       string    `gorm:"type:varchar(128);UNIQUE"`
+	Algorithm   string    `gorm:"type:varchar(16)"`
+	KeyMaterial string    `gorm:"type:text"`
+	NotBefore   time.Time `gorm:"not null"`
+	RetireAfter *time.Time
+	CreatedAt   time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+func (SigningKeyGorm) TableName() string {
+	return "signing_keys"
+}
+
+func (k SigningKeyGorm) ToEntity() (*entity.SigningKey, error) {
+	return &entity.SigningKey{
+		ID:          k.ID,
+		KeyID:       k.KeyID,
+		Algorithm:   k.Algorithm,
+		KeyMaterial: k.KeyMaterial,
+		NotBefore:   k.NotBefore,
+		RetireAfter: k.RetireAfter,
+		CreatedAt:   k.CreatedAt,
+	}, nil
+}
+
+func NewSigningKeyGorm(k entity.SigningKey) SigningKeyGorm {
+	return SigningKeyGorm{
+		ID:          k.ID,
+		KeyID:       k.KeyID,
+		Algorithm:   k.Algorithm,
+		KeyMaterial: k.KeyMaterial,
+		NotBefore:   k.NotBefore,
+		RetireAfter: k.RetireAfter,
+		CreatedAt:   k.CreatedAt,
+	}
+}
+
+type signingKeyRepository struct {
+	DB *gorm.DB
+}
+
+func NewSigningKeyRepository(db *gorm.DB) entity.SigningKeyRepository {
+	return &signingKeyRepository{
+		DB: db,
+	}
+}
+
+func (signingKeyRepository *signingKeyRepository) GetSigningKeys() ([]entity.SigningKey, error) {
+	var signingKeysGorm []SigningKeyGorm
+	var signingKeys []entity.SigningKey
+	err := signingKeyRepository.DB.Order("id").Find(&signingKeysGorm).Error
+
+	for _, signingKeyGorm := range signingKeysGorm {
+		signingKey, err := signingKeyGorm.ToEntity()
+		if err != nil {
+			return nil, err
+		}
+		signingKeys = append(signingKeys, *signingKey)
+	}
+	return signingKeys, err
+}
+
+func (signingKeyRepository *signingKeyRepository) CreateSigningKey(signingKey entity.SigningKey) (*entity.SigningKey, error) {
+	signingKeyGorm := NewSigningKeyGorm(signingKey)
+	err := signingKeyRepository.DB.Create(&signingKeyGorm).Error
+	if err != nil {
+		return nil, err
+	}
+	return signingKeyGorm.ToEntity()
+}
+
+func (signingKeyRepository *signingKeyRepository) UpdateSigningKey(signingKey entity.SigningKey) (*entity.SigningKey, error) {
+	signingKeyGorm := NewSigningKeyGorm(signingKey)
+	err := signingKeyRepository.DB.Updates(&signingKeyGorm).Error
+	if err != nil {
+		return nil, err
+	}
+	return signingKeyGorm.ToEntity()
+}
@@ -13,8 +13,17 @@ type UserGorm struct {
 	LastName  string    `gorm:"type:varchar(32)"`
 	Email     string    `gorm:"type:varchar(256);UNIQUE"`
 	Password  string    `gorm:"type:varchar(256)"`
+	Role      string    `gorm:"type:varchar(64);default:member"`
 	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP"`
 	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+
+	// TOTPSecret has to be stored in clear, the server computes the expected codes from it
+	TOTPSecret   string `gorm:"type:varchar(64)"`
+	TOTPEnabled  bool   `gorm:"default:false"`
+	TOTPLastStep int64  `gorm:"default:0"`
+
+	EmailVerifiedAt *time.Time
+	PendingEmail    string `gorm:"type:varchar(256)"`
 }
 
 func (UserGorm) TableName() string {
@@ -28,6 +37,14 @@ func (u UserGorm) ToEntity() (*entity.User, error) {
 		LastName:  u.LastName,
 		Email:     u.Email,
 		Password:  u.Password,
+		Role:      u.Role,
+
+		TOTPSecret:   u.TOTPSecret,
+		TOTPEnabled:  u.TOTPEnabled,
+		TOTPLastStep: u.TOTPLastStep,
+
+		EmailVerifiedAt: u.EmailVerifiedAt,
+		PendingEmail:    u.PendingEmail,
 	}, nil
 }
 
@@ -38,6 +55,14 @@ func NewUserGorm(u entity.User) UserGorm {
 		LastName:  u.LastName,
 		Email:     u.Email,
 		Password:  u.Password,
+		Role:      u.Role,
+
+		TOTPSecret:   u.TOTPSecret,
+		TOTPEnabled:  u.TOTPEnabled,
+		TOTPLastStep: u.TOTPLastStep,
+
+		EmailVerifiedAt: u.EmailVerifiedAt,
+		PendingEmail:    u.PendingEmail,
 	}
 }
 
@@ -106,3 +131,52 @@ func (userRepository *userRepository) GetUsers() ([]entity.User, error) {
 	}
 	return users, err
 }
+
+func (userRepository *userRepository) CountUsersByRole(role string) (int64, error) {
+	var count int64
+	err := userRepository.DB.Model(&UserGorm{}).Where("role = ?", role).Count(&count).Error
+	return count, err
+}
+
+// UpdateUserMFA writes the MFA fields even when they are zero values, which UpdateUser would skip
+func (userRepository *userRepository) UpdateUserMFA(user entity.User) error {
+	userGorm := NewUserGorm(user)
+	return userRepository.DB.Model(&userGorm).
+		Select("TOTPSecret", "TOTPEnabled", "TOTPLastStep").
+		Updates(&userGorm).Error
+}
+
+func (userRepository *userRepository) UseTOTPStep(ID uint, step int64) error {
+	// The totp_last_step < ? condition makes concurrent uses of the same code race safely
+	result := userRepository.DB.Model(&UserGorm{}).
+		Where("id = ? AND totp_last_step < ?", ID, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return entity.ErrTOTPStepUsed
+	}
+	return nil
+}
+
+// CountLegacyPasswordHashes skips users without a password, directory and federated users never get one
+func (userRepository *userRepository) CountLegacyPasswordHashes(currentPrefix string) (int64, error) {
+	var count int64
+	err := userRepository.DB.Model(&UserGorm{}).
+		Where("password <> '' AND left(password, ?) <> ?", len(currentPrefix), currentPrefix).
+		Count(&count).Error
+	return count, err
+}
+
+func (userRepository *userRepository) UpdateUserPassword(ID uint, password string) error {
+	return userRepository.DB.Model(&UserGorm{}).Where("id = ?", ID).Update("password", password).Error
+}
+
+// UpdateUserEmail writes the email fields even when they are zero values, which UpdateUser would skip
+func (userRepository *userRepository) UpdateUserEmail(user entity.User) error {
+	userGorm := NewUserGorm(user)
+	return userRepository.DB.Model(&userGorm).
+		Select("Email", "PendingEmail", "EmailVerifiedAt").
+		Updates(&userGorm).Error
+}
@@ -2,76 +2,319 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"golang-api/cache"
 	"golang-api/entity"
 	"golang-api/util"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Different types of error returned by Login
+var (
+	// ErrInvalidCredentials is returned for an unknown email or a wrong password alike
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrEmailNotVerified is returned after checking the password, when verification is required
+	ErrEmailNotVerified = errors.New("email is not verified")
 )
 
 type AuthService interface {
-	Login(email string, password string) bool
-	Logout(ctx context.Context, email string, token string) error
+	Login(email string, password string) (*entity.User, error)
+	Logout(ctx context.Context, email string, tokenID string) error
 	Revoke(ctx context.Context, email string) error
-	CreateTokens(ctx context.Context, email string, prevTokenID string) (*entity.TokenDetails, error)
+	CreateTokens(ctx context.Context, email string, prevTokenID string, sessionMetadata entity.SessionMetadata) (*entity.TokenDetails, error)
+	VerifyAccessToken(ctx context.Context, accessToken string) (*util.JWTPayload, error)
+	RevokeAccessToken(ctx context.Context, accessPayload *util.JWTPayload) error
 }
 
 type authService struct {
-	userRepository  entity.UserRepository
-	tokenRepository entity.TokenRepository
-	config          util.Config
+	userRepository          entity.UserRepository
+	roleRepository          entity.RoleRepository
+	tokenRepository         entity.TokenRepository
+	securityEventRepository entity.SecurityEventRepository
+	tokenMaker              util.TokenMaker
+	refreshTokenMaker       util.TokenMaker
+	authenticator           Authenticator
+	config                  util.Config
+	// revocations caches denylist lookups by token ID and revocation times by email, saving a redis round trip per request
+	revocations *cache.LRU[time.Time]
 }
 
-func NewAuthService(userRepository entity.UserRepository, tokenRepository entity.TokenRepository, config util.Config) AuthService {
+func NewAuthService(userRepository entity.UserRepository, roleRepository entity.RoleRepository, tokenRepository entity.TokenRepository, securityEventRepository entity.SecurityEventRepository, tokenMaker util.TokenMaker, refreshTokenMaker util.TokenMaker, authenticator Authenticator, config util.Config) AuthService {
 	return &authService{
 		userRepository,
+		roleRepository,
 		tokenRepository,
+		securityEventRepository,
+		tokenMaker,
+		refreshTokenMaker,
+		authenticator,
 		config,
+		cache.NewLRU[time.Time](config.DenylistCacheSize),
 	}
 }
 
-func (authService *authService) CreateTokens(ctx context.Context, email string, prevTokenID string) (*entity.TokenDetails, error) {
+// CreateTokens issues a new token pair. Without prevTokenID it starts a new token family,
+// otherwise it rotates the given refresh token and continues its family.
+// Presenting a refresh token that was already rotated revokes the whole family
+func (authService *authService) CreateTokens(ctx context.Context, email string, prevTokenID string, sessionMetadata entity.SessionMetadata) (*entity.TokenDetails, error) {
+	refreshTokenState := entity.RefreshToken{
+		UserEmail: email,
+		FamilyID:  uuid.New().String(),
+		ClientID:  sessionMetadata.ClientID,
+		Scopes:    sessionMetadata.Scopes,
+		AuthTime:  sessionMetadata.AuthTime,
+		AMR:       sessionMetadata.AMR,
+	}
+	if refreshTokenState.AuthTime.IsZero() {
+		refreshTokenState.AuthTime = time.Now()
+	}
 
 	if prevTokenID != "" {
-		if err := authService.tokenRepository.DeleteRefreshToken(ctx, email, prevTokenID); err != nil {
+		prevRefreshToken, err := authService.tokenRepository.RotateRefreshToken(ctx, email, prevTokenID)
+		if errors.Is(err, entity.ErrRefreshTokenReused) {
+			authService.revokeReusedTokenFamily(ctx, prevRefreshToken)
 			return nil, err
 		}
+		if err != nil {
+			return nil, err
+		}
+		refreshTokenState.FamilyID = prevRefreshToken.FamilyID
+		refreshTokenState.ParentID = prevRefreshToken.ID
+		refreshTokenState.Rotation = prevRefreshToken.Rotation + 1
+		refreshTokenState.ClientID = prevRefreshToken.ClientID
+		refreshTokenState.Scopes = prevRefreshToken.Scopes
+		refreshTokenState.AuthTime = prevRefreshToken.AuthTime
+		refreshTokenState.AMR = prevRefreshToken.AMR
 	}
 
-	accessToken, accessJwtPayload, err := util.CreateToken(email, authService.config.AccessTokenDuration, authService.config.JWTSecretKey)
+	// Role and permissions are read on every issue, so a refresh picks up role changes
+	subject, err := authService.tokenSubject(email)
 	if err != nil {
 		return nil, err
 	}
+	subject.SessionID = refreshTokenState.FamilyID
+	subject.JKT = sessionMetadata.JKT
+	subject.AuthTime = refreshTokenState.AuthTime
+	subject.AMR = refreshTokenState.AMR
+	if refreshTokenState.ClientID != "" {
+		subject.ClientID = refreshTokenState.ClientID
+		subject.Scopes = refreshTokenState.Scopes
+		subject.Permissions = scopedPermissions(subject.Permissions, permissionScopes(refreshTokenState.Scopes))
+	}
 
-	refreshToken, refreshJwtPayload, err := util.CreateToken(email, authService.config.RefreshTokenDuration, authService.config.JWTSecretKey)
+	accessToken, accessJwtPayload, err := authService.tokenMaker.CreateToken(subject, authService.config.AccessTokenDuration)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := authService.tokenRepository.SetRefreshToken(ctx, email, refreshToken, refreshJwtPayload.ExpiredAt); err != nil {
+	refreshToken, refreshJwtPayload, err := authService.refreshTokenMaker.CreateToken(subject, authService.config.RefreshTokenDuration)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshTokenState.ID = refreshJwtPayload.ID.String()
+	refreshTokenState.ExpiresAt = refreshJwtPayload.ExpiredAt
+	session := entity.Session{
+		UserAgent:            sessionMetadata.UserAgent,
+		IP:                   sessionMetadata.IP,
+		AccessTokenID:        accessJwtPayload.ID.String(),
+		AccessTokenExpiresAt: accessJwtPayload.ExpiredAt,
+	}
+	if err := authService.tokenRepository.SetRefreshToken(ctx, refreshTokenState, session); err != nil {
+		return nil, err
+	}
+
+	sessionUuid, err := uuid.Parse(refreshTokenState.FamilyID)
+	if err != nil {
 		return nil, err
 	}
 
 	return &entity.TokenDetails{
-		SessionUuid:           refreshJwtPayload.ID,
+		SessionUuid:           sessionUuid,
 		AccessToken:           accessToken,
 		AccessTokenExpiresAt:  accessJwtPayload.ExpiredAt,
 		RefreshToken:          refreshToken,
 		RefreshTokenExpiresAt: refreshJwtPayload.ExpiredAt,
+		TokenType:             util.TokenType(subject.JKT),
 	}, nil
 
 }
 
-func (authService *authService) Logout(ctx context.Context, email string, token string) error {
-	return authService.tokenRepository.DeleteRefreshToken(ctx, email, token)
+// revokeReusedTokenFamily kills every token descending from the same login and records the incident
+func (authService *authService) revokeReusedTokenFamily(ctx context.Context, refreshToken *entity.RefreshToken) {
+	if err := authService.tokenRepository.DeleteTokenFamily(ctx, refreshToken.UserEmail, refreshToken.FamilyID); err != nil {
+		log.Printf("Failed to revoke token family %s of %s: %v\n", refreshToken.FamilyID, refreshToken.UserEmail, err)
+	}
+
+	securityEvent := entity.SecurityEvent{
+		Type:      entity.SecurityEventRefreshTokenReuse,
+		UserEmail: refreshToken.UserEmail,
+		Details:   fmt.Sprintf("family=%s token=%s rotation=%d", refreshToken.FamilyID, refreshToken.ID, refreshToken.Rotation),
+	}
+	if err := authService.securityEventRepository.CreateSecurityEvent(securityEvent); err != nil {
+		log.Printf("Failed to record security event %s for %s: %v\n", securityEvent.Type, securityEvent.UserEmail, err)
+	}
+}
+
+func (authService *authService) tokenSubject(email string) (util.TokenSubject, error) {
+	user, err := authService.userRepository.GetUserByEmail(email)
+	if err != nil {
+		return util.TokenSubject{}, err
+	}
+
+	role, err := authService.roleRepository.GetRoleByName(user.Role)
+	if err != nil {
+		return util.TokenSubject{}, err
+	}
+
+	return util.TokenSubject{
+		UserID:      user.ID,
+		Email:       user.Email,
+		Role:        role.Name,
+		Permissions: role.Permissions,
+	}, nil
 }
+
+// Logout revokes the token family of the given refresh token
+func (authService *authService) Logout(ctx context.Context, email string, tokenID string) error {
+	refreshToken, err := authService.tokenRepository.GetRefreshToken(ctx, email, tokenID)
+	if err != nil {
+		return err
+	}
+	return authService.tokenRepository.DeleteTokenFamily(ctx, email, refreshToken.FamilyID)
+}
+
+// Revoke removes every refresh token of the user and invalidates the access tokens issued until now
 func (authService *authService) Revoke(ctx context.Context, email string) error {
+	revokedAt := time.Now()
+	// Access tokens issued before revokedAt are all rejected as expired once an access token lifetime
+	// and the leeway have passed
+	expiration := authService.config.AccessTokenDuration + authService.config.TokenLeeway
+	if err := authService.tokenRepository.SetTokensRevokedAt(ctx, email, revokedAt, expiration); err != nil {
+		return err
+	}
+	authService.revocations.Set(revokedAtCacheKey(email), revokedAt, expiration)
+
 	return authService.tokenRepository.DeleteUserRefreshTokens(ctx, email)
 }
 
-func (service *authService) Login(email string, password string) bool {
-	user, err := service.userRepository.GetUserByEmail(email)
+// RevokeAccessToken denylists the access token for the rest of its lifetime, leeway included
+func (authService *authService) RevokeAccessToken(ctx context.Context, accessPayload *util.JWTPayload) error {
+	denylistedUntil := accessPayload.ExpiredAt.Add(authService.config.TokenLeeway)
+	if err := authService.tokenRepository.DenylistAccessToken(ctx, accessPayload.ID.String(), denylistedUntil); err != nil {
+		return err
+	}
+	authService.revocations.Set(denylistCacheKey(accessPayload.ID.String()), denylistedUntil, time.Until(denylistedUntil))
+	return nil
+}
+
+// VerifyAccessToken checks the token signature and expiration, and that it was neither denylisted
+// nor issued before its user revoked all sessions. Service tokens have no user to revoke them
+func (authService *authService) VerifyAccessToken(ctx context.Context, accessToken string) (*util.JWTPayload, error) {
+	accessPayload, err := authService.tokenMaker.VerifyToken(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	denylisted, err := authService.isDenylisted(ctx, accessPayload)
+	if err != nil {
+		return nil, err
+	}
+	if denylisted {
+		return nil, util.ErrRevokedToken
+	}
+	if accessPayload.IsService() {
+		return accessPayload, nil
+	}
+	if accessPayload.Untyped() {
+		if err := authService.rejectRefreshToken(ctx, accessPayload); err != nil {
+			return nil, err
+		}
+	}
+
+	revokedAt, err := authService.tokensRevokedAt(ctx, accessPayload.UserEmail)
+	if err != nil {
+		return nil, err
+	}
+	// Tokens issued in the second of the revocation are told apart by the sub-second time of their jti
+	if !revokedAt.IsZero() && !accessPayload.IssuedAtPrecise().After(revokedAt) {
+		return nil, util.ErrRevokedToken
+	}
+
+	return accessPayload, nil
+}
+
+// rejectRefreshToken returns ErrInvalidToken for an untyped token that has a refresh token state,
+// it was issued as a refresh token before they were typed and encrypted under their own key
+func (authService *authService) rejectRefreshToken(ctx context.Context, accessPayload *util.JWTPayload) error {
+	_, err := authService.tokenRepository.GetRefreshToken(ctx, accessPayload.UserEmail, accessPayload.ID.String())
+	if err == nil {
+		return util.ErrInvalidToken
+	}
+	if errors.Is(err, entity.ErrRefreshTokenNotFound) {
+		return nil
+	}
+	return err
+}
+
+// isDenylisted caches denylisted tokens until they expire, and tokens found valid for DenylistCacheTTL,
+// which bounds how long a revocation made by another instance can go unnoticed
+func (authService *authService) isDenylisted(ctx context.Context, accessPayload *util.JWTPayload) (bool, error) {
+	key := denylistCacheKey(accessPayload.ID.String())
+	if denylistedUntil, ok := authService.revocations.Get(key); ok {
+		return !denylistedUntil.IsZero(), nil
+	}
+
+	denylisted, err := authService.tokenRepository.IsAccessTokenDenylisted(ctx, accessPayload.ID.String())
 	if err != nil {
-		return false
+		return false, err
 	}
 
-	err = util.CheckPassword(password, user.Password)
-	return err == nil
+	if denylisted {
+		denylistedUntil := accessPayload.ExpiredAt.Add(authService.config.TokenLeeway)
+		authService.revocations.Set(key, denylistedUntil, time.Until(denylistedUntil))
+	} else {
+		authService.revocations.Set(key, time.Time{}, authService.config.DenylistCacheTTL)
+	}
+	return denylisted, nil
+}
+
+func (authService *authService) tokensRevokedAt(ctx context.Context, email string) (time.Time, error) {
+	key := revokedAtCacheKey(email)
+	if revokedAt, ok := authService.revocations.Get(key); ok {
+		return revokedAt, nil
+	}
+
+	revokedAt, err := authService.tokenRepository.GetTokensRevokedAt(ctx, email)
+	if err != nil {
+		return time.Time{}, err
+	}
+	authService.revocations.Set(key, revokedAt, authService.config.DenylistCacheTTL)
+	return revokedAt, nil
+}
+
+func denylistCacheKey(tokenID string) string {
+	return "jti:" + tokenID
+}
+
+func revokedAtCacheKey(email string) string {
+	return "revoked_at:" + email
+}
+
+// Login checks the password of the user with the configured authenticators and returns it,
+// so the caller can tell whether a second factor is required
+func (service *authService) Login(email string, password string) (*entity.User, error) {
+	user, err := service.authenticator.Authenticate(email, password)
+	if err != nil {
+		return nil, err
+	}
+
+	if service.config.RequireEmailVerification && user.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+	return user, nil
 }
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"golang-api/entity"
+	"golang-api/util"
+	"log"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Names of the authenticators, as listed in AUTHENTICATORS
+const (
+	AuthenticatorPassword = "password"
+	AuthenticatorLDAP     = "ldap"
+)
+
+// Authenticator verifies the credentials of a login and returns the local user they belong to.
+// It returns ErrInvalidCredentials for an unknown user or a wrong password alike
+type Authenticator interface {
+	Authenticate(email string, password string) (*entity.User, error)
+}
+
+// NewAuthenticator builds the authenticators listed in AUTHENTICATORS, tried in order until one accepts the credentials
+func NewAuthenticator(userRepository entity.UserRepository, roleRepository entity.RoleRepository, passwordHashers *util.PasswordHasherRegistry, config util.Config) (Authenticator, error) {
+	var authenticators chainAuthenticator
+	for _, name := range strings.Split(config.Authenticators, ",") {
+		switch strings.TrimSpace(name) {
+		case AuthenticatorPassword, "":
+			authenticators = append(authenticators, NewPasswordAuthenticator(userRepository, passwordHashers))
+		case AuthenticatorLDAP:
+			ldapAuthenticator, err := NewLDAPAuthenticator(userRepository, roleRepository, ldap.DialURL, config)
+			if err != nil {
+				return nil, err
+			}
+			authenticators = append(authenticators, ldapAuthenticator)
+		default:
+			return nil, fmt.Errorf("unknown authenticator %s", name)
+		}
+	}
+	if len(authenticators) == 1 {
+		return authenticators[0], nil
+	}
+	return authenticators, nil
+}
+
+// chainAuthenticator tries each authenticator in turn. An unavailable backend does not prevent the next ones
+// from accepting the credentials. Once a backend rejected them the login failed, whatever the others did,
+// so the error of an unavailable backend is only returned when none of them could check the credentials
+type chainAuthenticator []Authenticator
+
+func (authenticators chainAuthenticator) Authenticate(email string, password string) (*entity.User, error) {
+	var lastErr error
+	rejected := false
+	for _, authenticator := range authenticators {
+		user, err := authenticator.Authenticate(email, password)
+		if err == nil {
+			return user, nil
+		}
+		if errors.Is(err, ErrInvalidCredentials) {
+			rejected = true
+			continue
+		}
+		log.Printf("Authenticator %T failed for %s: %v\n", authenticator, email, err)
+		lastErr = err
+	}
+	if rejected || lastErr == nil {
+		return nil, ErrInvalidCredentials
+	}
+	return nil, lastErr
+}
+
+// passwordAuthenticator checks the password hash stored in the users table
+type passwordAuthenticator struct {
+	userRepository  entity.UserRepository
+	passwordHashers *util.PasswordHasherRegistry
+	// dummyHash is verified when there is no hash to check, so the response time does not reveal which accounts exist
+	dummyHash string
+}
+
+func NewPasswordAuthenticator(userRepository entity.UserRepository, passwordHashers *util.PasswordHasherRegistry) Authenticator {
+	dummyHash, err := passwordHashers.Hash("dummy password")
+	if err != nil {
+		log.Printf("Failed to hash the dummy password: %v\n", err)
+	}
+	return &passwordAuthenticator{
+		userRepository,
+		passwordHashers,
+		dummyHash,
+	}
+}
+
+func (authenticator *passwordAuthenticator) Authenticate(email string, password string) (*entity.User, error) {
+	user, err := authenticator.userRepository.GetUserByEmail(email)
+	// Unknown users and users without a password, such as federated ones, cost a verification all the same
+	if err != nil || user.Password == "" {
+		authenticator.passwordHashers.Verify(password, authenticator.dummyHash)
+		return nil, ErrInvalidCredentials
+	}
+
+	needsRehash, err := authenticator.passwordHashers.Verify(password, user.Password)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	if needsRehash {
+		authenticator.rehashPassword(user, password)
+	}
+	return user, nil
+}
+
+// rehashPassword upgrades a hash made with an outdated algorithm or parameters, while the password is at hand
+func (authenticator *passwordAuthenticator) rehashPassword(user *entity.User, password string) {
+	hashedPassword, err := authenticator.passwordHashers.Hash(password)
+	if err != nil {
+		log.Printf("Failed to rehash the password of %s: %v\n", user.Email, err)
+		return
+	}
+	if err := authenticator.userRepository.UpdateUserPassword(user.ID, hashedPassword); err != nil {
+		log.Printf("Failed to save the rehashed password of %s: %v\n", user.Email, err)
+		return
+	}
+	user.Password = hashedPassword
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"golang-api/entity"
+	"golang-api/util"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ErrLDAPUnavailable is returned when the directory cannot be queried, as opposed to wrong credentials
+var ErrLDAPUnavailable = errors.New("ldap directory unavailable")
+
+// LDAPDialer connects to the directory at the URL, ldap.DialURL outside of tests
+type LDAPDialer func(ldapURL string, opts ...ldap.DialOpt) (*ldap.Conn, error)
+
+// groupRole maps the members of a directory group to a role
+type groupRole struct {
+	groupDN string
+	role    string
+}
+
+// ldapAuthenticator checks the password by binding to the directory as the user, then creates or syncs the local user.
+// Local users created this way have no password, the directory stays the only way to log them in
+type ldapAuthenticator struct {
+	userRepository entity.UserRepository
+	dialer         LDAPDialer
+	tlsConfig      *tls.Config
+	groupRoles     []groupRole
+	config         util.Config
+}
+
+func NewLDAPAuthenticator(userRepository entity.UserRepository, roleRepository entity.RoleRepository, dialer LDAPDialer, config util.Config) (Authenticator, error) {
+	if config.LDAPURL == "" || config.LDAPBaseDN == "" || !strings.Contains(config.LDAPUserFilter, "%s") {
+		return nil, errors.New("the ldap authenticator requires LDAP_URL, LDAP_BASE_DN and an LDAP_USER_FILTER containing %s")
+	}
+
+	ldapURL, err := url.Parse(config.LDAPURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LDAP_URL: %w", err)
+	}
+	tlsConfig := &tls.Config{ServerName: ldapURL.Hostname(), MinVersion: tls.VersionTLS12}
+	if config.LDAPCAFile != "" {
+		caPEM, err := os.ReadFile(config.LDAPCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificate found in %s", config.LDAPCAFile)
+		}
+	}
+
+	groupRoles, err := parseGroupRoles(config.LDAPGroupRoles)
+	if err != nil {
+		return nil, err
+	}
+	for _, groupRole := range groupRoles {
+		if _, err := roleRepository.GetRoleByName(groupRole.role); err != nil {
+			return nil, fmt.Errorf("LDAP_GROUP_ROLES maps %s to unknown role %s", groupRole.groupDN, groupRole.role)
+		}
+	}
+
+	return &ldapAuthenticator{
+		userRepository,
+		dialer,
+		tlsConfig,
+		groupRoles,
+		config,
+	}, nil
+}
+
+func (authenticator *ldapAuthenticator) Authenticate(email string, password string) (*entity.User, error) {
+	// An empty password makes an unauthenticated bind, which most servers accept for any DN
+	if email == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := authenticator.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if authenticator.config.LDAPBindDN != "" {
+		if err := conn.Bind(authenticator.config.LDAPBindDN, authenticator.config.LDAPBindPassword); err != nil {
+			return nil, fmt.Errorf("%w: service bind: %v", ErrLDAPUnavailable, err)
+		}
+	}
+
+	entry, err := authenticator.searchUser(conn, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("%w: user bind: %v", ErrLDAPUnavailable, err)
+	}
+
+	role, ok := authenticator.mapRole(entry.GetAttributeValues(authenticator.groupAttribute()))
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	return authenticator.syncUser(email, entry, role)
+}
+
+func (authenticator *ldapAuthenticator) dial() (*ldap.Conn, error) {
+	dialer := &net.Dialer{Timeout: authenticator.config.LDAPTimeout}
+	conn, err := authenticator.dialer(authenticator.config.LDAPURL, ldap.DialWithDialer(dialer), ldap.DialWithTLSConfig(authenticator.tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLDAPUnavailable, err)
+	}
+	if authenticator.config.LDAPTimeout > 0 {
+		conn.SetTimeout(authenticator.config.LDAPTimeout)
+	}
+
+	if authenticator.config.LDAPStartTLS {
+		if err := conn.StartTLS(authenticator.tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("%w: %v", ErrLDAPUnavailable, err)
+		}
+	}
+	return conn, nil
+}
+
+// searchUser finds the single entry matching the email, an ambiguous filter must not pick one at random
+func (authenticator *ldapAuthenticator) searchUser(conn *ldap.Conn, email string) (*ldap.Entry, error) {
+	searchRequest := ldap.NewSearchRequest(
+		authenticator.config.LDAPBaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(authenticator.config.LDAPTimeout/time.Second), false,
+		fmt.Sprintf(authenticator.config.LDAPUserFilter, ldap.EscapeFilter(email)),
+		[]string{"givenName", "sn", authenticator.groupAttribute()},
+		nil,
+	)
+	result, err := conn.Search(searchRequest)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: search: %v", ErrLDAPUnavailable, err)
+	}
+	if len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	return result.Entries[0], nil
+}
+
+// mapRole returns the role of the first mapped group the user belongs to.
+// Without a mapping every directory user may log in and roles are managed locally, returned empty
+func (authenticator *ldapAuthenticator) mapRole(groups []string) (string, bool) {
+	if len(authenticator.groupRoles) == 0 {
+		return "", true
+	}
+	for _, groupRole := range authenticator.groupRoles {
+		for _, group := range groups {
+			if strings.EqualFold(group, groupRole.groupDN) {
+				return groupRole.role, true
+			}
+		}
+	}
+	return "", false
+}
+
+// syncUser creates the local user on the first login, or updates its names and mapped role
+func (authenticator *ldapAuthenticator) syncUser(email string, entry *ldap.Entry, role string) (*entity.User, error) {
+	firstName := truncateName(entry.GetAttributeValue("givenName"))
+	lastName := truncateName(entry.GetAttributeValue("sn"))
+
+	user, err := authenticator.userRepository.GetUserByEmail(email)
+	if err != nil {
+		if role == "" {
+			role = entity.RoleMember
+		}
+		// The directory vouches for the email
+		verifiedAt := time.Now()
+		return authenticator.userRepository.CreateUser(entity.User{
+			FirstName:       firstName,
+			LastName:        lastName,
+			Email:           email,
+			Role:            role,
+			EmailVerifiedAt: &verifiedAt,
+		})
+	}
+
+	if user.FirstName == firstName && user.LastName == lastName && (role == "" || user.Role == role) {
+		return user, nil
+	}
+	user.FirstName = firstName
+	user.LastName = lastName
+	if role != "" {
+		user.Role = role
+	}
+	return authenticator.userRepository.UpdateUser(*user)
+}
+
+func (authenticator *ldapAuthenticator) groupAttribute() string {
+	if authenticator.config.LDAPGroupAttribute == "" {
+		return "memberOf"
+	}
+	return authenticator.config.LDAPGroupAttribute
+}
+
+// parseGroupRoles reads the group DN=>role pairs of LDAP_GROUP_ROLES, in order of precedence
+func parseGroupRoles(value string) ([]groupRole, error) {
+	var groupRoles []groupRole
+	for _, pair := range strings.Split(value, ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=>", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("invalid LDAP_GROUP_ROLES entry %q, expected groupDN=>role", pair)
+		}
+		groupRoles = append(groupRoles, groupRole{
+			groupDN: strings.TrimSpace(parts[0]),
+			role:    strings.TrimSpace(parts[1]),
+		})
+	}
+	return groupRoles, nil
+}
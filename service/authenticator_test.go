@@ -0,0 +1,324 @@
+package service
+
+import (
+	"errors"
+	"golang-api/entity"
+	"golang-api/util"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// directoryEntry is a user of the stand-in directory
+type directoryEntry struct {
+	dn       string
+	mail     string
+	password string
+	attrs    map[string][]string
+}
+
+// stubDirectory is an in-process stand-in for an LDAP server. It answers simple binds and searches
+// filtering on mail over a net.Pipe, which is all the ldap authenticator uses
+type stubDirectory struct {
+	mu      sync.Mutex
+	entries []directoryEntry
+	down    bool
+	binds   []string
+}
+
+func (directory *stubDirectory) dial(ldapURL string, opts ...ldap.DialOpt) (*ldap.Conn, error) {
+	directory.mu.Lock()
+	down := directory.down
+	directory.mu.Unlock()
+	if down {
+		return nil, errors.New("connection refused")
+	}
+
+	clientConn, serverConn := net.Pipe()
+	go directory.serve(serverConn)
+	conn := ldap.NewConn(clientConn, false)
+	conn.Start()
+	return conn, nil
+}
+
+func (directory *stubDirectory) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		request, err := ber.ReadPacket(conn)
+		if err != nil || len(request.Children) < 2 {
+			return
+		}
+		messageID := request.Children[0].Value.(int64)
+		operation := request.Children[1]
+
+		var responses []*ber.Packet
+		switch operation.Tag {
+		case ldap.ApplicationBindRequest:
+			responses = append(responses, ldapResult(ldap.ApplicationBindResponse, directory.bind(operation)))
+		case ldap.ApplicationSearchRequest:
+			responses = directory.search(operation)
+		default:
+			// Unbind, the client closes the connection next
+			return
+		}
+
+		for _, response := range responses {
+			envelope := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+			envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+			envelope.AppendChild(response)
+			if _, err := conn.Write(envelope.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (directory *stubDirectory) bind(operation *ber.Packet) uint16 {
+	dn := operation.Children[1].Data.String()
+	password := operation.Children[2].Data.String()
+
+	directory.mu.Lock()
+	defer directory.mu.Unlock()
+	directory.binds = append(directory.binds, dn)
+	for _, entry := range directory.entries {
+		if entry.dn == dn && entry.password == password {
+			return ldap.LDAPResultSuccess
+		}
+	}
+	return ldap.LDAPResultInvalidCredentials
+}
+
+func (directory *stubDirectory) search(operation *ber.Packet) []*ber.Packet {
+	filter, err := ldap.DecompileFilter(operation.Children[6])
+	if err != nil {
+		return []*ber.Packet{ldapResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError)}
+	}
+
+	directory.mu.Lock()
+	defer directory.mu.Unlock()
+	var responses []*ber.Packet
+	for _, entry := range directory.entries {
+		if !strings.Contains(filter, "(mail="+entry.mail+")") {
+			continue
+		}
+		result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+		result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, "DN"))
+		attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+		for name, values := range entry.attrs {
+			attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+			attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+			set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+			for _, value := range values {
+				set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+			}
+			attribute.AppendChild(set)
+			attributes.AppendChild(attribute)
+		}
+		result.AppendChild(attributes)
+		responses = append(responses, result)
+	}
+	return append(responses, ldapResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+}
+
+func ldapResult(tag ber.Tag, resultCode uint16) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(resultCode), "Result Code"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	return result
+}
+
+const operatorsGroup = "cn=operators,ou=groups,dc=example,dc=com"
+
+func newStubDirectory() *stubDirectory {
+	return &stubDirectory{entries: []directoryEntry{{
+		dn:       "uid=alice,ou=people,dc=example,dc=com",
+		mail:     "alice@example.com",
+		password: "directory-secret",
+		attrs: map[string][]string{
+			"givenName": {"Alice"},
+			"sn":        {"Liddell"},
+			"memberOf":  {operatorsGroup},
+		},
+	}}}
+}
+
+func ldapTestConfig() util.Config {
+	return util.Config{
+		LDAPURL:        "ldap://directory.test",
+		LDAPBaseDN:     "dc=example,dc=com",
+		LDAPUserFilter: "(&(objectClass=person)(mail=%s))",
+		LDAPGroupRoles: operatorsGroup + "=>" + entity.RoleOperator,
+	}
+}
+
+func newTestLDAPAuthenticator(t *testing.T, userRepository entity.UserRepository, directory *stubDirectory) Authenticator {
+	t.Helper()
+	authenticator, err := NewLDAPAuthenticator(userRepository, fakeRoleRepository{}, directory.dial, ldapTestConfig())
+	if err != nil {
+		t.Fatalf("NewLDAPAuthenticator: %v", err)
+	}
+	return authenticator
+}
+
+func TestLDAPAuthenticatorCreatesTheUserOnFirstLogin(t *testing.T) {
+	userRepository := newFakeUserRepository()
+	authenticator := newTestLDAPAuthenticator(t, userRepository, newStubDirectory())
+
+	user, err := authenticator.Authenticate("alice@example.com", "directory-secret")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if user.FirstName != "Alice" || user.LastName != "Liddell" || user.Role != entity.RoleOperator {
+		t.Errorf("user = %+v, want Alice Liddell with the mapped operator role", user)
+	}
+	if user.Password != "" || user.EmailVerifiedAt == nil {
+		t.Errorf("directory users have no local password and a verified email, got %+v", user)
+	}
+	if userRepository.count() != 1 {
+		t.Errorf("%d local users, want 1", userRepository.count())
+	}
+}
+
+func TestLDAPAuthenticatorRejectsInvalidCredentials(t *testing.T) {
+	directory := newStubDirectory()
+	authenticator := newTestLDAPAuthenticator(t, newFakeUserRepository(), directory)
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+	}{
+		{"wrong password", "alice@example.com", "wrong"},
+		{"unknown user", "bob@example.com", "directory-secret"},
+		{"empty password", "alice@example.com", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := authenticator.Authenticate(test.email, test.password); !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("err = %v, want ErrInvalidCredentials", err)
+			}
+		})
+	}
+
+	// An empty password would be an unauthenticated bind, it must never reach the directory
+	for _, dn := range directory.binds {
+		if dn == "" {
+			t.Errorf("anonymous bind sent to the directory")
+		}
+	}
+}
+
+func TestLDAPAuthenticatorRejectsUnmappedGroups(t *testing.T) {
+	directory := newStubDirectory()
+	directory.entries[0].attrs["memberOf"] = []string{"cn=guests,ou=groups,dc=example,dc=com"}
+	authenticator := newTestLDAPAuthenticator(t, newFakeUserRepository(), directory)
+
+	if _, err := authenticator.Authenticate("alice@example.com", "directory-secret"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("err = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestLDAPAuthenticatorUnavailable(t *testing.T) {
+	directory := newStubDirectory()
+	directory.down = true
+	authenticator := newTestLDAPAuthenticator(t, newFakeUserRepository(), directory)
+
+	if _, err := authenticator.Authenticate("alice@example.com", "directory-secret"); !errors.Is(err, ErrLDAPUnavailable) {
+		t.Errorf("err = %v, want ErrLDAPUnavailable", err)
+	}
+}
+
+func TestChainAuthenticator(t *testing.T) {
+	passwordHashers, err := util.NewPasswordHasherRegistry(util.Config{PasswordHashAlgorithm: util.PasswordHashBcrypt, BcryptCost: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	localHash, err := passwordHashers.Hash("local-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		email         string
+		password      string
+		directoryDown bool
+		wantErr       error
+	}{
+		{"local password", "carol@example.com", "local-secret", false, nil},
+		{"directory password", "alice@example.com", "directory-secret", false, nil},
+		{"wrong password", "carol@example.com", "wrong", false, ErrInvalidCredentials},
+		{"local password while the directory is down", "carol@example.com", "local-secret", true, nil},
+		{"wrong local password while the directory is down", "carol@example.com", "wrong", true, ErrInvalidCredentials},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			userRepository := newFakeUserRepository(entity.User{Email: "carol@example.com", Password: localHash})
+			directory := newStubDirectory()
+			directory.down = test.directoryDown
+			authenticator := chainAuthenticator{
+				NewPasswordAuthenticator(userRepository, passwordHashers),
+				newTestLDAPAuthenticator(t, userRepository, directory),
+			}
+
+			user, err := authenticator.Authenticate(test.email, test.password)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("err = %v, want %v", err, test.wantErr)
+			}
+			if err == nil && user.Email != test.email {
+				t.Errorf("logged in as %s, want %s", user.Email, test.email)
+			}
+		})
+	}
+}
+
+type unavailableAuthenticator struct{}
+
+func (unavailableAuthenticator) Authenticate(email string, password string) (*entity.User, error) {
+	return nil, ErrLDAPUnavailable
+}
+
+func TestChainAuthenticatorUnavailableWhenNoBackendChecked(t *testing.T) {
+	authenticator := chainAuthenticator{unavailableAuthenticator{}, unavailableAuthenticator{}}
+
+	if _, err := authenticator.Authenticate("alice@example.com", "directory-secret"); !errors.Is(err, ErrLDAPUnavailable) {
+		t.Errorf("err = %v, want ErrLDAPUnavailable", err)
+	}
+}
+
+func TestPasswordAuthenticatorTimesUnknownUsersLikeWrongPasswords(t *testing.T) {
+	// A cost where a verification clearly stands out from a lookup in the fake repository
+	passwordHashers, err := util.NewPasswordHasherRegistry(util.Config{PasswordHashAlgorithm: util.PasswordHashBcrypt, BcryptCost: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	localHash, err := passwordHashers.Hash("local-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator := NewPasswordAuthenticator(newFakeUserRepository(
+		entity.User{Email: "carol@example.com", Password: localHash},
+		entity.User{Email: "federated@example.com"},
+	), passwordHashers)
+
+	duration := func(email string) time.Duration {
+		start := time.Now()
+		if _, err := authenticator.Authenticate(email, "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("%s: err = %v, want ErrInvalidCredentials", email, err)
+		}
+		return time.Since(start)
+	}
+
+	wrongPassword := duration("carol@example.com")
+	for _, email := range []string{"unknown@example.com", "federated@example.com"} {
+		if elapsed := duration(email); elapsed < wrongPassword/2 {
+			t.Errorf("%s rejected in %s, a wrong password in %s", email, elapsed, wrongPassword)
+		}
+	}
+}
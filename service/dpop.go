@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"golang-api/entity"
+	"golang-api/util"
+	"time"
+)
+
+// defaultDPoPProofLifetime applies when DPOP_PROOF_LIFETIME is not set
+const defaultDPoPProofLifetime = time.Minute
+
+// DPoPService verifies the proofs of possession of RFC 9449. Tokens issued along a proof are bound to its key,
+// clients sending no proof keep getting bearer tokens
+type DPoPService interface {
+	VerifyProof(ctx context.Context, proof string, method string, uri string, accessToken string) (string, error)
+	VerifyBoundProof(ctx context.Context, proof string, method string, uri string, accessToken string, jkt string) error
+}
+
+type dpopService struct {
+	dpopProofRepository entity.DPoPProofRepository
+	config              util.Config
+}
+
+func NewDPoPService(dpopProofRepository entity.DPoPProofRepository, config util.Config) DPoPService {
+	return &dpopService{
+		dpopProofRepository,
+		config,
+	}
+}
+
+// VerifyProof checks the proof made for the request and returns the thumbprint of its key.
+// Each proof is accepted once, errors wrapping util.ErrInvalidDPoPProof are meant for the client
+func (service *dpopService) VerifyProof(ctx context.Context, proof string, method string, uri string, accessToken string) (string, error) {
+	if proof == "" {
+		return "", fmt.Errorf("%w: the DPoP header is required", util.ErrInvalidDPoPProof)
+	}
+
+	lifetime := service.config.DPoPProofLifetime
+	if lifetime == 0 {
+		lifetime = defaultDPoPProofLifetime
+	}
+	dpopProof, err := util.VerifyDPoPProof(proof, method, uri, accessToken, lifetime)
+	if err != nil {
+		return "", err
+	}
+
+	// The proof is accepted until iat + lifetime, the jti only has to be remembered that long
+	unused, err := service.dpopProofRepository.UseDPoPProof(ctx, dpopProof.JKT, dpopProof.JTI, dpopProof.IssuedAt.Add(lifetime))
+	if err != nil {
+		return "", err
+	}
+	if !unused {
+		return "", fmt.Errorf("%w: the proof was already used", util.ErrInvalidDPoPProof)
+	}
+	return dpopProof.JKT, nil
+}
+
+// VerifyBoundProof checks the proof sent along an access token bound to the key of jkt.
+// It must be made for the request and the token, and signed with that key
+func (service *dpopService) VerifyBoundProof(ctx context.Context, proof string, method string, uri string, accessToken string, jkt string) error {
+	proofJKT, err := service.VerifyProof(ctx, proof, method, uri, accessToken)
+	if err != nil {
+		return err
+	}
+	if proofJKT != jkt {
+		return fmt.Errorf("%w: the proof is not signed with the key the token is bound to", util.ErrInvalidDPoPProof)
+	}
+	return nil
+}
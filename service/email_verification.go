@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang-api/entity"
+	"golang-api/mailer"
+	"golang-api/util"
+	"log"
+	"strconv"
+	"time"
+)
+
+// ErrEmailInUse is returned when changing to an email that already belongs to a user
+var ErrEmailInUse = errors.New("email is already in use")
+
+type EmailVerificationService interface {
+	SendVerification(ctx context.Context, user entity.User) error
+	ResendVerification(ctx context.Context, email string) error
+	RequestEmailChange(ctx context.Context, user entity.User, email string) error
+	VerifyEmail(ctx context.Context, verificationToken string) error
+}
+
+type emailVerificationService struct {
+	userRepository          entity.UserRepository
+	oneTimeTokenRepository  entity.OneTimeTokenRepository
+	securityEventRepository entity.SecurityEventRepository
+	authService             AuthService
+	mailer                  mailer.Mailer
+	config                  util.Config
+}
+
+func NewEmailVerificationService(userRepository entity.UserRepository, oneTimeTokenRepository entity.OneTimeTokenRepository, securityEventRepository entity.SecurityEventRepository, authService AuthService, mailer mailer.Mailer, config util.Config) EmailVerificationService {
+	return &emailVerificationService{
+		userRepository,
+		oneTimeTokenRepository,
+		securityEventRepository,
+		authService,
+		mailer,
+		config,
+	}
+}
+
+// SendVerification mails a verification link for the current email of the user
+func (service *emailVerificationService) SendVerification(ctx context.Context, user entity.User) error {
+	return service.sendVerification(ctx, user, user.Email)
+}
+
+// ResendVerification mails a new link to an unverified user. Like ForgotPassword, it tells nothing about which accounts exist
+func (service *emailVerificationService) ResendVerification(ctx context.Context, email string) error {
+	user, err := service.userRepository.GetUserByEmail(email)
+	if err != nil || user.EmailVerifiedAt != nil {
+		return nil
+	}
+	return service.SendVerification(ctx, *user)
+}
+
+// RequestEmailChange keeps the current email until the new one is verified, as the email keys the tokens and sessions of the user
+func (service *emailVerificationService) RequestEmailChange(ctx context.Context, user entity.User, email string) error {
+	if _, err := service.userRepository.GetUserByEmail(email); err == nil {
+		return ErrEmailInUse
+	}
+
+	user.PendingEmail = email
+	if err := service.userRepository.UpdateUserEmail(user); err != nil {
+		return err
+	}
+	return service.sendVerification(ctx, user, email)
+}
+
+// VerifyEmail marks the address of the token as verified, switching the user to it if it was a pending change.
+// Sessions of the previous email are revoked, as tokens are bound to it
+func (service *emailVerificationService) VerifyEmail(ctx context.Context, verificationToken string) error {
+	token, err := service.oneTimeTokenRepository.ConsumeOneTimeToken(ctx, entity.OneTimeTokenEmailVerification, util.HashToken(verificationToken))
+	if err != nil {
+		return err
+	}
+
+	userID, err := strconv.ParseUint(token.Subject, 10, 64)
+	if err != nil {
+		return entity.ErrOneTimeTokenNotFound
+	}
+	user, err := service.userRepository.GetUserByID(uint(userID))
+	if err != nil {
+		return entity.ErrOneTimeTokenNotFound
+	}
+
+	verifiedAt := time.Now()
+	email := token.Data["email"]
+	switch email {
+	case user.Email:
+		user.EmailVerifiedAt = &verifiedAt
+		return service.userRepository.UpdateUserEmail(*user)
+	case user.PendingEmail:
+		if _, err := service.userRepository.GetUserByEmail(email); err == nil {
+			return ErrEmailInUse
+		}
+
+		previousEmail := user.Email
+		user.Email = email
+		user.PendingEmail = ""
+		user.EmailVerifiedAt = &verifiedAt
+		if err := service.userRepository.UpdateUserEmail(*user); err != nil {
+			return err
+		}
+
+		securityEvent := entity.SecurityEvent{
+			Type:      entity.SecurityEventEmailChanged,
+			UserEmail: email,
+			Details:   fmt.Sprintf("previous=%s", previousEmail),
+		}
+		if err := service.securityEventRepository.CreateSecurityEvent(securityEvent); err != nil {
+			log.Printf("Failed to record security event %s for %s: %v\n", securityEvent.Type, securityEvent.UserEmail, err)
+		}
+		return service.authService.Revoke(ctx, previousEmail)
+	default:
+		// The email was changed again since the link was sent
+		return entity.ErrOneTimeTokenNotFound
+	}
+}
+
+func (service *emailVerificationService) sendVerification(ctx context.Context, user entity.User, email string) error {
+	verificationToken, err := util.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	err = service.oneTimeTokenRepository.SetOneTimeToken(ctx, entity.OneTimeToken{
+		Purpose:   entity.OneTimeTokenEmailVerification,
+		TokenHash: util.HashToken(verificationToken),
+		// The user ID, as the email may change before the link is followed
+		Subject:   strconv.FormatUint(uint64(user.ID), 10),
+		Data:      map[string]string{"email": email},
+		ExpiresAt: time.Now().Add(service.config.EmailVerificationDuration),
+	})
+	if err != nil {
+		return err
+	}
+
+	message := mailer.Message{
+		To:      email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Hi %s,\n\nFollow this link to verify your email address:\n\n%s\n\nThe link expires in %s.\n",
+			user.FirstName, tokenLink(service.config.EmailVerificationURL, verificationToken), service.config.EmailVerificationDuration),
+	}
+	go func() {
+		if err := service.mailer.Send(context.Background(), message); err != nil {
+			log.Printf("Failed to send verification email to %s: %v\n", message.To, err)
+		}
+	}()
+	return nil
+}
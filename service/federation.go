@@ -0,0 +1,316 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"golang-api/dto"
+	"golang-api/entity"
+	"golang-api/util"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Different types of error returned by the FederationService
+var (
+	ErrUnknownFederatedProvider = errors.New("unknown identity provider")
+	ErrInvalidFederatedState    = errors.New("invalid or expired login, please start again")
+	ErrFederatedEmailRequired   = errors.New("the identity provider did not share a verified email")
+	ErrFederatedEmailInUse      = errors.New("an account already uses this email without having verified it, log in and link the identity from the account")
+	ErrFederatedIdentityInUse   = errors.New("the identity is linked to another account")
+	ErrLastLoginMethod          = errors.New("the account has no password, set one before unlinking its last identity")
+)
+
+// federatedHTTPTimeout bounds each request made to an upstream provider
+const federatedHTTPTimeout = 10 * time.Second
+
+// maxNameLength is the size of the name columns of users
+const maxNameLength = 32
+
+// FederatedLogin is the outcome of a callback from an upstream provider.
+// Linked is set when the identity was linked to a logged in user rather than used to log in
+type FederatedLogin struct {
+	User     *entity.User
+	Identity *entity.FederatedIdentity
+	Linked   bool
+}
+
+type FederationService interface {
+	GetProviders() *dto.FederatedProvidersResponse
+	StartLogin(ctx context.Context, provider string) (string, error)
+	StartLink(ctx context.Context, provider string, userID uint) (string, error)
+	Callback(ctx context.Context, provider string, code string, state string) (*FederatedLogin, error)
+	GetIdentities(userID uint) (*dto.FederatedIdentitiesResponse, error)
+	UnlinkIdentity(userID uint, ID uint) error
+}
+
+type federationService struct {
+	clients                     map[string]*util.FederatedOIDCClient
+	userRepository              entity.UserRepository
+	federatedIdentityRepository entity.FederatedIdentityRepository
+	oneTimeTokenRepository      entity.OneTimeTokenRepository
+	securityEventRepository     entity.SecurityEventRepository
+	config                      util.Config
+}
+
+func NewFederationService(userRepository entity.UserRepository, federatedIdentityRepository entity.FederatedIdentityRepository, oneTimeTokenRepository entity.OneTimeTokenRepository, securityEventRepository entity.SecurityEventRepository, config util.Config) FederationService {
+	httpClient := &http.Client{Timeout: federatedHTTPTimeout}
+	clients := make(map[string]*util.FederatedOIDCClient, len(config.FederatedProviders))
+	for _, provider := range config.FederatedProviders {
+		redirectURI := config.OIDCIssuer + "/api/v1/auth/federated/" + provider.Name + "/callback"
+		clients[provider.Name] = util.NewFederatedOIDCClient(provider, redirectURI, httpClient)
+	}
+
+	return &federationService{
+		clients,
+		userRepository,
+		federatedIdentityRepository,
+		oneTimeTokenRepository,
+		securityEventRepository,
+		config,
+	}
+}
+
+func (service *federationService) GetProviders() *dto.FederatedProvidersResponse {
+	providers := []string{}
+	for _, provider := range service.config.FederatedProviders {
+		providers = append(providers, provider.Name)
+	}
+	return &dto.FederatedProvidersResponse{Providers: providers}
+}
+
+// StartLogin returns the authorization URL of the provider for a login
+func (service *federationService) StartLogin(ctx context.Context, provider string) (string, error) {
+	return service.start(ctx, provider, 0)
+}
+
+// StartLink returns the authorization URL of the provider to link the identity to the user
+func (service *federationService) StartLink(ctx context.Context, provider string, userID uint) (string, error) {
+	return service.start(ctx, provider, userID)
+}
+
+// start remembers the nonce and PKCE verifier of the flow under the state, which the callback must bring back
+func (service *federationService) start(ctx context.Context, provider string, userID uint) (string, error) {
+	client, ok := service.clients[provider]
+	if !ok {
+		return "", ErrUnknownFederatedProvider
+	}
+
+	state, err := util.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := util.GenerateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	codeVerifier, err := util.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	data := map[string]string{
+		"nonce":         nonce,
+		"code_verifier": codeVerifier,
+	}
+	if userID != 0 {
+		data["user_id"] = strconv.FormatUint(uint64(userID), 10)
+	}
+	err = service.oneTimeTokenRepository.SetOneTimeToken(ctx, entity.OneTimeToken{
+		Purpose:   entity.OneTimeTokenFederatedLogin,
+		TokenHash: util.HashToken(state),
+		Subject:   provider,
+		Data:      data,
+		ExpiresAt: time.Now().Add(service.config.FederatedLoginDuration),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return client.AuthorizationURL(ctx, state, nonce, codeChallengeS256(codeVerifier))
+}
+
+// Callback exchanges the code of the provider and returns the user of the identity. Unknown identities
+// are linked to the user who started the flow or the account of their verified email, or get a new user
+func (service *federationService) Callback(ctx context.Context, provider string, code string, state string) (*FederatedLogin, error) {
+	client, ok := service.clients[provider]
+	if !ok {
+		return nil, ErrUnknownFederatedProvider
+	}
+
+	login, err := service.oneTimeTokenRepository.ConsumeOneTimeToken(ctx, entity.OneTimeTokenFederatedLogin, util.HashToken(state))
+	if errors.Is(err, entity.ErrOneTimeTokenNotFound) {
+		return nil, ErrInvalidFederatedState
+	}
+	if err != nil {
+		return nil, err
+	}
+	if login.Subject != provider {
+		return nil, ErrInvalidFederatedState
+	}
+
+	claims, err := client.Exchange(ctx, code, login.Data["code_verifier"], login.Data["nonce"])
+	if err != nil {
+		return nil, err
+	}
+
+	if userID := login.Data["user_id"]; userID != "" {
+		linkUserID, err := strconv.ParseUint(userID, 10, 64)
+		if err != nil {
+			return nil, ErrInvalidFederatedState
+		}
+		return service.link(provider, claims, uint(linkUserID))
+	}
+
+	federatedIdentity, err := service.federatedIdentityRepository.GetFederatedIdentity(provider, claims.Subject)
+	if errors.Is(err, entity.ErrFederatedIdentityNotFound) {
+		return service.createUser(provider, claims)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := service.userRepository.GetUserByID(federatedIdentity.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if service.config.RequireEmailVerification && user.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+	return &FederatedLogin{User: user, Identity: federatedIdentity}, nil
+}
+
+func (service *federationService) link(provider string, claims *util.FederatedClaims, userID uint) (*FederatedLogin, error) {
+	user, err := service.userRepository.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	federatedIdentity, err := service.federatedIdentityRepository.GetFederatedIdentity(provider, claims.Subject)
+	if err == nil {
+		if federatedIdentity.UserID != userID {
+			return nil, ErrFederatedIdentityInUse
+		}
+		return &FederatedLogin{User: user, Identity: federatedIdentity, Linked: true}, nil
+	}
+	if !errors.Is(err, entity.ErrFederatedIdentityNotFound) {
+		return nil, err
+	}
+
+	federatedIdentity, err = service.createIdentity(provider, claims, user)
+	if err != nil {
+		return nil, err
+	}
+	return &FederatedLogin{User: user, Identity: federatedIdentity, Linked: true}, nil
+}
+
+// createUser creates the user of a new identity just in time. An existing account with the email gets the identity
+// linked when it verified the email too, otherwise its owner has to log in and link the identity
+func (service *federationService) createUser(provider string, claims *util.FederatedClaims) (*FederatedLogin, error) {
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, ErrFederatedEmailRequired
+	}
+	if user, err := service.userRepository.GetUserByEmail(claims.Email); err == nil {
+		// Anyone can register an email they do not own, only a verified one proves the provider's user owns the account
+		if user.EmailVerifiedAt == nil {
+			return nil, ErrFederatedEmailInUse
+		}
+		federatedIdentity, err := service.createIdentity(provider, claims, user)
+		if err != nil {
+			return nil, err
+		}
+		return &FederatedLogin{User: user, Identity: federatedIdentity}, nil
+	}
+
+	// Federated users have no password until they set one through a password reset
+	verifiedAt := time.Now()
+	user, err := service.userRepository.CreateUser(entity.User{
+		FirstName:       truncateName(claims.GivenName),
+		LastName:        truncateName(claims.FamilyName),
+		Email:           claims.Email,
+		Role:            entity.RoleMember,
+		EmailVerifiedAt: &verifiedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	federatedIdentity, err := service.createIdentity(provider, claims, user)
+	if err != nil {
+		return nil, err
+	}
+	return &FederatedLogin{User: user, Identity: federatedIdentity}, nil
+}
+
+func (service *federationService) createIdentity(provider string, claims *util.FederatedClaims, user *entity.User) (*entity.FederatedIdentity, error) {
+	federatedIdentity, err := service.federatedIdentityRepository.CreateFederatedIdentity(entity.FederatedIdentity{
+		UserID:   user.ID,
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	})
+	if err != nil {
+		return nil, err
+	}
+	service.recordSecurityEvent(entity.SecurityEventIdentityLinked, user.Email, provider)
+	return federatedIdentity, nil
+}
+
+func (service *federationService) GetIdentities(userID uint) (*dto.FederatedIdentitiesResponse, error) {
+	federatedIdentities, err := service.federatedIdentityRepository.GetFederatedIdentities(userID)
+	if err != nil {
+		return nil, err
+	}
+	return dto.NewFederatedIdentitiesResponse(federatedIdentities), nil
+}
+
+// UnlinkIdentity removes an identity of the user, unless it is the only way left to log in
+func (service *federationService) UnlinkIdentity(userID uint, ID uint) error {
+	federatedIdentities, err := service.federatedIdentityRepository.GetFederatedIdentities(userID)
+	if err != nil {
+		return err
+	}
+	var federatedIdentity *entity.FederatedIdentity
+	for i := range federatedIdentities {
+		if federatedIdentities[i].ID == ID {
+			federatedIdentity = &federatedIdentities[i]
+		}
+	}
+	if federatedIdentity == nil {
+		return entity.ErrFederatedIdentityNotFound
+	}
+
+	user, err := service.userRepository.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if len(federatedIdentities) == 1 && user.Password == "" {
+		return ErrLastLoginMethod
+	}
+
+	if err := service.federatedIdentityRepository.DeleteFederatedIdentity(userID, ID); err != nil {
+		return err
+	}
+	service.recordSecurityEvent(entity.SecurityEventIdentityUnlinked, user.Email, federatedIdentity.Provider)
+	return nil
+}
+
+func (service *federationService) recordSecurityEvent(eventType string, email string, provider string) {
+	securityEvent := entity.SecurityEvent{
+		Type:      eventType,
+		UserEmail: email,
+		Details:   "provider=" + provider,
+	}
+	if err := service.securityEventRepository.CreateSecurityEvent(securityEvent); err != nil {
+		log.Printf("Failed to record security event %s for %s: %v\n", eventType, email, err)
+	}
+}
+
+func truncateName(name string) string {
+	runes := []rune(name)
+	if len(runes) > maxNameLength {
+		return string(runes[:maxNameLength])
+	}
+	return name
+}
@@ -0,0 +1,401 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"golang-api/entity"
+	"golang-api/util"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	mockProviderClientID     = "golang-api"
+	mockProviderClientSecret = "mock-provider-secret"
+)
+
+// upstreamAccount is the user logging in at the mock provider
+type upstreamAccount struct {
+	subject       string
+	email         string
+	emailVerified bool
+}
+
+type mockAuthorization struct {
+	account       upstreamAccount
+	nonce         string
+	codeChallenge string
+	redirectURI   string
+}
+
+// mockOIDCProvider is an in-process OpenID Connect provider serving discovery, its keys, an authorization
+// endpoint that logs in account right away and a token endpoint that checks the client, code and PKCE verifier
+type mockOIDCProvider struct {
+	server     *httptest.Server
+	signingKey *util.SigningKey
+
+	mu             sync.Mutex
+	account        upstreamAccount
+	authorizations map[string]mockAuthorization
+	// tamper, when set, edits the ID token claims before they are signed
+	tamper func(claims jwt.MapClaims)
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	t.Helper()
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &mockOIDCProvider{
+		signingKey: &util.SigningKey{
+			ID:         "mock-key",
+			Method:     jwt.SigningMethodRS256,
+			PrivateKey: privateKey,
+			PublicKey:  &privateKey.PublicKey,
+		},
+		authorizations: map[string]mockAuthorization{},
+	}
+
+	router := http.NewServeMux()
+	router.HandleFunc("/.well-known/openid-configuration", provider.discovery)
+	router.HandleFunc("/jwks", provider.jwks)
+	router.HandleFunc("/authorize", provider.authorize)
+	router.HandleFunc("/token", provider.token)
+	provider.server = httptest.NewServer(router)
+	t.Cleanup(provider.server.Close)
+	return provider
+}
+
+func (provider *mockOIDCProvider) discovery(rw http.ResponseWriter, r *http.Request) {
+	writeJSON(rw, http.StatusOK, map[string]string{
+		"issuer":                 provider.server.URL,
+		"authorization_endpoint": provider.server.URL + "/authorize",
+		"token_endpoint":         provider.server.URL + "/token",
+		"jwks_uri":               provider.server.URL + "/jwks",
+	})
+}
+
+func (provider *mockOIDCProvider) jwks(rw http.ResponseWriter, r *http.Request) {
+	jwkSet, err := util.NewJWKSet([]*util.SigningKey{provider.signingKey})
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(rw, http.StatusOK, jwkSet)
+}
+
+// authorize logs the current account in and redirects back with a code, as a browser would be
+func (provider *mockOIDCProvider) authorize(rw http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != mockProviderClientID || query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" {
+		http.Error(rw, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	code, _ := util.GenerateRandomToken(16)
+	provider.mu.Lock()
+	provider.authorizations[code] = mockAuthorization{
+		account:       provider.account,
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+		redirectURI:   query.Get("redirect_uri"),
+	}
+	provider.mu.Unlock()
+
+	redirectURI, _ := url.Parse(query.Get("redirect_uri"))
+	redirectURI.RawQuery = url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+	http.Redirect(rw, r, redirectURI.String(), http.StatusFound)
+}
+
+func (provider *mockOIDCProvider) token(rw http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, _ := r.BasicAuth()
+	if clientID != mockProviderClientID || clientSecret != mockProviderClientSecret {
+		writeJSON(rw, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	provider.mu.Lock()
+	authorization, ok := provider.authorizations[r.PostFormValue("code")]
+	delete(provider.authorizations, r.PostFormValue("code"))
+	tamper := provider.tamper
+	provider.mu.Unlock()
+	if !ok || r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("redirect_uri") != authorization.redirectURI ||
+		codeChallengeS256(r.PostFormValue("code_verifier")) != authorization.codeChallenge {
+		writeJSON(rw, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":            provider.server.URL,
+		"aud":            mockProviderClientID,
+		"sub":            authorization.account.subject,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"nonce":          authorization.nonce,
+		"email":          authorization.account.email,
+		"email_verified": authorization.account.emailVerified,
+		"given_name":     "Alice",
+		"family_name":    "Liddell",
+	}
+	if tamper != nil {
+		tamper(claims)
+	}
+	idToken := jwt.NewWithClaims(provider.signingKey.Method, claims)
+	idToken.Header["kid"] = provider.signingKey.ID
+	signed, err := idToken.SignedString(provider.signingKey.PrivateKey)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(rw, http.StatusOK, map[string]string{"access_token": "upstream-access-token", "token_type": "Bearer", "id_token": signed})
+}
+
+// login has the account log in at the provider through the authorization URL and returns the code and state
+// the provider redirects back with
+func (provider *mockOIDCProvider) login(t *testing.T, authorizationURL string, account upstreamAccount) (string, string) {
+	t.Helper()
+	provider.mu.Lock()
+	provider.account = account
+	provider.mu.Unlock()
+
+	browser := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	response, err := browser.Get(authorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	callbackURL, err := response.Location()
+	if err != nil {
+		t.Fatalf("authorize: status %d: %v", response.StatusCode, err)
+	}
+	return callbackURL.Query().Get("code"), callbackURL.Query().Get("state")
+}
+
+func writeJSON(rw http.ResponseWriter, status int, body interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	json.NewEncoder(rw).Encode(body)
+}
+
+type federationTest struct {
+	provider                    *mockOIDCProvider
+	service                     FederationService
+	userRepository              *fakeUserRepository
+	federatedIdentityRepository *fakeFederatedIdentityRepository
+	securityEventRepository     *fakeSecurityEventRepository
+}
+
+func newFederationTest(t *testing.T, users ...entity.User) *federationTest {
+	t.Helper()
+	provider := newMockOIDCProvider(t)
+	test := &federationTest{
+		provider:                    provider,
+		userRepository:              newFakeUserRepository(users...),
+		federatedIdentityRepository: &fakeFederatedIdentityRepository{},
+		securityEventRepository:     &fakeSecurityEventRepository{},
+	}
+	upstream := util.FederatedProvider{Issuer: provider.server.URL, ClientID: mockProviderClientID, ClientSecret: mockProviderClientSecret}
+	mock, other := upstream, upstream
+	mock.Name, other.Name = "mock", "other"
+	test.service = NewFederationService(test.userRepository, test.federatedIdentityRepository, newFakeOneTimeTokenRepository(), test.securityEventRepository, util.Config{
+		OIDCIssuer:             "https://api.example.com",
+		FederatedLoginDuration: 10 * time.Minute,
+		FederatedProviders:     []util.FederatedProvider{mock, other},
+	})
+	return test
+}
+
+// loginAs runs a whole login through the mock provider
+func (test *federationTest) loginAs(t *testing.T, account upstreamAccount) (*FederatedLogin, error) {
+	t.Helper()
+	authorizationURL, err := test.service.StartLogin(context.Background(), "mock")
+	if err != nil {
+		t.Fatalf("StartLogin: %v", err)
+	}
+	code, state := test.provider.login(t, authorizationURL, account)
+	return test.service.Callback(context.Background(), "mock", code, state)
+}
+
+var alice = upstreamAccount{subject: "upstream-alice", email: "alice@example.com", emailVerified: true}
+
+func TestFederatedLoginCreatesUser(t *testing.T) {
+	test := newFederationTest(t)
+
+	login, err := test.loginAs(t, alice)
+	if err != nil {
+		t.Fatalf("Callback: %v", err)
+	}
+	if login.Linked || login.User.Email != alice.email || login.User.EmailVerifiedAt == nil || login.User.Password != "" {
+		t.Errorf("login = %+v, want a new passwordless user with a verified email", login.User)
+	}
+	if login.Identity.Subject != alice.subject || login.Identity.UserID != login.User.ID {
+		t.Errorf("identity = %+v, want %s linked to user %d", login.Identity, alice.subject, login.User.ID)
+	}
+
+	again, err := test.loginAs(t, alice)
+	if err != nil {
+		t.Fatalf("second Callback: %v", err)
+	}
+	if again.User.ID != login.User.ID || test.userRepository.count() != 1 {
+		t.Errorf("second login as user %d with %d users, want user %d only", again.User.ID, test.userRepository.count(), login.User.ID)
+	}
+}
+
+func TestFederatedLoginRejectsUnverifiedEmail(t *testing.T) {
+	tests := []struct {
+		name    string
+		account upstreamAccount
+	}{
+		{"unverified email", upstreamAccount{subject: "upstream-alice", email: "alice@example.com"}},
+		{"no email", upstreamAccount{subject: "upstream-alice", emailVerified: true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			federation := newFederationTest(t)
+
+			if _, err := federation.loginAs(t, test.account); !errors.Is(err, ErrFederatedEmailRequired) {
+				t.Errorf("err = %v, want ErrFederatedEmailRequired", err)
+			}
+			if federation.userRepository.count() != 0 || len(federation.federatedIdentityRepository.identities) != 0 {
+				t.Errorf("a user or identity was created for an unverified email")
+			}
+		})
+	}
+}
+
+func TestFederatedLoginLinksAccountByVerifiedEmail(t *testing.T) {
+	verifiedAt := time.Now()
+	test := newFederationTest(t, entity.User{Email: alice.email, Password: "local-hash", EmailVerifiedAt: &verifiedAt})
+
+	login, err := test.loginAs(t, alice)
+	if err != nil {
+		t.Fatalf("Callback: %v", err)
+	}
+	if login.Linked || login.User.ID != 1 || login.User.Password != "local-hash" {
+		t.Errorf("logged in as %+v, want the existing user 1", login.User)
+	}
+	if login.Identity.UserID != 1 || test.userRepository.count() != 1 {
+		t.Errorf("identity linked to user %d with %d users, want user 1 only", login.Identity.UserID, test.userRepository.count())
+	}
+	if len(test.securityEventRepository.events) != 1 || test.securityEventRepository.events[0].Type != entity.SecurityEventIdentityLinked {
+		t.Errorf("security events = %+v, want one %s", test.securityEventRepository.events, entity.SecurityEventIdentityLinked)
+	}
+}
+
+func TestFederatedLoginDoesNotLinkUnverifiedEmail(t *testing.T) {
+	tests := []struct {
+		name              string
+		accountVerifiedAt *time.Time
+		account           upstreamAccount
+		wantErr           error
+	}{
+		// Whoever registered the email here may not own it, the owner has to log in and link the identity
+		{"account email unverified", nil, alice, ErrFederatedEmailInUse},
+		{"provider email unverified", new(time.Time), upstreamAccount{subject: alice.subject, email: alice.email}, ErrFederatedEmailRequired},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			federation := newFederationTest(t, entity.User{Email: alice.email, Password: "local-hash", EmailVerifiedAt: test.accountVerifiedAt})
+
+			if _, err := federation.loginAs(t, test.account); !errors.Is(err, test.wantErr) {
+				t.Errorf("err = %v, want %v", err, test.wantErr)
+			}
+			if len(federation.federatedIdentityRepository.identities) != 0 {
+				t.Errorf("identity linked to the account: %+v", federation.federatedIdentityRepository.identities)
+			}
+		})
+	}
+}
+
+func TestFederatedLinkFromAccount(t *testing.T) {
+	test := newFederationTest(t, entity.User{Email: "alice@work.example.com", Password: "local-hash"})
+
+	authorizationURL, err := test.service.StartLink(context.Background(), "mock", 1)
+	if err != nil {
+		t.Fatalf("StartLink: %v", err)
+	}
+	code, state := test.provider.login(t, authorizationURL, alice)
+	login, err := test.service.Callback(context.Background(), "mock", code, state)
+	if err != nil {
+		t.Fatalf("Callback: %v", err)
+	}
+	if !login.Linked || login.Identity.UserID != 1 || login.Identity.Email != alice.email {
+		t.Errorf("login = %+v identity = %+v, want %s linked to user 1", login, login.Identity, alice.email)
+	}
+
+	// The identity now logs in to the account it was linked to
+	again, err := test.loginAs(t, alice)
+	if err != nil {
+		t.Fatalf("login after linking: %v", err)
+	}
+	if again.Linked || again.User.ID != 1 {
+		t.Errorf("logged in as user %d, want 1", again.User.ID)
+	}
+}
+
+func TestFederatedCallbackChecksState(t *testing.T) {
+	test := newFederationTest(t)
+	ctx := context.Background()
+
+	authorizationURL, err := test.service.StartLogin(ctx, "mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := test.provider.login(t, authorizationURL, alice)
+
+	if _, err := test.service.Callback(ctx, "mock", code, "forged-state"); !errors.Is(err, ErrInvalidFederatedState) {
+		t.Errorf("unknown state: err = %v, want ErrInvalidFederatedState", err)
+	}
+	if _, err := test.service.Callback(ctx, "mock", code, state); err != nil {
+		t.Fatalf("Callback: %v", err)
+	}
+	if _, err := test.service.Callback(ctx, "mock", code, state); !errors.Is(err, ErrInvalidFederatedState) {
+		t.Errorf("replayed state: err = %v, want ErrInvalidFederatedState", err)
+	}
+
+	// A state is bound to the provider the login was started with
+	authorizationURL, err = test.service.StartLogin(ctx, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state = test.provider.login(t, authorizationURL, alice)
+	if _, err := test.service.Callback(ctx, "mock", code, state); !errors.Is(err, ErrInvalidFederatedState) {
+		t.Errorf("state of another provider: err = %v, want ErrInvalidFederatedState", err)
+	}
+}
+
+func TestFederatedCallbackChecksIDToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(claims jwt.MapClaims)
+	}{
+		{"nonce of another login", func(claims jwt.MapClaims) { claims["nonce"] = "other-nonce" }},
+		{"no nonce", func(claims jwt.MapClaims) { delete(claims, "nonce") }},
+		{"another issuer", func(claims jwt.MapClaims) { claims["iss"] = "https://idp.example.com" }},
+		{"another audience", func(claims jwt.MapClaims) { claims["aud"] = "another-client" }},
+		{"expired", func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Minute).Unix() }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			federation := newFederationTest(t)
+			federation.provider.tamper = test.tamper
+
+			if _, err := federation.loginAs(t, alice); !errors.Is(err, util.ErrInvalidIDToken) {
+				t.Errorf("err = %v, want ErrInvalidIDToken", err)
+			}
+			if federation.userRepository.count() != 0 {
+				t.Errorf("a user was created from an invalid ID token")
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"golang-api/entity"
+	"golang-api/util"
+	"log"
+	"strings"
+	"time"
+)
+
+// LoginLockedError is returned while an account or a client IP is locked out of /auth/login
+type LoginLockedError struct {
+	RetryAfter time.Duration
+	// HardLocked is set when only an admin can unlock the account
+	HardLocked bool
+}
+
+func (err *LoginLockedError) Error() string {
+	if err.HardLocked {
+		return "too many failed logins, the account is locked until an administrator unlocks it"
+	}
+	return fmt.Sprintf("too many failed logins, retry in %s", err.RetryAfter)
+}
+
+// LoginThrottleService counts failed logins per account and per client IP and locks them out with exponential backoff.
+// Attempts on unknown emails are counted and locked exactly like real accounts, so lockouts reveal nothing
+type LoginThrottleService interface {
+	Check(ctx context.Context, email string, ip string) error
+	RecordFailure(ctx context.Context, email string, ip string) error
+	RecordSuccess(ctx context.Context, email string) error
+	UnlockUser(ctx context.Context, userID uint) error
+}
+
+type loginThrottleService struct {
+	loginAttemptRepository  entity.LoginAttemptRepository
+	userRepository          entity.UserRepository
+	securityEventRepository entity.SecurityEventRepository
+	config                  util.Config
+}
+
+func NewLoginThrottleService(loginAttemptRepository entity.LoginAttemptRepository, userRepository entity.UserRepository, securityEventRepository entity.SecurityEventRepository, config util.Config) LoginThrottleService {
+	return &loginThrottleService{
+		loginAttemptRepository,
+		userRepository,
+		securityEventRepository,
+		config,
+	}
+}
+
+// Check returns a *LoginLockedError if the account or the IP is locked out
+func (service *loginThrottleService) Check(ctx context.Context, email string, ip string) error {
+	now := time.Now()
+	var lockedUntil time.Time
+
+	for _, key := range []string{accountAttemptsKey(email), ipAttemptsKey(ip)} {
+		loginAttempts, err := service.loginAttemptRepository.GetLoginAttempts(ctx, key)
+		if err != nil {
+			return err
+		}
+		if loginAttempts.HardLocked {
+			return &LoginLockedError{RetryAfter: service.config.LoginBackoffMax, HardLocked: true}
+		}
+		if loginAttempts.LockedUntil.After(lockedUntil) {
+			lockedUntil = loginAttempts.LockedUntil
+		}
+	}
+
+	if lockedUntil.After(now) {
+		return &LoginLockedError{RetryAfter: lockedUntil.Sub(now)}
+	}
+	return nil
+}
+
+// RecordFailure counts a failed login. Past the threshold, every failure doubles the lock,
+// and the account is hard locked once LoginHardLockThreshold is reached
+func (service *loginThrottleService) RecordFailure(ctx context.Context, email string, ip string) error {
+	accountKey := accountAttemptsKey(email)
+	failures, err := service.loginAttemptRepository.RecordLoginFailure(ctx, accountKey, service.config.LoginAttemptWindow)
+	if err != nil {
+		return err
+	}
+
+	if service.config.LoginHardLockThreshold > 0 && failures >= service.config.LoginHardLockThreshold {
+		if err := service.loginAttemptRepository.SetLoginHardLock(ctx, accountKey); err != nil {
+			return err
+		}
+		if failures == service.config.LoginHardLockThreshold {
+			service.recordAccountLocked(email, failures)
+		}
+	} else if err := service.lockWithBackoff(ctx, accountKey, failures, service.config.LoginBackoffThreshold); err != nil {
+		return err
+	}
+
+	// A client IP is never hard locked, as it may be shared by many users
+	ipKey := ipAttemptsKey(ip)
+	failures, err = service.loginAttemptRepository.RecordLoginFailure(ctx, ipKey, service.config.LoginAttemptWindow)
+	if err != nil {
+		return err
+	}
+	return service.lockWithBackoff(ctx, ipKey, failures, service.config.LoginIPBackoffThreshold)
+}
+
+// RecordSuccess resets the account counter. The IP counter is kept, a valid account must not clear it for the others
+func (service *loginThrottleService) RecordSuccess(ctx context.Context, email string) error {
+	return service.loginAttemptRepository.ClearLoginAttempts(ctx, accountAttemptsKey(email))
+}
+
+// UnlockUser clears the counter and any lock of the user's account
+func (service *loginThrottleService) UnlockUser(ctx context.Context, userID uint) error {
+	user, err := service.userRepository.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	return service.loginAttemptRepository.ClearLoginAttempts(ctx, accountAttemptsKey(user.Email))
+}
+
+func (service *loginThrottleService) lockWithBackoff(ctx context.Context, key string, failures int64, threshold int64) error {
+	if threshold <= 0 || failures < threshold {
+		return nil
+	}
+	return service.loginAttemptRepository.SetLoginLock(ctx, key, time.Now().Add(service.backoff(failures-threshold)))
+}
+
+// backoff doubles LoginBackoffBase for every failure past the threshold, up to LoginBackoffMax
+func (service *loginThrottleService) backoff(excessFailures int64) time.Duration {
+	backoff := service.config.LoginBackoffBase
+	for i := int64(0); i < excessFailures && backoff < service.config.LoginBackoffMax; i++ {
+		backoff *= 2
+	}
+	if backoff > service.config.LoginBackoffMax {
+		backoff = service.config.LoginBackoffMax
+	}
+	return backoff
+}
+
+func (service *loginThrottleService) recordAccountLocked(email string, failures int64) {
+	securityEvent := entity.SecurityEvent{
+		Type:      entity.SecurityEventAccountLocked,
+		UserEmail: email,
+		Details:   fmt.Sprintf("failures=%d", failures),
+	}
+	if err := service.securityEventRepository.CreateSecurityEvent(securityEvent); err != nil {
+		log.Printf("Failed to record security event %s for %s: %v\n", securityEvent.Type, securityEvent.UserEmail, err)
+	}
+}
+
+func accountAttemptsKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipAttemptsKey(ip string) string {
+	return "ip:" + ip
+}
@@ -0,0 +1,315 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"golang-api/dto"
+	"golang-api/entity"
+	"golang-api/util"
+	"log"
+	"strings"
+	"time"
+)
+
+// Different types of error returned by the MFAService
+var (
+	ErrMFAAlreadyEnabled = errors.New("multi-factor authentication is already enabled")
+	ErrMFANotEnabled     = errors.New("multi-factor authentication is not enabled")
+	ErrMFANotEnrolled    = errors.New("there is no pending TOTP enrollment")
+	ErrInvalidMFACode    = errors.New("invalid authentication code")
+)
+
+const (
+	recoveryCodeCount       = 10
+	mfaChallengeMaxAttempts = 5
+)
+
+type MFAService interface {
+	EnrollTOTP(userID uint) (*dto.TOTPEnrollmentResponse, error)
+	ConfirmTOTP(ctx context.Context, userID uint, code string, ip string) (*dto.RecoveryCodesResponse, error)
+	DisableTOTP(ctx context.Context, userID uint, code string, ip string) error
+	RegenerateRecoveryCodes(ctx context.Context, userID uint, code string, ip string) (*dto.RecoveryCodesResponse, error)
+	CreateChallenge(ctx context.Context, user entity.User, firstFactor string) (*dto.MFAChallengeResponse, error)
+	VerifyChallenge(ctx context.Context, challengeToken string, code string, ip string) (*entity.User, []string, error)
+}
+
+type mfaService struct {
+	userRepository          entity.UserRepository
+	recoveryCodeRepository  entity.RecoveryCodeRepository
+	oneTimeTokenRepository  entity.OneTimeTokenRepository
+	securityEventRepository entity.SecurityEventRepository
+	loginThrottleService    LoginThrottleService
+	config                  util.Config
+}
+
+func NewMFAService(userRepository entity.UserRepository, recoveryCodeRepository entity.RecoveryCodeRepository, oneTimeTokenRepository entity.OneTimeTokenRepository, securityEventRepository entity.SecurityEventRepository, loginThrottleService LoginThrottleService, config util.Config) MFAService {
+	return &mfaService{
+		userRepository,
+		recoveryCodeRepository,
+		oneTimeTokenRepository,
+		securityEventRepository,
+		loginThrottleService,
+		config,
+	}
+}
+
+// EnrollTOTP generates a new secret for the user. It is not enforced until ConfirmTOTP proves the authenticator has it
+func (service *mfaService) EnrollTOTP(userID uint) (*dto.TOTPEnrollmentResponse, error) {
+	user, err := service.userRepository.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := util.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	user.TOTPSecret = secret
+	user.TOTPLastStep = 0
+	if err := service.userRepository.UpdateUserMFA(*user); err != nil {
+		return nil, err
+	}
+
+	return &dto.TOTPEnrollmentResponse{
+		Secret:     secret,
+		OtpauthURI: util.TOTPURI(service.config.MFAIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables the second factor with the first code of the authenticator and returns the recovery codes
+func (service *mfaService) ConfirmTOTP(ctx context.Context, userID uint, code string, ip string) (*dto.RecoveryCodesResponse, error) {
+	user, err := service.userRepository.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrMFANotEnrolled
+	}
+
+	if err := service.verifyThrottledCode(ctx, user, code, false, ip); err != nil {
+		return nil, err
+	}
+
+	user.TOTPEnabled = true
+	if err := service.userRepository.UpdateUserMFA(*user); err != nil {
+		return nil, err
+	}
+	service.recordSecurityEvent(entity.SecurityEventMFAEnabled, user.Email)
+
+	return service.issueRecoveryCodes(user)
+}
+
+// DisableTOTP removes the second factor, proven with a TOTP or recovery code
+func (service *mfaService) DisableTOTP(ctx context.Context, userID uint, code string, ip string) error {
+	user, err := service.userRepository.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return ErrMFANotEnabled
+	}
+
+	if err := service.verifyThrottledCode(ctx, user, code, true, ip); err != nil {
+		return err
+	}
+
+	user.TOTPSecret = ""
+	user.TOTPEnabled = false
+	user.TOTPLastStep = 0
+	if err := service.userRepository.UpdateUserMFA(*user); err != nil {
+		return err
+	}
+	if err := service.recoveryCodeRepository.DeleteRecoveryCodes(user.ID); err != nil {
+		return err
+	}
+	service.recordSecurityEvent(entity.SecurityEventMFADisabled, user.Email)
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces every recovery code of the user, proven with a TOTP code
+func (service *mfaService) RegenerateRecoveryCodes(ctx context.Context, userID uint, code string, ip string) (*dto.RecoveryCodesResponse, error) {
+	user, err := service.userRepository.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TOTPEnabled {
+		return nil, ErrMFANotEnabled
+	}
+
+	if err := service.verifyThrottledCode(ctx, user, code, false, ip); err != nil {
+		return nil, err
+	}
+	return service.issueRecoveryCodes(user)
+}
+
+// CreateChallenge starts the second step of a login, once the first factor was checked.
+// firstFactor is its authentication method, util.AMRPassword or util.AMRFederated
+func (service *mfaService) CreateChallenge(ctx context.Context, user entity.User, firstFactor string) (*dto.MFAChallengeResponse, error) {
+	challengeToken, err := util.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(service.config.MFAChallengeDuration)
+	err = service.oneTimeTokenRepository.SetOneTimeToken(ctx, entity.OneTimeToken{
+		Purpose:   entity.OneTimeTokenMFAChallenge,
+		TokenHash: util.HashToken(challengeToken),
+		Subject:   user.Email,
+		Data:      map[string]string{"amr": firstFactor},
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.MFAChallengeResponse{
+		MFARequired:        true,
+		ChallengeToken:     challengeToken,
+		ChallengeExpiresAt: expiresAt,
+	}, nil
+}
+
+// VerifyChallenge completes a login with a TOTP or recovery code and returns the authenticated user,
+// along with the authentication methods of both steps. A challenge is single-use and is discarded after too many wrong codes
+func (service *mfaService) VerifyChallenge(ctx context.Context, challengeToken string, code string, ip string) (*entity.User, []string, error) {
+	tokenHash := util.HashToken(challengeToken)
+	challenge, err := service.oneTimeTokenRepository.GetOneTimeToken(ctx, entity.OneTimeTokenMFAChallenge, tokenHash)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := service.userRepository.GetUserByEmail(challenge.Subject)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := service.verifyThrottledCode(ctx, user, code, true, ip); err != nil {
+		var lockedErr *LoginLockedError
+		if errors.As(err, &lockedErr) {
+			return nil, nil, err
+		}
+		attempts, attemptsErr := service.oneTimeTokenRepository.IncrementOneTimeTokenAttempts(ctx, entity.OneTimeTokenMFAChallenge, tokenHash)
+		if attemptsErr == nil && attempts >= mfaChallengeMaxAttempts {
+			service.oneTimeTokenRepository.ConsumeOneTimeToken(ctx, entity.OneTimeTokenMFAChallenge, tokenHash)
+		}
+		return nil, nil, err
+	}
+
+	if _, err := service.oneTimeTokenRepository.ConsumeOneTimeToken(ctx, entity.OneTimeTokenMFAChallenge, tokenHash); err != nil {
+		return nil, nil, err
+	}
+
+	// The login is only complete now, the failed logins are reset with the second factor
+	if err := service.loginThrottleService.RecordSuccess(ctx, user.Email); err != nil {
+		log.Printf("Failed to reset failed logins of %s: %v\n", user.Email, err)
+	}
+
+	// Challenges created before the first factor was recorded all followed a password
+	firstFactor := challenge.Data["amr"]
+	if firstFactor == "" {
+		firstFactor = util.AMRPassword
+	}
+	return user, []string{firstFactor, util.AMROneTimePassword}, nil
+}
+
+// verifyThrottledCode verifies the code under the login throttle of the user and the client IP. Codes are throttled
+// with the passwords, so neither fresh challenges nor the account endpoints make the second factor guessable.
+// A valid code does not reset the failed logins, only a completed login does
+func (service *mfaService) verifyThrottledCode(ctx context.Context, user *entity.User, code string, allowRecoveryCode bool, ip string) error {
+	if err := service.loginThrottleService.Check(ctx, user.Email, ip); err != nil {
+		return err
+	}
+
+	err := service.verifyCode(user, code, allowRecoveryCode)
+	if errors.Is(err, ErrInvalidMFACode) {
+		if err := service.loginThrottleService.RecordFailure(ctx, user.Email, ip); err != nil {
+			log.Printf("Failed to record failed login of %s from %s: %v\n", user.Email, ip, err)
+		}
+	}
+	return err
+}
+
+// verifyCode accepts a TOTP code whose time step was not used yet, or an unused recovery code if allowRecoveryCode
+func (service *mfaService) verifyCode(user *entity.User, code string, allowRecoveryCode bool) error {
+	if step, ok := util.ValidateTOTP(user.TOTPSecret, code, time.Now()); ok {
+		err := service.userRepository.UseTOTPStep(user.ID, step)
+		if errors.Is(err, entity.ErrTOTPStepUsed) {
+			return ErrInvalidMFACode
+		}
+		if err != nil {
+			return err
+		}
+		user.TOTPLastStep = step
+		return nil
+	}
+
+	if !allowRecoveryCode {
+		return ErrInvalidMFACode
+	}
+
+	err := service.recoveryCodeRepository.UseRecoveryCode(user.ID, hashRecoveryCode(user.ID, code))
+	if errors.Is(err, entity.ErrRecoveryCodeInvalid) {
+		return ErrInvalidMFACode
+	}
+	if err != nil {
+		return err
+	}
+	service.recordSecurityEvent(entity.SecurityEventRecoveryCodeUsed, user.Email)
+	return nil
+}
+
+func (service *mfaService) issueRecoveryCodes(user *entity.User) (*dto.RecoveryCodesResponse, error) {
+	recoveryCodes := make([]string, 0, recoveryCodeCount)
+	codeHashes := make([]string, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		recoveryCode, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		recoveryCodes = append(recoveryCodes, recoveryCode)
+		codeHashes = append(codeHashes, hashRecoveryCode(user.ID, recoveryCode))
+	}
+
+	if err := service.recoveryCodeRepository.ReplaceRecoveryCodes(user.ID, codeHashes); err != nil {
+		return nil, err
+	}
+	service.recordSecurityEvent(entity.SecurityEventRecoveryCodesIssued, user.Email)
+
+	return &dto.RecoveryCodesResponse{RecoveryCodes: recoveryCodes}, nil
+}
+
+func (service *mfaService) recordSecurityEvent(eventType string, email string) {
+	securityEvent := entity.SecurityEvent{
+		Type:      eventType,
+		UserEmail: email,
+	}
+	if err := service.securityEventRepository.CreateSecurityEvent(securityEvent); err != nil {
+		log.Printf("Failed to record security event %s for %s: %v\n", eventType, email, err)
+	}
+}
+
+// generateRecoveryCode returns 50 random bits formatted as xxxxx-xxxxx
+func generateRecoveryCode() (string, error) {
+	random := make([]byte, 7)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(random))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// hashRecoveryCode normalizes the code as users may type it and salts it with the user ID
+func hashRecoveryCode(userID uint, code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	return util.HashToken(fmt.Sprintf("%d:%s", userID, normalized))
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"golang-api/entity"
+	"golang-api/util"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testTOTPSecret = "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+
+// totpCode computes the RFC 6238 code of testTOTPSecret at t, independently of util.ValidateTOTP
+func totpCode(t *testing.T, at time.Time) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(testTOTPSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, uint64(at.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff)%1000000)
+}
+
+func newTestMFAService(t *testing.T, backoffThreshold int64) (MFAService, *fakeUserRepository, *entity.User) {
+	t.Helper()
+	userRepository := newFakeUserRepository()
+	user, _ := userRepository.CreateUser(entity.User{Email: "alice@example.com", TOTPSecret: testTOTPSecret, TOTPEnabled: true})
+	config := util.Config{
+		LoginAttemptWindow:    time.Hour,
+		LoginBackoffThreshold: backoffThreshold,
+		LoginBackoffBase:      time.Minute,
+		LoginBackoffMax:       time.Hour,
+	}
+	securityEventRepository := &fakeSecurityEventRepository{}
+	loginThrottleService := NewLoginThrottleService(newFakeLoginAttemptRepository(), userRepository, securityEventRepository, config)
+	service := NewMFAService(userRepository, newFakeRecoveryCodeRepository(), newFakeOneTimeTokenRepository(), securityEventRepository, loginThrottleService, config)
+	return service, userRepository, user
+}
+
+func TestMFAAccountEndpointsAreThrottled(t *testing.T) {
+	service, _, user := newTestMFAService(t, 3)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := service.RegenerateRecoveryCodes(ctx, user.ID, "000000", "192.0.2.1"); !errors.Is(err, ErrInvalidMFACode) {
+			t.Fatalf("wrong code %d: err = %v, want ErrInvalidMFACode", i+1, err)
+		}
+	}
+
+	// Once locked out, not even the right code is checked, from any endpoint or address
+	var lockedErr *LoginLockedError
+	if err := service.DisableTOTP(ctx, user.ID, totpCode(t, time.Now()), "192.0.2.2"); !errors.As(err, &lockedErr) {
+		t.Errorf("DisableTOTP while locked out: err = %v, want a LoginLockedError", err)
+	}
+	if _, err := service.RegenerateRecoveryCodes(ctx, user.ID, totpCode(t, time.Now()), "192.0.2.1"); !errors.As(err, &lockedErr) {
+		t.Errorf("RegenerateRecoveryCodes while locked out: err = %v, want a LoginLockedError", err)
+	}
+}
+
+func TestTOTPCodeIsAcceptedOnce(t *testing.T) {
+	// The replays count as failed logins, the threshold stays above them
+	service, userRepository, user := newTestMFAService(t, 10)
+	ctx := context.Background()
+	code := totpCode(t, time.Now())
+
+	// Concurrent requests with the same code race on the time step, only one of them may win
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = service.RegenerateRecoveryCodes(ctx, user.ID, code, "192.0.2.1")
+		}(i)
+	}
+	wg.Wait()
+
+	accepted := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			accepted++
+		case !errors.Is(err, ErrInvalidMFACode):
+			t.Errorf("replayed code: err = %v, want ErrInvalidMFACode", err)
+		}
+	}
+	if accepted != 1 {
+		t.Errorf("the code was accepted %d times, want once", accepted)
+	}
+
+	stored, _ := userRepository.GetUserByID(user.ID)
+	if stored.TOTPLastStep != time.Now().Unix()/30 && stored.TOTPLastStep != time.Now().Unix()/30-1 {
+		t.Errorf("TOTPLastStep = %d, want the step of the code", stored.TOTPLastStep)
+	}
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"golang-api/dto"
+	"golang-api/entity"
+	"golang-api/util"
+	"strings"
+)
+
+// OAuth2 error codes of RFC 6749 section 5.2
+const (
+	OAuthErrorInvalidRequest          = "invalid_request"
+	OAuthErrorInvalidClient           = "invalid_client"
+	OAuthErrorInvalidGrant            = "invalid_grant"
+	OAuthErrorUnauthorizedClient      = "unauthorized_client"
+	OAuthErrorUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthErrorInvalidScope            = "invalid_scope"
+	OAuthErrorAccessDenied            = "access_denied"
+	OAuthErrorUnsupportedResponseType = "unsupported_response_type"
+	OAuthErrorUnsupportedTokenType    = "unsupported_token_type"
+	// OAuthErrorInvalidDPoPProof is defined by RFC 9449 section 5
+	OAuthErrorInvalidDPoPProof = "invalid_dpop_proof"
+)
+
+// OAuthError is an error of the OAuth endpoints, reported to the client with its RFC 6749 code
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (err *OAuthError) Error() string {
+	return err.Code + ": " + err.Description
+}
+
+// OAuthService implements the /oauth/authorize and /oauth/token endpoints
+type OAuthService interface {
+	ValidateAuthorization(authorizeRequest dto.AuthorizeRequest) (*Authorization, error)
+	CreateAuthorizationCode(ctx context.Context, authorization *Authorization, user entity.User, amr []string) (string, error)
+	Token(ctx context.Context, tokenRequest dto.OAuthTokenRequest, clientID string, clientSecret string, sessionMetadata entity.SessionMetadata) (*dto.OAuthTokenResponse, error)
+	Introspect(ctx context.Context, token string, clientID string, clientSecret string) (*dto.IntrospectionResponse, error)
+	Revoke(ctx context.Context, token string, clientID string, clientSecret string) error
+	CreateDeviceAuthorization(ctx context.Context, clientID string, clientSecret string, scope string) (*dto.DeviceAuthorizationResponse, error)
+	GetDeviceAuthorization(ctx context.Context, userCode string) (*DeviceAuthorizationRequest, error)
+	ApproveDeviceAuthorization(ctx context.Context, userCode string, user *entity.User, amr []string) error
+	DeviceToken(ctx context.Context, deviceCode string, clientID string, clientSecret string, sessionMetadata entity.SessionMetadata) (*entity.TokenDetails, string, error)
+}
+
+type oauthService struct {
+	oauthClientService            OAuthClientService
+	authService                   AuthService
+	oidcService                   OIDCService
+	personalAccessTokenService    PersonalAccessTokenService
+	tokenRepository               entity.TokenRepository
+	oneTimeTokenRepository        entity.OneTimeTokenRepository
+	deviceAuthorizationRepository entity.DeviceAuthorizationRepository
+	tokenMaker                    util.TokenMaker
+	refreshTokenMaker             util.TokenMaker
+	keys                          util.KeyProvider
+	config                        util.Config
+}
+
+func NewOAuthService(oauthClientService OAuthClientService, authService AuthService, oidcService OIDCService, personalAccessTokenService PersonalAccessTokenService, tokenRepository entity.TokenRepository, oneTimeTokenRepository entity.OneTimeTokenRepository, deviceAuthorizationRepository entity.DeviceAuthorizationRepository, tokenMaker util.TokenMaker, refreshTokenMaker util.TokenMaker, keys util.KeyProvider, config util.Config) OAuthService {
+	return &oauthService{
+		oauthClientService,
+		authService,
+		oidcService,
+		personalAccessTokenService,
+		tokenRepository,
+		oneTimeTokenRepository,
+		deviceAuthorizationRepository,
+		tokenMaker,
+		refreshTokenMaker,
+		keys,
+		config,
+	}
+}
+
+// Token authenticates the client and runs the requested grant. Errors meant for the client are *OAuthError
+func (service *oauthService) Token(ctx context.Context, tokenRequest dto.OAuthTokenRequest, clientID string, clientSecret string, sessionMetadata entity.SessionMetadata) (*dto.OAuthTokenResponse, error) {
+	client, err := service.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if !supportedGrantTypes[tokenRequest.GrantType] {
+		return nil, &OAuthError{OAuthErrorUnsupportedGrantType, "the grant type is not supported"}
+	}
+	if !client.AllowsGrantType(tokenRequest.GrantType) {
+		return nil, &OAuthError{OAuthErrorUnauthorizedClient, "the client is not allowed to use this grant type"}
+	}
+
+	switch tokenRequest.GrantType {
+	case entity.GrantTypeClientCredentials:
+		return service.clientCredentials(client, tokenRequest.Scope, sessionMetadata.JKT)
+	case entity.GrantTypeAuthorizationCode:
+		return service.authorizationCode(ctx, client, tokenRequest, sessionMetadata)
+	case entity.GrantTypeRefreshToken:
+		return service.refreshToken(ctx, client, tokenRequest, sessionMetadata)
+	default:
+		return nil, &OAuthError{OAuthErrorUnsupportedGrantType, "the grant type is not supported"}
+	}
+}
+
+func (service *oauthService) authenticateClient(clientID string, clientSecret string) (*entity.OAuthClient, error) {
+	client, err := service.oauthClientService.AuthenticateClient(clientID, clientSecret)
+	if errors.Is(err, ErrInvalidClientCredentials) {
+		return nil, &OAuthError{OAuthErrorInvalidClient, "client authentication failed"}
+	}
+	return client, err
+}
+
+// clientCredentials issues an access token to the client itself, as a service principal.
+// No refresh token is issued, the client can authenticate again at any time.
+// The token is bound to the DPoP key of jkt when the client sent a proof
+func (service *oauthService) clientCredentials(client *entity.OAuthClient, scope string, jkt string) (*dto.OAuthTokenResponse, error) {
+	scopes, err := requestedScopes(client.Scopes, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	duration := service.config.OAuthClientTokenDuration
+	if duration == 0 {
+		duration = service.config.AccessTokenDuration
+	}
+
+	accessToken, accessPayload, err := service.tokenMaker.CreateToken(util.TokenSubject{
+		PrincipalType: util.PrincipalService,
+		ClientID:      client.ClientID,
+		Permissions:   scopes,
+		JKT:           jkt,
+	}, duration)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   util.TokenType(jkt),
+		ExpiresIn:   int64(accessPayload.ExpiredAt.Sub(accessPayload.IssuedAt).Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
+
+// requestedScopes parses the space delimited scope parameter, every scope must be allowed.
+// Without the parameter, every allowed scope is granted
+func requestedScopes(allowed []string, scope string) ([]string, error) {
+	scopes := strings.Fields(scope)
+	if len(scopes) == 0 {
+		return allowed, nil
+	}
+
+	for _, requested := range scopes {
+		if !entity.HasPermission(allowed, requested) {
+			return nil, &OAuthError{OAuthErrorInvalidScope, "the scope " + requested + " is not allowed for the client"}
+		}
+	}
+	return scopes, nil
+}
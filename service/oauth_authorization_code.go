@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"golang-api/dto"
+	"golang-api/entity"
+	"golang-api/util"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidRedirectURI is returned when the authorization request cannot be redirected back to the client,
+// the error is then shown to the user instead
+var ErrInvalidRedirectURI = errors.New("unknown client or unregistered redirect URI")
+
+// codeVerifierPattern is the verifier syntax of RFC 7636 section 4.1
+var codeVerifierPattern = regexp.MustCompile(`^[A-Za-z0-9._~-]{43,128}$`)
+
+// Authorization is a validated authorization request waiting for the user to log in and consent
+type Authorization struct {
+	Client        *entity.OAuthClient
+	RedirectURI   string
+	Scopes        []string
+	State         string
+	CodeChallenge string
+	Nonce         string
+	// requestedRedirectURI is empty when the client relied on its only registered URI
+	requestedRedirectURI string
+}
+
+// ValidateAuthorization checks an authorization code request with PKCE. Errors other than ErrInvalidRedirectURI
+// are *OAuthError, to be sent to the redirect URI
+func (service *oauthService) ValidateAuthorization(authorizeRequest dto.AuthorizeRequest) (*Authorization, error) {
+	client, err := service.oauthClientService.GetClient(authorizeRequest.ClientID)
+	if errors.Is(err, entity.ErrOAuthClientNotFound) {
+		return nil, ErrInvalidRedirectURI
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	redirectURI := authorizeRequest.RedirectURI
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !client.AllowsRedirectURI(redirectURI) {
+		return nil, ErrInvalidRedirectURI
+	}
+
+	authorization := &Authorization{
+		Client:               client,
+		RedirectURI:          redirectURI,
+		State:                authorizeRequest.State,
+		CodeChallenge:        authorizeRequest.CodeChallenge,
+		Nonce:                authorizeRequest.Nonce,
+		requestedRedirectURI: authorizeRequest.RedirectURI,
+	}
+
+	if authorizeRequest.ResponseType != "code" {
+		return authorization, &OAuthError{OAuthErrorUnsupportedResponseType, "only the code response type is supported"}
+	}
+	if !client.AllowsGrantType(entity.GrantTypeAuthorizationCode) {
+		return authorization, &OAuthError{OAuthErrorUnauthorizedClient, "the client is not allowed to use this grant type"}
+	}
+	if authorizeRequest.CodeChallenge == "" || authorizeRequest.CodeChallengeMethod != "S256" {
+		return authorization, &OAuthError{OAuthErrorInvalidRequest, "a PKCE code_challenge with the S256 method is required"}
+	}
+
+	authorization.Scopes, err = requestedScopes(client.Scopes, authorizeRequest.Scope)
+	if err != nil {
+		return authorization, err
+	}
+	if hasScope(authorization.Scopes, ScopeOpenID) {
+		signingKey, err := service.keys.SigningKey()
+		if err != nil {
+			return authorization, err
+		}
+		if signingKey.IsSymmetric() {
+			return authorization, &OAuthError{OAuthErrorInvalidScope, "openid is unavailable, ID tokens require an asymmetric signing key"}
+		}
+	}
+	return authorization, nil
+}
+
+// CreateAuthorizationCode records the user's consent and returns a single-use code for the client.
+// The user just logged in, which is the auth_time of the ID token
+func (service *oauthService) CreateAuthorizationCode(ctx context.Context, authorization *Authorization, user entity.User, amr []string) (string, error) {
+	code, err := util.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	err = service.oneTimeTokenRepository.SetOneTimeToken(ctx, entity.OneTimeToken{
+		Purpose:   entity.OneTimeTokenAuthorizationCode,
+		TokenHash: util.HashToken(code),
+		Subject:   user.Email,
+		Data: map[string]string{
+			"client_id":      authorization.Client.ClientID,
+			"redirect_uri":   authorization.requestedRedirectURI,
+			"scope":          strings.Join(authorization.Scopes, " "),
+			"code_challenge": authorization.CodeChallenge,
+			"user_id":        strconv.FormatUint(uint64(user.ID), 10),
+			"nonce":          authorization.Nonce,
+			"auth_time":      strconv.FormatInt(time.Now().Unix(), 10),
+			"amr":            strings.Join(amr, " "),
+		},
+		ExpiresAt: time.Now().Add(service.config.OAuthAuthorizationCodeDuration),
+	})
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// authorizationCode exchanges a code for a token pair, starting a session of the user limited to the granted scopes
+func (service *oauthService) authorizationCode(ctx context.Context, client *entity.OAuthClient, tokenRequest dto.OAuthTokenRequest, sessionMetadata entity.SessionMetadata) (*dto.OAuthTokenResponse, error) {
+	if tokenRequest.Code == "" || tokenRequest.CodeVerifier == "" {
+		return nil, &OAuthError{OAuthErrorInvalidRequest, "code and code_verifier are required"}
+	}
+	if !codeVerifierPattern.MatchString(tokenRequest.CodeVerifier) {
+		return nil, &OAuthError{OAuthErrorInvalidRequest, "malformed code_verifier"}
+	}
+
+	// Consuming first makes the code single-use even when the exchange fails
+	authorizationCode, err := service.oneTimeTokenRepository.ConsumeOneTimeToken(ctx, entity.OneTimeTokenAuthorizationCode, util.HashToken(tokenRequest.Code))
+	if errors.Is(err, entity.ErrOneTimeTokenNotFound) {
+		return nil, &OAuthError{OAuthErrorInvalidGrant, "invalid or expired authorization code"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if authorizationCode.Data["client_id"] != client.ClientID {
+		return nil, &OAuthError{OAuthErrorInvalidGrant, "the authorization code was issued to another client"}
+	}
+	if authorizationCode.Data["redirect_uri"] != tokenRequest.RedirectURI {
+		return nil, &OAuthError{OAuthErrorInvalidGrant, "redirect_uri does not match the authorization request"}
+	}
+	if !verifyCodeChallenge(authorizationCode.Data["code_challenge"], tokenRequest.CodeVerifier) {
+		return nil, &OAuthError{OAuthErrorInvalidGrant, "code_verifier does not match the code_challenge"}
+	}
+
+	authTime, _ := strconv.ParseInt(authorizationCode.Data["auth_time"], 10, 64)
+	sessionMetadata.ClientID = client.ClientID
+	sessionMetadata.Scopes = strings.Fields(authorizationCode.Data["scope"])
+	sessionMetadata.AuthTime = time.Unix(authTime, 0)
+	sessionMetadata.AMR = strings.Fields(authorizationCode.Data["amr"])
+	tokenDetails, err := service.authService.CreateTokens(ctx, authorizationCode.Subject, "", sessionMetadata)
+	if err != nil {
+		return nil, err
+	}
+	tokenResponse := newOAuthTokenResponse(client, tokenDetails, sessionMetadata.Scopes)
+
+	if hasScope(sessionMetadata.Scopes, ScopeOpenID) {
+		userID, _ := strconv.ParseUint(authorizationCode.Data["user_id"], 10, 64)
+		tokenResponse.IDToken, err = service.oidcService.CreateIDToken(uint(userID), client.ClientID, sessionMetadata.Scopes, authorizationCode.Data["nonce"], sessionMetadata.AuthTime)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tokenResponse, nil
+}
+
+// refreshToken rotates a refresh token issued to the client, keeping the scopes of the original grant.
+// A refresh token bound to a DPoP key needs a proof signed with the same key
+func (service *oauthService) refreshToken(ctx context.Context, client *entity.OAuthClient, tokenRequest dto.OAuthTokenRequest, sessionMetadata entity.SessionMetadata) (*dto.OAuthTokenResponse, error) {
+	if tokenRequest.RefreshToken == "" {
+		return nil, &OAuthError{OAuthErrorInvalidRequest, "refresh_token is required"}
+	}
+
+	refreshPayload, err := service.refreshTokenMaker.VerifyToken(tokenRequest.RefreshToken)
+	if err != nil {
+		return nil, &OAuthError{OAuthErrorInvalidGrant, err.Error()}
+	}
+	if refreshPayload.ClientID != client.ClientID {
+		return nil, &OAuthError{OAuthErrorInvalidGrant, "the refresh token was issued to another client"}
+	}
+	if jkt := refreshPayload.DPoPThumbprint(); jkt != "" && jkt != sessionMetadata.JKT {
+		return nil, &OAuthError{OAuthErrorInvalidDPoPProof, "the refresh token is bound to another DPoP key"}
+	}
+
+	tokenDetails, err := service.authService.CreateTokens(ctx, refreshPayload.UserEmail, refreshPayload.ID.String(), sessionMetadata)
+	if errors.Is(err, entity.ErrRefreshTokenNotFound) || errors.Is(err, entity.ErrRefreshTokenReused) {
+		return nil, &OAuthError{OAuthErrorInvalidGrant, err.Error()}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newOAuthTokenResponse(client, tokenDetails, nil), nil
+}
+
+// newOAuthTokenResponse only hands out the refresh token to clients allowed to use it
+func newOAuthTokenResponse(client *entity.OAuthClient, tokenDetails *entity.TokenDetails, scopes []string) *dto.OAuthTokenResponse {
+	tokenResponse := &dto.OAuthTokenResponse{
+		AccessToken: tokenDetails.AccessToken,
+		TokenType:   tokenDetails.TokenType,
+		ExpiresIn:   int64(time.Until(tokenDetails.AccessTokenExpiresAt).Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	}
+	if client.AllowsGrantType(entity.GrantTypeRefreshToken) {
+		tokenResponse.RefreshToken = tokenDetails.RefreshToken
+	}
+	return tokenResponse
+}
+
+// verifyCodeChallenge checks the S256 transformation of RFC 7636 section 4.6
+func verifyCodeChallenge(codeChallenge string, codeVerifier string) bool {
+	computed := codeChallengeS256(codeVerifier)
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(codeChallenge)) == 1
+}
+
+// codeChallengeS256 derives the PKCE code challenge of the verifier with the S256 method
+func codeChallengeS256(codeVerifier string) string {
+	digest := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"golang-api/dto"
+	"golang-api/entity"
+	"golang-api/util"
+	"net/url"
+
+	"github.com/google/uuid"
+)
+
+// Different types of error returned by the OAuthClientService
+var (
+	ErrUnsupportedGrantType     = errors.New("unsupported grant type")
+	ErrInvalidClientMetadata    = errors.New("invalid client metadata")
+	ErrInvalidClientCredentials = errors.New("invalid client credentials")
+)
+
+// supportedGrantTypes are the grant types /oauth/token implements
+var supportedGrantTypes = map[string]bool{
+	entity.GrantTypeClientCredentials: true,
+	entity.GrantTypeAuthorizationCode: true,
+	entity.GrantTypeRefreshToken:      true,
+	entity.GrantTypeDeviceCode:        true,
+}
+
+type OAuthClientService interface {
+	GetClients() (*dto.OAuthClientsResponse, error)
+	CreateClient(createRequest dto.CreateOAuthClientRequest) (*dto.CreatedOAuthClientResponse, error)
+	DeleteClient(clientID string) error
+	GetClient(clientID string) (*entity.OAuthClient, error)
+	AuthenticateClient(clientID string, clientSecret string) (*entity.OAuthClient, error)
+}
+
+type oauthClientService struct {
+	oauthClientRepository entity.OAuthClientRepository
+}
+
+func NewOAuthClientService(oauthClientRepository entity.OAuthClientRepository) OAuthClientService {
+	return &oauthClientService{
+		oauthClientRepository: oauthClientRepository,
+	}
+}
+
+func (service *oauthClientService) GetClients() (*dto.OAuthClientsResponse, error) {
+	clients, err := service.oauthClientRepository.GetOAuthClients()
+	if err != nil {
+		return nil, err
+	}
+	return dto.NewOAuthClientsResponse(clients), nil
+}
+
+// CreateClient registers a client with a random ID and secret. The secret is only returned here
+func (service *oauthClientService) CreateClient(createRequest dto.CreateOAuthClientRequest) (*dto.CreatedOAuthClientResponse, error) {
+	client := entity.OAuthClient{
+		ClientID:     uuid.New().String(),
+		Name:         createRequest.Name,
+		Scopes:       createRequest.Scopes,
+		GrantTypes:   createRequest.GrantTypes,
+		RedirectURIs: createRequest.RedirectURIs,
+		Public:       createRequest.Public,
+	}
+	if err := validateClientMetadata(client); err != nil {
+		return nil, err
+	}
+
+	var clientSecret string
+	if !client.Public {
+		var err error
+		clientSecret, err = util.GenerateRandomToken(32)
+		if err != nil {
+			return nil, err
+		}
+		client.SecretHash = util.HashToken(clientSecret)
+	}
+
+	createdClient, err := service.oauthClientRepository.CreateOAuthClient(client)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.CreatedOAuthClientResponse{
+		OAuthClientResponse: *dto.NewOAuthClientResponse(*createdClient),
+		ClientSecret:        clientSecret,
+	}, nil
+}
+
+func (service *oauthClientService) DeleteClient(clientID string) error {
+	return service.oauthClientRepository.DeleteOAuthClient(clientID)
+}
+
+func (service *oauthClientService) GetClient(clientID string) (*entity.OAuthClient, error) {
+	return service.oauthClientRepository.GetOAuthClientByClientID(clientID)
+}
+
+// AuthenticateClient returns the client if the secret matches, ErrInvalidClientCredentials otherwise.
+// Public clients only identify themselves, PKCE protects their grants instead of a secret
+func (service *oauthClientService) AuthenticateClient(clientID string, clientSecret string) (*entity.OAuthClient, error) {
+	client, err := service.oauthClientRepository.GetOAuthClientByClientID(clientID)
+	if errors.Is(err, entity.ErrOAuthClientNotFound) {
+		return nil, ErrInvalidClientCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if client.Public {
+		if clientSecret != "" {
+			return nil, ErrInvalidClientCredentials
+		}
+		return client, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(util.HashToken(clientSecret)), []byte(client.SecretHash)) != 1 {
+		return nil, ErrInvalidClientCredentials
+	}
+	return client, nil
+}
+
+// validateClientMetadata rejects grant types a client cannot use safely
+func validateClientMetadata(client entity.OAuthClient) error {
+	for _, grantType := range client.GrantTypes {
+		if !supportedGrantTypes[grantType] {
+			return fmt.Errorf("%w: %s", ErrUnsupportedGrantType, grantType)
+		}
+	}
+
+	if client.Public && client.AllowsGrantType(entity.GrantTypeClientCredentials) {
+		return fmt.Errorf("%w: public clients cannot use the client_credentials grant", ErrInvalidClientMetadata)
+	}
+	if client.AllowsGrantType(entity.GrantTypeAuthorizationCode) && len(client.RedirectURIs) == 0 {
+		return fmt.Errorf("%w: the authorization_code grant requires redirect URIs", ErrInvalidClientMetadata)
+	}
+	if client.AllowsGrantType(entity.GrantTypeRefreshToken) && !client.AllowsGrantType(entity.GrantTypeAuthorizationCode) {
+		return fmt.Errorf("%w: the refresh_token grant requires the authorization_code grant", ErrInvalidClientMetadata)
+	}
+
+	for _, redirectURI := range client.RedirectURIs {
+		parsed, err := url.Parse(redirectURI)
+		if err != nil || !parsed.IsAbs() || parsed.Fragment != "" {
+			return fmt.Errorf("%w: redirect URIs must be absolute and without fragment", ErrInvalidClientMetadata)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"golang-api/dto"
+	"golang-api/entity"
+	"golang-api/util"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// OAuth2 error codes of the device authorization grant, RFC 8628 section 3.5
+const (
+	OAuthErrorAuthorizationPending = "authorization_pending"
+	OAuthErrorSlowDown             = "slow_down"
+	OAuthErrorExpiredToken         = "expired_token"
+)
+
+const (
+	// userCodeAlphabet has no vowels, to avoid forming words, and no look-alike characters
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+	// slowDownIncrease is added to the polling interval of a device polling too fast
+	slowDownIncrease = 5 * time.Second
+)
+
+// DeviceAuthorizationRequest is a pending device authorization as shown on the approval page
+type DeviceAuthorizationRequest struct {
+	Client   *entity.OAuthClient
+	UserCode string
+	Scopes   []string
+}
+
+// CreateDeviceAuthorization starts a device login for the client and returns the codes to show the user
+func (service *oauthService) CreateDeviceAuthorization(ctx context.Context, clientID string, clientSecret string, scope string) (*dto.DeviceAuthorizationResponse, error) {
+	client, err := service.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if !client.AllowsGrantType(entity.GrantTypeDeviceCode) {
+		return nil, &OAuthError{OAuthErrorUnauthorizedClient, "the client is not allowed to use this grant type"}
+	}
+	scopes, err := requestedScopes(client.Scopes, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	deviceCode, err := util.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	userCode, err := generateUserCode()
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(service.config.DeviceCodeDuration)
+	err = service.deviceAuthorizationRepository.CreateDeviceAuthorization(ctx, entity.DeviceAuthorization{
+		DeviceCodeHash: util.HashToken(deviceCode),
+		UserCode:       userCode,
+		ClientID:       client.ClientID,
+		Scopes:         scopes,
+		Status:         entity.DeviceAuthorizationPending,
+		Interval:       service.config.DeviceCodeInterval,
+		ExpiresAt:      expiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	displayedUserCode := formatUserCode(userCode)
+	verificationURI := service.config.OIDCIssuer + "/api/v1/oauth/device"
+	return &dto.DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                displayedUserCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + displayedUserCode,
+		ExpiresIn:               int64(service.config.DeviceCodeDuration.Seconds()),
+		Interval:                int64(service.config.DeviceCodeInterval.Seconds()),
+	}, nil
+}
+
+// GetDeviceAuthorization finds the pending device authorization of a user code, as typed by the user
+func (service *oauthService) GetDeviceAuthorization(ctx context.Context, userCode string) (*DeviceAuthorizationRequest, error) {
+	deviceAuthorization, err := service.deviceAuthorizationRepository.GetDeviceAuthorizationByUserCode(ctx, normalizeUserCode(userCode))
+	if err != nil {
+		return nil, err
+	}
+	if deviceAuthorization.Status != entity.DeviceAuthorizationPending {
+		return nil, entity.ErrDeviceAuthorizationNotFound
+	}
+
+	client, err := service.oauthClientService.GetClient(deviceAuthorization.ClientID)
+	if errors.Is(err, entity.ErrOAuthClientNotFound) {
+		return nil, entity.ErrDeviceAuthorizationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &DeviceAuthorizationRequest{
+		Client:   client,
+		UserCode: formatUserCode(deviceAuthorization.UserCode),
+		Scopes:   deviceAuthorization.Scopes,
+	}, nil
+}
+
+// ApproveDeviceAuthorization lets the device log in as the user, who just authenticated with the methods of amr,
+// or denies it when user is nil
+func (service *oauthService) ApproveDeviceAuthorization(ctx context.Context, userCode string, user *entity.User, amr []string) error {
+	deviceAuthorization, err := service.deviceAuthorizationRepository.GetDeviceAuthorizationByUserCode(ctx, normalizeUserCode(userCode))
+	if err != nil {
+		return err
+	}
+
+	if user == nil {
+		deviceAuthorization.Status = entity.DeviceAuthorizationDenied
+		return service.deviceAuthorizationRepository.SetDeviceAuthorizationStatus(ctx, *deviceAuthorization)
+	}
+	deviceAuthorization.Status = entity.DeviceAuthorizationApproved
+	deviceAuthorization.UserEmail = user.Email
+	deviceAuthorization.AuthTime = time.Now()
+	deviceAuthorization.AMR = amr
+	return service.deviceAuthorizationRepository.SetDeviceAuthorizationStatus(ctx, *deviceAuthorization)
+}
+
+// DeviceToken answers a poll of the device. Once the user approved, it starts a session of the user limited to the
+// granted scopes, and returns its token pair along with the user's email
+func (service *oauthService) DeviceToken(ctx context.Context, deviceCode string, clientID string, clientSecret string, sessionMetadata entity.SessionMetadata) (*entity.TokenDetails, string, error) {
+	client, err := service.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return nil, "", err
+	}
+	if !client.AllowsGrantType(entity.GrantTypeDeviceCode) {
+		return nil, "", &OAuthError{OAuthErrorUnauthorizedClient, "the client is not allowed to use this grant type"}
+	}
+	if deviceCode == "" {
+		return nil, "", &OAuthError{OAuthErrorInvalidRequest, "device_code is required"}
+	}
+
+	deviceAuthorization, lastPolledAt, err := service.deviceAuthorizationRepository.PollDeviceAuthorization(ctx, util.HashToken(deviceCode))
+	if errors.Is(err, entity.ErrDeviceAuthorizationNotFound) {
+		return nil, "", &OAuthError{OAuthErrorExpiredToken, "the device code has expired"}
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if deviceAuthorization.ClientID != client.ClientID {
+		return nil, "", &OAuthError{OAuthErrorInvalidGrant, "the device code was issued to another client"}
+	}
+
+	switch deviceAuthorization.Status {
+	case entity.DeviceAuthorizationPending:
+		if time.Since(lastPolledAt) < deviceAuthorization.Interval {
+			if err := service.deviceAuthorizationRepository.SetDeviceAuthorizationInterval(ctx, deviceAuthorization.DeviceCodeHash, deviceAuthorization.Interval+slowDownIncrease); err != nil {
+				return nil, "", err
+			}
+			return nil, "", &OAuthError{OAuthErrorSlowDown, "polling too fast, increase the interval by 5 seconds"}
+		}
+		return nil, "", &OAuthError{OAuthErrorAuthorizationPending, "the user has not approved the device yet"}
+	case entity.DeviceAuthorizationDenied:
+		service.deviceAuthorizationRepository.ConsumeDeviceAuthorization(ctx, *deviceAuthorization)
+		return nil, "", &OAuthError{OAuthErrorAccessDenied, "the user denied the device"}
+	}
+
+	// Consuming first makes sure concurrent polls get a single token pair
+	err = service.deviceAuthorizationRepository.ConsumeDeviceAuthorization(ctx, *deviceAuthorization)
+	if errors.Is(err, entity.ErrDeviceAuthorizationNotFound) {
+		return nil, "", &OAuthError{OAuthErrorInvalidGrant, "the device code was already used"}
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The session authenticated when the user approved the device, not when the device polled
+	sessionMetadata.ClientID = client.ClientID
+	sessionMetadata.Scopes = deviceAuthorization.Scopes
+	sessionMetadata.AuthTime = deviceAuthorization.AuthTime
+	sessionMetadata.AMR = deviceAuthorization.AMR
+	tokenDetails, err := service.authService.CreateTokens(ctx, deviceAuthorization.UserEmail, "", sessionMetadata)
+	if err != nil {
+		return nil, "", err
+	}
+	return tokenDetails, deviceAuthorization.UserEmail, nil
+}
+
+func generateUserCode() (string, error) {
+	var userCode strings.Builder
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := 0; i < userCodeLength; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		userCode.WriteByte(userCodeAlphabet[n.Int64()])
+	}
+	return userCode.String(), nil
+}
+
+// formatUserCode splits the user code in two halves, easier to read and type
+func formatUserCode(userCode string) string {
+	return userCode[:userCodeLength/2] + "-" + userCode[userCodeLength/2:]
+}
+
+// normalizeUserCode accepts the code as users may type it, in lower case and with or without the dash
+func normalizeUserCode(userCode string) string {
+	var normalized strings.Builder
+	for _, char := range strings.ToUpper(userCode) {
+		if strings.ContainsRune(userCodeAlphabet, char) {
+			normalized.WriteRune(char)
+		}
+	}
+	return normalized.String()
+}
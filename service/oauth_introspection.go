@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"golang-api/dto"
+	"golang-api/entity"
+	"golang-api/util"
+	"strings"
+)
+
+// Token kinds reported by introspection in token_use, next to the standard token_type
+const (
+	tokenUseAccess              = util.TokenUseAccess
+	tokenUseRefresh             = util.TokenUseRefresh
+	tokenUsePersonalAccessToken = "personal_access_token"
+)
+
+// Introspect tells a confidential client whether a token is active and what it grants (RFC 7662).
+// Invalid, expired and revoked tokens are reported inactive, without any other claim
+func (service *oauthService) Introspect(ctx context.Context, token string, clientID string, clientSecret string) (*dto.IntrospectionResponse, error) {
+	client, err := service.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if client.Public {
+		return nil, &OAuthError{OAuthErrorUnauthorizedClient, "public clients cannot introspect tokens"}
+	}
+	if token == "" {
+		return nil, &OAuthError{OAuthErrorInvalidRequest, "token is required"}
+	}
+
+	inactive := &dto.IntrospectionResponse{Active: false}
+
+	if IsPersonalAccessToken(token) {
+		payload, err := service.personalAccessTokenService.VerifyPersonalAccessToken(token)
+		if err != nil {
+			return inactive, nil
+		}
+		return service.introspectionResponse(payload, tokenUsePersonalAccessToken), nil
+	}
+
+	// Refresh tokens are the ones with a stored state, untyped tokens issued before refresh tokens had their own key
+	// are accepted by both makers and only the state tells them apart
+	if payload, err := service.refreshTokenMaker.VerifyToken(token); err == nil {
+		refreshToken, err := service.tokenRepository.GetRefreshToken(ctx, payload.UserEmail, payload.ID.String())
+		switch {
+		case err == nil:
+			active, err := service.refreshTokenActive(ctx, refreshToken)
+			if err != nil || !active {
+				return inactive, err
+			}
+			return service.introspectionResponse(payload, tokenUseRefresh), nil
+		case !errors.Is(err, entity.ErrRefreshTokenNotFound):
+			return nil, err
+		}
+	}
+
+	payload, err := service.authService.VerifyAccessToken(ctx, token)
+	if err != nil {
+		return inactive, nil
+	}
+	return service.introspectionResponse(payload, tokenUseAccess), nil
+}
+
+// Revoke invalidates an access or refresh token (RFC 7009). Revoking a refresh token ends its session,
+// along with the last access token of the session. Clients can only revoke their own tokens, or first party ones.
+// Tokens that are already invalid are ignored
+func (service *oauthService) Revoke(ctx context.Context, token string, clientID string, clientSecret string) error {
+	client, err := service.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		return &OAuthError{OAuthErrorInvalidRequest, "token is required"}
+	}
+	if IsPersonalAccessToken(token) {
+		return &OAuthError{OAuthErrorUnsupportedTokenType, "personal access tokens are revoked by their owner"}
+	}
+
+	if payload, err := service.refreshTokenMaker.VerifyToken(token); err == nil {
+		if err := checkTokenClient(payload, client); err != nil {
+			return err
+		}
+		refreshToken, err := service.tokenRepository.GetRefreshToken(ctx, payload.UserEmail, payload.ID.String())
+		switch {
+		case err == nil:
+			return service.revokeSession(ctx, refreshToken)
+		case !errors.Is(err, entity.ErrRefreshTokenNotFound):
+			return err
+		}
+	}
+
+	payload, err := service.tokenMaker.VerifyToken(token)
+	if err != nil {
+		return nil
+	}
+	if err := checkTokenClient(payload, client); err != nil {
+		return err
+	}
+	return service.authService.RevokeAccessToken(ctx, payload)
+}
+
+// checkTokenClient only lets clients revoke their own tokens, or first party ones
+func checkTokenClient(payload *util.JWTPayload, client *entity.OAuthClient) error {
+	if payload.ClientID != "" && payload.ClientID != client.ClientID {
+		return &OAuthError{OAuthErrorUnauthorizedClient, "the token was issued to another client"}
+	}
+	return nil
+}
+
+// refreshTokenActive reports whether the refresh token was neither rotated nor had its session revoked
+func (service *oauthService) refreshTokenActive(ctx context.Context, refreshToken *entity.RefreshToken) (bool, error) {
+	if refreshToken.Rotated {
+		return false, nil
+	}
+	_, err := service.tokenRepository.GetSession(ctx, refreshToken.UserEmail, refreshToken.FamilyID)
+	if errors.Is(err, entity.ErrSessionNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (service *oauthService) revokeSession(ctx context.Context, refreshToken *entity.RefreshToken) error {
+	session, err := service.tokenRepository.GetSession(ctx, refreshToken.UserEmail, refreshToken.FamilyID)
+	if errors.Is(err, entity.ErrSessionNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := service.tokenRepository.DenylistAccessToken(ctx, session.AccessTokenID, session.AccessTokenExpiresAt.Add(service.config.TokenLeeway)); err != nil {
+		return err
+	}
+	return service.tokenRepository.DeleteTokenFamily(ctx, refreshToken.UserEmail, refreshToken.FamilyID)
+}
+
+func (service *oauthService) introspectionResponse(payload *util.JWTPayload, tokenUse string) *dto.IntrospectionResponse {
+	introspection := &dto.IntrospectionResponse{
+		Active:      true,
+		ClientID:    payload.ClientID,
+		Username:    payload.UserEmail,
+		TokenType:   util.TokenType(payload.DPoPThumbprint()),
+		TokenUse:    tokenUse,
+		IssuedAt:    payload.IssuedAt.Unix(),
+		Issuer:      service.config.OIDCIssuer,
+		Audience:    payload.Audience,
+		Subject:     payload.Subject(),
+		Role:        payload.Role,
+		Permissions: payload.Permissions,
+		SessionID:   payload.SessionID,
+	}
+
+	switch {
+	case payload.IsService():
+		introspection.Scope = strings.Join(payload.Permissions, " ")
+	default:
+		introspection.Scope = strings.Join(payload.Scopes, " ")
+	}
+	if payload.Issuer != "" {
+		introspection.Issuer = payload.Issuer
+	}
+	if !payload.AuthTime.IsZero() {
+		introspection.AuthTime = payload.AuthTime.Unix()
+		introspection.AMR = payload.AMR
+	}
+	if !payload.NotBefore.IsZero() {
+		introspection.NotBefore = payload.NotBefore.Unix()
+	}
+	if !payload.ExpiredAt.IsZero() {
+		introspection.ExpiresAt = payload.ExpiredAt.Unix()
+	}
+	if payload.PersonalAccessTokenID == 0 {
+		introspection.JTI = payload.ID.String()
+	}
+	if jkt := payload.DPoPThumbprint(); jkt != "" {
+		introspection.Confirmation = &dto.TokenConfirmation{JKT: jkt}
+	}
+	return introspection
+}
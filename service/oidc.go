@@ -0,0 +1,107 @@
+package service
+
+import (
+	"errors"
+	"golang-api/dto"
+	"golang-api/util"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Standard OpenID Connect scopes. They select the claims of the user and are not permissions
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// ErrInsufficientScope is returned by UserInfo for access tokens not granted the openid scope
+var ErrInsufficientScope = errors.New("the openid scope is required")
+
+// OIDCService builds the OpenID Connect view of users for ID tokens and /userinfo
+type OIDCService interface {
+	UserInfo(userID uint, scopes []string) (*util.UserInfo, error)
+	CreateIDToken(userID uint, clientID string, scopes []string, nonce string, authTime time.Time) (string, error)
+}
+
+type oidcService struct {
+	userService UserService
+	keys        util.KeyProvider
+	config      util.Config
+}
+
+func NewOIDCService(userService UserService, keys util.KeyProvider, config util.Config) OIDCService {
+	return &oidcService{
+		userService,
+		keys,
+		config,
+	}
+}
+
+// UserInfo returns the claims of the user allowed by the scopes, the subject being the user ID
+func (service *oidcService) UserInfo(userID uint, scopes []string) (*util.UserInfo, error) {
+	if !hasScope(scopes, ScopeOpenID) {
+		return nil, ErrInsufficientScope
+	}
+
+	user, err := service.userService.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return newUserInfo(user, scopes), nil
+}
+
+// CreateIDToken issues the ID token of an authorization, authTime being when the user logged in
+func (service *oidcService) CreateIDToken(userID uint, clientID string, scopes []string, nonce string, authTime time.Time) (string, error) {
+	userInfo, err := service.UserInfo(userID, scopes)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	return util.CreateIDToken(util.IDTokenClaims{
+		UserInfo:  *userInfo,
+		Issuer:    service.config.OIDCIssuer,
+		Audience:  clientID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(service.config.AccessTokenDuration).Unix(),
+		AuthTime:  authTime.Unix(),
+		Nonce:     nonce,
+	}, service.keys)
+}
+
+func newUserInfo(user *dto.UserResponse, scopes []string) *util.UserInfo {
+	userInfo := &util.UserInfo{Subject: strconv.FormatUint(uint64(user.ID), 10)}
+	if hasScope(scopes, ScopeProfile) {
+		userInfo.Name = strings.TrimSpace(user.FirstName + " " + user.LastName)
+		userInfo.GivenName = user.FirstName
+		userInfo.FamilyName = user.LastName
+	}
+	if hasScope(scopes, ScopeEmail) {
+		emailVerified := user.EmailVerifiedAt != nil
+		userInfo.Email = user.Email
+		userInfo.EmailVerified = &emailVerified
+	}
+	return userInfo
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, granted := range scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// permissionScopes drops the OpenID Connect scopes, leaving the ones that grant permissions
+func permissionScopes(scopes []string) []string {
+	var permissions []string
+	for _, scope := range scopes {
+		if scope != ScopeOpenID && scope != ScopeProfile && scope != ScopeEmail {
+			permissions = append(permissions, scope)
+		}
+	}
+	return permissions
+}
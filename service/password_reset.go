@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"golang-api/entity"
+	"golang-api/mailer"
+	"golang-api/util"
+	"log"
+	"net/url"
+	"time"
+)
+
+type PasswordResetService interface {
+	ForgotPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, resetToken string, password string) error
+}
+
+type passwordResetService struct {
+	userRepository          entity.UserRepository
+	oneTimeTokenRepository  entity.OneTimeTokenRepository
+	securityEventRepository entity.SecurityEventRepository
+	authService             AuthService
+	passwordHashers         *util.PasswordHasherRegistry
+	mailer                  mailer.Mailer
+	config                  util.Config
+}
+
+func NewPasswordResetService(userRepository entity.UserRepository, oneTimeTokenRepository entity.OneTimeTokenRepository, securityEventRepository entity.SecurityEventRepository, authService AuthService, passwordHashers *util.PasswordHasherRegistry, mailer mailer.Mailer, config util.Config) PasswordResetService {
+	return &passwordResetService{
+		userRepository,
+		oneTimeTokenRepository,
+		securityEventRepository,
+		authService,
+		passwordHashers,
+		mailer,
+		config,
+	}
+}
+
+// ForgotPassword mails a reset link to the user. Unknown emails are ignored without error,
+// and the mail is sent in the background, so the response tells nothing about which accounts exist
+func (service *passwordResetService) ForgotPassword(ctx context.Context, email string) error {
+	user, err := service.userRepository.GetUserByEmail(email)
+	if err != nil {
+		return nil
+	}
+
+	resetToken, err := util.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	err = service.oneTimeTokenRepository.SetOneTimeToken(ctx, entity.OneTimeToken{
+		Purpose:   entity.OneTimeTokenPasswordReset,
+		TokenHash: util.HashToken(resetToken),
+		Subject:   user.Email,
+		// Any password change since the token was issued makes it useless
+		Data:      map[string]string{"password": util.HashToken(user.Password)},
+		ExpiresAt: time.Now().Add(service.config.PasswordResetDuration),
+	})
+	if err != nil {
+		return err
+	}
+
+	message := mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nFollow this link to choose a new password:\n\n%s\n\nThe link expires in %s. If you did not ask for it, you can ignore this email.\n",
+			user.FirstName, tokenLink(service.config.PasswordResetURL, resetToken), service.config.PasswordResetDuration),
+	}
+	go func() {
+		if err := service.mailer.Send(context.Background(), message); err != nil {
+			log.Printf("Failed to send password reset email to %s: %v\n", message.To, err)
+		}
+	}()
+	return nil
+}
+
+// ResetPassword sets a new password with a reset token, which can be used only once, and revokes every session of the user
+func (service *passwordResetService) ResetPassword(ctx context.Context, resetToken string, password string) error {
+	token, err := service.oneTimeTokenRepository.ConsumeOneTimeToken(ctx, entity.OneTimeTokenPasswordReset, util.HashToken(resetToken))
+	if err != nil {
+		return err
+	}
+
+	user, err := service.userRepository.GetUserByEmail(token.Subject)
+	if err != nil {
+		return entity.ErrOneTimeTokenNotFound
+	}
+	if token.Data["password"] != util.HashToken(user.Password) {
+		return entity.ErrOneTimeTokenNotFound
+	}
+
+	hashedPassword, err := service.passwordHashers.Hash(password)
+	if err != nil {
+		return err
+	}
+	if err := service.userRepository.UpdateUserPassword(user.ID, hashedPassword); err != nil {
+		return err
+	}
+
+	securityEvent := entity.SecurityEvent{
+		Type:      entity.SecurityEventPasswordReset,
+		UserEmail: user.Email,
+	}
+	if err := service.securityEventRepository.CreateSecurityEvent(securityEvent); err != nil {
+		log.Printf("Failed to record security event %s for %s: %v\n", securityEvent.Type, securityEvent.UserEmail, err)
+	}
+
+	return service.authService.Revoke(ctx, user.Email)
+}
+
+// tokenLink adds the token to the query of the page that will submit it back to the API
+func tokenLink(baseURL string, token string) string {
+	link, err := url.Parse(baseURL)
+	if err != nil {
+		return baseURL + "?token=" + url.QueryEscape(token)
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String()
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"golang-api/dto"
+	"golang-api/entity"
+	"golang-api/util"
+	"log"
+	"strings"
+	"time"
+)
+
+// Different types of error returned by the PersonalAccessTokenService
+var (
+	ErrScopeNotGranted            = errors.New("scope is not granted to the user")
+	ErrInvalidTokenExpiry         = errors.New("expiration must be in the future")
+	ErrExpiredPersonalAccessToken = errors.New("personal access token has expired")
+)
+
+// lastUsedResolution bounds the writes made to track the last use of a token
+const lastUsedResolution = time.Minute
+
+type PersonalAccessTokenService interface {
+	CreatePersonalAccessToken(userID uint, createRequest dto.CreatePersonalAccessTokenRequest) (*dto.CreatedPersonalAccessTokenResponse, error)
+	GetPersonalAccessTokens(userID uint) (*dto.PersonalAccessTokensResponse, error)
+	RevokePersonalAccessToken(userID uint, ID uint) error
+	VerifyPersonalAccessToken(token string) (*util.JWTPayload, error)
+}
+
+type personalAccessTokenService struct {
+	personalAccessTokenRepository entity.PersonalAccessTokenRepository
+	userRepository                entity.UserRepository
+	roleRepository                entity.RoleRepository
+}
+
+func NewPersonalAccessTokenService(personalAccessTokenRepository entity.PersonalAccessTokenRepository, userRepository entity.UserRepository, roleRepository entity.RoleRepository) PersonalAccessTokenService {
+	return &personalAccessTokenService{
+		personalAccessTokenRepository,
+		userRepository,
+		roleRepository,
+	}
+}
+
+// CreatePersonalAccessToken issues a token limited to scopes the user currently holds
+func (service *personalAccessTokenService) CreatePersonalAccessToken(userID uint, createRequest dto.CreatePersonalAccessTokenRequest) (*dto.CreatedPersonalAccessTokenResponse, error) {
+	if createRequest.ExpiresAt != nil && !createRequest.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidTokenExpiry
+	}
+
+	user, err := service.userRepository.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	role, err := service.roleRepository.GetRoleByName(user.Role)
+	if err != nil {
+		return nil, err
+	}
+	for _, scope := range createRequest.Scopes {
+		if !scopeGranted(role.Permissions, scope) {
+			return nil, fmt.Errorf("%w: %s", ErrScopeNotGranted, scope)
+		}
+	}
+
+	secret, err := util.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	token := entity.PersonalAccessTokenPrefix + secret
+
+	personalAccessToken, err := service.personalAccessTokenRepository.CreatePersonalAccessToken(entity.PersonalAccessToken{
+		UserID:        userID,
+		Name:          createRequest.Name,
+		DisplayPrefix: token[:len(entity.PersonalAccessTokenPrefix)+6],
+		TokenHash:     util.HashToken(token),
+		Scopes:        createRequest.Scopes,
+		ExpiresAt:     createRequest.ExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.CreatedPersonalAccessTokenResponse{
+		PersonalAccessTokenResponse: *dto.NewPersonalAccessTokenResponse(*personalAccessToken),
+		Token:                       token,
+	}, nil
+}
+
+func (service *personalAccessTokenService) GetPersonalAccessTokens(userID uint) (*dto.PersonalAccessTokensResponse, error) {
+	personalAccessTokens, err := service.personalAccessTokenRepository.GetPersonalAccessTokens(userID)
+	if err != nil {
+		return nil, err
+	}
+	return dto.NewPersonalAccessTokensResponse(personalAccessTokens), nil
+}
+
+func (service *personalAccessTokenService) RevokePersonalAccessToken(userID uint, ID uint) error {
+	return service.personalAccessTokenRepository.DeletePersonalAccessToken(userID, ID)
+}
+
+// VerifyPersonalAccessToken returns the payload of the token's user, with the permissions narrowed to the token scopes.
+// The role is read on every request, so a token never outlives a permission its user lost
+func (service *personalAccessTokenService) VerifyPersonalAccessToken(token string) (*util.JWTPayload, error) {
+	personalAccessToken, err := service.personalAccessTokenRepository.GetPersonalAccessTokenByHash(util.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if personalAccessToken.ExpiresAt != nil && !now.Before(*personalAccessToken.ExpiresAt) {
+		return nil, ErrExpiredPersonalAccessToken
+	}
+
+	user, err := service.userRepository.GetUserByID(personalAccessToken.UserID)
+	if err != nil {
+		return nil, entity.ErrPersonalAccessTokenNotFound
+	}
+	role, err := service.roleRepository.GetRoleByName(user.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	if personalAccessToken.LastUsedAt == nil || now.Sub(*personalAccessToken.LastUsedAt) >= lastUsedResolution {
+		if err := service.personalAccessTokenRepository.UpdatePersonalAccessTokenLastUsed(personalAccessToken.ID, now); err != nil {
+			log.Printf("Failed to track the use of personal access token %d: %v\n", personalAccessToken.ID, err)
+		}
+	}
+
+	jwtPayload := &util.JWTPayload{
+		UserID:                user.ID,
+		UserEmail:             user.Email,
+		Role:                  role.Name,
+		Permissions:           scopedPermissions(role.Permissions, personalAccessToken.Scopes),
+		IssuedAt:              personalAccessToken.CreatedAt,
+		PersonalAccessTokenID: personalAccessToken.ID,
+	}
+	if personalAccessToken.ExpiresAt != nil {
+		jwtPayload.ExpiredAt = *personalAccessToken.ExpiresAt
+	}
+	return jwtPayload, nil
+}
+
+// IsPersonalAccessToken tells personal access tokens apart from JWTs in the Authorization header
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, entity.PersonalAccessTokenPrefix)
+}
+
+// scopeGranted checks that the role holds the scope. The wildcard scope requires the wildcard permission
+func scopeGranted(permissions []string, scope string) bool {
+	if scope == entity.PermissionAll {
+		for _, permission := range permissions {
+			if permission == entity.PermissionAll {
+				return true
+			}
+		}
+		return false
+	}
+	return entity.HasPermission(permissions, scope)
+}
+
+// scopedPermissions keeps the scopes the role still grants
+func scopedPermissions(permissions []string, scopes []string) []string {
+	var granted []string
+	for _, scope := range scopes {
+		if scopeGranted(permissions, scope) {
+			granted = append(granted, scope)
+		}
+	}
+	return granted
+}
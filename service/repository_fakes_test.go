@@ -0,0 +1,345 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"golang-api/entity"
+	"sync"
+	"time"
+)
+
+// The fakes keep their state in memory. They embed the interface they fake, so a method a test
+// does not expect to be called panics instead of silently succeeding
+
+var errFakeNotFound = errors.New("record not found")
+
+type fakeUserRepository struct {
+	entity.UserRepository
+	mu     sync.Mutex
+	nextID uint
+	users  map[uint]entity.User
+}
+
+func newFakeUserRepository(users ...entity.User) *fakeUserRepository {
+	repository := &fakeUserRepository{users: map[uint]entity.User{}}
+	for _, user := range users {
+		repository.CreateUser(user)
+	}
+	return repository
+}
+
+func (repository *fakeUserRepository) GetUserByID(ID uint) (*entity.User, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	user, ok := repository.users[ID]
+	if !ok {
+		return nil, errFakeNotFound
+	}
+	return &user, nil
+}
+
+func (repository *fakeUserRepository) GetUserByEmail(email string) (*entity.User, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	for _, user := range repository.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return nil, errFakeNotFound
+}
+
+func (repository *fakeUserRepository) CreateUser(user entity.User) (*entity.User, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	repository.nextID++
+	user.ID = repository.nextID
+	if user.Role == "" {
+		user.Role = entity.RoleMember
+	}
+	repository.users[user.ID] = user
+	return &user, nil
+}
+
+func (repository *fakeUserRepository) UpdateUser(user entity.User) (*entity.User, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	if _, ok := repository.users[user.ID]; !ok {
+		return nil, errFakeNotFound
+	}
+	repository.users[user.ID] = user
+	return &user, nil
+}
+
+func (repository *fakeUserRepository) UpdateUserPassword(ID uint, password string) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	user, ok := repository.users[ID]
+	if !ok {
+		return errFakeNotFound
+	}
+	user.Password = password
+	repository.users[ID] = user
+	return nil
+}
+
+func (repository *fakeUserRepository) DeleteUser(ID uint) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	delete(repository.users, ID)
+	return nil
+}
+
+func (repository *fakeUserRepository) CountUsersByRole(role string) (int64, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	var count int64
+	for _, user := range repository.users {
+		if user.Role == role {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (repository *fakeUserRepository) UpdateUserMFA(user entity.User) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	stored, ok := repository.users[user.ID]
+	if !ok {
+		return errFakeNotFound
+	}
+	stored.TOTPSecret, stored.TOTPEnabled, stored.TOTPLastStep = user.TOTPSecret, user.TOTPEnabled, user.TOTPLastStep
+	repository.users[user.ID] = stored
+	return nil
+}
+
+func (repository *fakeUserRepository) UseTOTPStep(ID uint, step int64) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	user, ok := repository.users[ID]
+	if !ok || user.TOTPLastStep >= step {
+		return entity.ErrTOTPStepUsed
+	}
+	user.TOTPLastStep = step
+	repository.users[ID] = user
+	return nil
+}
+
+func (repository *fakeUserRepository) count() int {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	return len(repository.users)
+}
+
+type fakeRoleRepository struct {
+	entity.RoleRepository
+}
+
+func (fakeRoleRepository) GetRoleByName(name string) (*entity.Role, error) {
+	for _, role := range entity.DefaultRoles() {
+		if role.Name == name {
+			return &role, nil
+		}
+	}
+	return nil, errFakeNotFound
+}
+
+type fakeOneTimeTokenRepository struct {
+	entity.OneTimeTokenRepository
+	mu     sync.Mutex
+	tokens map[string]entity.OneTimeToken
+}
+
+func newFakeOneTimeTokenRepository() *fakeOneTimeTokenRepository {
+	return &fakeOneTimeTokenRepository{tokens: map[string]entity.OneTimeToken{}}
+}
+
+func (repository *fakeOneTimeTokenRepository) SetOneTimeToken(ctx context.Context, oneTimeToken entity.OneTimeToken) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	repository.tokens[oneTimeToken.Purpose+":"+oneTimeToken.TokenHash] = oneTimeToken
+	return nil
+}
+
+func (repository *fakeOneTimeTokenRepository) ConsumeOneTimeToken(ctx context.Context, purpose string, tokenHash string) (*entity.OneTimeToken, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	key := purpose + ":" + tokenHash
+	oneTimeToken, ok := repository.tokens[key]
+	if !ok || time.Now().After(oneTimeToken.ExpiresAt) {
+		return nil, entity.ErrOneTimeTokenNotFound
+	}
+	delete(repository.tokens, key)
+	return &oneTimeToken, nil
+}
+
+type fakeRecoveryCodeRepository struct {
+	entity.RecoveryCodeRepository
+	mu         sync.Mutex
+	codeHashes map[uint][]string
+}
+
+func newFakeRecoveryCodeRepository() *fakeRecoveryCodeRepository {
+	return &fakeRecoveryCodeRepository{codeHashes: map[uint][]string{}}
+}
+
+func (repository *fakeRecoveryCodeRepository) ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	repository.codeHashes[userID] = append([]string{}, codeHashes...)
+	return nil
+}
+
+func (repository *fakeRecoveryCodeRepository) UseRecoveryCode(userID uint, codeHash string) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	codeHashes := repository.codeHashes[userID]
+	for i, stored := range codeHashes {
+		if stored == codeHash {
+			repository.codeHashes[userID] = append(codeHashes[:i:i], codeHashes[i+1:]...)
+			return nil
+		}
+	}
+	return entity.ErrRecoveryCodeInvalid
+}
+
+func (repository *fakeRecoveryCodeRepository) DeleteRecoveryCodes(userID uint) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	delete(repository.codeHashes, userID)
+	return nil
+}
+
+// fakeLoginAttemptRepository ignores the attempt window, tests run well within it
+type fakeLoginAttemptRepository struct {
+	mu       sync.Mutex
+	attempts map[string]entity.LoginAttempts
+}
+
+func newFakeLoginAttemptRepository() *fakeLoginAttemptRepository {
+	return &fakeLoginAttemptRepository{attempts: map[string]entity.LoginAttempts{}}
+}
+
+func (repository *fakeLoginAttemptRepository) GetLoginAttempts(ctx context.Context, key string) (*entity.LoginAttempts, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	loginAttempts := repository.attempts[key]
+	return &loginAttempts, nil
+}
+
+func (repository *fakeLoginAttemptRepository) RecordLoginFailure(ctx context.Context, key string, window time.Duration) (int64, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	loginAttempts := repository.attempts[key]
+	loginAttempts.Failures++
+	repository.attempts[key] = loginAttempts
+	return loginAttempts.Failures, nil
+}
+
+func (repository *fakeLoginAttemptRepository) SetLoginLock(ctx context.Context, key string, lockedUntil time.Time) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	loginAttempts := repository.attempts[key]
+	loginAttempts.LockedUntil = lockedUntil
+	repository.attempts[key] = loginAttempts
+	return nil
+}
+
+func (repository *fakeLoginAttemptRepository) SetLoginHardLock(ctx context.Context, key string) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	loginAttempts := repository.attempts[key]
+	loginAttempts.HardLocked = true
+	repository.attempts[key] = loginAttempts
+	return nil
+}
+
+func (repository *fakeLoginAttemptRepository) ClearLoginAttempts(ctx context.Context, key string) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	delete(repository.attempts, key)
+	return nil
+}
+
+type fakeFederatedIdentityRepository struct {
+	entity.FederatedIdentityRepository
+	mu         sync.Mutex
+	identities []entity.FederatedIdentity
+}
+
+func (repository *fakeFederatedIdentityRepository) CreateFederatedIdentity(federatedIdentity entity.FederatedIdentity) (*entity.FederatedIdentity, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	federatedIdentity.ID = uint(len(repository.identities) + 1)
+	federatedIdentity.CreatedAt = time.Now()
+	repository.identities = append(repository.identities, federatedIdentity)
+	return &federatedIdentity, nil
+}
+
+func (repository *fakeFederatedIdentityRepository) GetFederatedIdentity(provider string, subject string) (*entity.FederatedIdentity, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	for _, federatedIdentity := range repository.identities {
+		if federatedIdentity.Provider == provider && federatedIdentity.Subject == subject {
+			return &federatedIdentity, nil
+		}
+	}
+	return nil, entity.ErrFederatedIdentityNotFound
+}
+
+func (repository *fakeFederatedIdentityRepository) GetFederatedIdentities(userID uint) ([]entity.FederatedIdentity, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	var federatedIdentities []entity.FederatedIdentity
+	for _, federatedIdentity := range repository.identities {
+		if federatedIdentity.UserID == userID {
+			federatedIdentities = append(federatedIdentities, federatedIdentity)
+		}
+	}
+	return federatedIdentities, nil
+}
+
+type fakeSecurityEventRepository struct {
+	mu     sync.Mutex
+	events []entity.SecurityEvent
+}
+
+func (repository *fakeSecurityEventRepository) CreateSecurityEvent(securityEvent entity.SecurityEvent) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	repository.events = append(repository.events, securityEvent)
+	return nil
+}
+
+type fakeSigningKeyRepository struct {
+	mu          sync.Mutex
+	signingKeys []entity.SigningKey
+}
+
+func (repository *fakeSigningKeyRepository) GetSigningKeys() ([]entity.SigningKey, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	return append([]entity.SigningKey{}, repository.signingKeys...), nil
+}
+
+func (repository *fakeSigningKeyRepository) CreateSigningKey(signingKey entity.SigningKey) (*entity.SigningKey, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	signingKey.ID = uint(len(repository.signingKeys) + 1)
+	signingKey.CreatedAt = time.Now()
+	repository.signingKeys = append(repository.signingKeys, signingKey)
+	return &signingKey, nil
+}
+
+func (repository *fakeSigningKeyRepository) UpdateSigningKey(signingKey entity.SigningKey) (*entity.SigningKey, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	for i, stored := range repository.signingKeys {
+		if stored.ID == signingKey.ID {
+			repository.signingKeys[i] = signingKey
+			return &signingKey, nil
+		}
+	}
+	return nil, errFakeNotFound
+}
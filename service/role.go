@@ -0,0 +1,140 @@
+package service
+
+import (
+	"errors"
+	"golang-api/dto"
+	"golang-api/entity"
+)
+
+// Different types of error returned by the RoleService
+var (
+	ErrBuiltInRole = errors.New("built-in roles cannot be modified")
+	ErrRoleInUse   = errors.New("role is assigned to users")
+	ErrLastAdmin   = errors.New("the last admin cannot be demoted or deleted")
+)
+
+type RoleService interface {
+	GetRoles() (*dto.RolesResponse, error)
+	GetRole(name string) (*dto.RoleResponse, error)
+	CreateRole(role dto.CreateRoleRequest) (*dto.RoleResponse, error)
+	UpdateRole(role dto.UpdateRoleRequest) (*dto.RoleResponse, error)
+	DeleteRole(name string) error
+	AssignRole(assignRoleRequest dto.AssignRoleRequest) (*dto.UserResponse, error)
+}
+
+type roleService struct {
+	roleRepository entity.RoleRepository
+	userRepository entity.UserRepository
+}
+
+func NewRoleService(roleRepository entity.RoleRepository, userRepository entity.UserRepository) RoleService {
+	return &roleService{
+		roleRepository: roleRepository,
+		userRepository: userRepository,
+	}
+}
+
+func (service *roleService) GetRoles() (*dto.RolesResponse, error) {
+	roles, err := service.roleRepository.GetRoles()
+	if err != nil {
+		return nil, err
+	}
+	return dto.NewRolesResponse(roles), nil
+}
+
+func (service *roleService) GetRole(name string) (*dto.RoleResponse, error) {
+	role, err := service.roleRepository.GetRoleByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return dto.NewRoleResponse(*role), nil
+}
+
+func (service *roleService) CreateRole(createRoleRequest dto.CreateRoleRequest) (*dto.RoleResponse, error) {
+	role, err := service.roleRepository.CreateRole(*createRoleRequest.ToEntity())
+	if err != nil {
+		return nil, err
+	}
+	return dto.NewRoleResponse(*role), nil
+}
+
+func (service *roleService) UpdateRole(updateRoleRequest dto.UpdateRoleRequest) (*dto.RoleResponse, error) {
+	role, err := service.roleRepository.GetRoleByName(updateRoleRequest.Name)
+	if err != nil {
+		return nil, err
+	}
+	if role.BuiltIn {
+		return nil, ErrBuiltInRole
+	}
+	if updateRoleRequest.Description != "" {
+		role.Description = updateRoleRequest.Description
+	}
+	if updateRoleRequest.Permissions != nil {
+		role.Permissions = updateRoleRequest.Permissions
+	}
+
+	role, err = service.roleRepository.UpdateRole(*role)
+	if err != nil {
+		return nil, err
+	}
+	return dto.NewRoleResponse(*role), nil
+}
+
+func (service *roleService) DeleteRole(name string) error {
+	role, err := service.roleRepository.GetRoleByName(name)
+	if err != nil {
+		return err
+	}
+	if role.BuiltIn {
+		return ErrBuiltInRole
+	}
+
+	count, err := service.userRepository.CountUsersByRole(name)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrRoleInUse
+	}
+	return service.roleRepository.DeleteRole(name)
+}
+
+func (service *roleService) AssignRole(assignRoleRequest dto.AssignRoleRequest) (*dto.UserResponse, error) {
+	role, err := service.roleRepository.GetRoleByName(assignRoleRequest.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := service.userRepository.GetUserByID(assignRoleRequest.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if role.Name != entity.RoleAdmin {
+		if err := checkLastAdmin(service.userRepository, *user); err != nil {
+			return nil, err
+		}
+	}
+	user.Role = role.Name
+
+	user, err = service.userRepository.UpdateUser(*user)
+	if err != nil {
+		return nil, err
+	}
+	return dto.NewUserResponse(*user), nil
+}
+
+// checkLastAdmin returns ErrLastAdmin when the user is the only admin left. Someone has to keep
+// the admin role, or roles could never be managed again
+func checkLastAdmin(userRepository entity.UserRepository, user entity.User) error {
+	if user.Role != entity.RoleAdmin {
+		return nil
+	}
+	admins, err := userRepository.CountUsersByRole(entity.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if admins <= 1 {
+		return ErrLastAdmin
+	}
+	return nil
+}
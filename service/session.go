@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"golang-api/dto"
+	"golang-api/entity"
+	"golang-api/util"
+	"sort"
+)
+
+type SessionService interface {
+	GetSessions(ctx context.Context, email string, currentSessionID string) (*dto.SessionsResponse, error)
+	TerminateSession(ctx context.Context, email string, sessionID string) error
+	GetUserSessions(ctx context.Context, userID uint) (*dto.SessionsResponse, error)
+	TerminateUserSession(ctx context.Context, userID uint, sessionID string) error
+}
+
+type sessionService struct {
+	userRepository  entity.UserRepository
+	tokenRepository entity.TokenRepository
+	config          util.Config
+}
+
+func NewSessionService(userRepository entity.UserRepository, tokenRepository entity.TokenRepository, config util.Config) SessionService {
+	return &sessionService{
+		userRepository:  userRepository,
+		tokenRepository: tokenRepository,
+		config:          config,
+	}
+}
+
+// GetSessions lists the active sessions of the user, most recently used first
+func (service *sessionService) GetSessions(ctx context.Context, email string, currentSessionID string) (*dto.SessionsResponse, error) {
+	sessions, err := service.tokenRepository.GetSessions(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastRefreshedAt.After(sessions[j].LastRefreshedAt)
+	})
+	return dto.NewSessionsResponse(sessions, currentSessionID), nil
+}
+
+// TerminateSession revokes the refresh tokens of the session along with its latest access token
+func (service *sessionService) TerminateSession(ctx context.Context, email string, sessionID string) error {
+	session, err := service.tokenRepository.GetSession(ctx, email, sessionID)
+	if err != nil {
+		return err
+	}
+
+	if err := service.tokenRepository.DeleteTokenFamily(ctx, email, session.ID); err != nil {
+		return err
+	}
+	return service.tokenRepository.DenylistAccessToken(ctx, session.AccessTokenID, session.AccessTokenExpiresAt.Add(service.config.TokenLeeway))
+}
+
+func (service *sessionService) GetUserSessions(ctx context.Context, userID uint) (*dto.SessionsResponse, error) {
+	user, err := service.userRepository.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return service.GetSessions(ctx, user.Email, "")
+}
+
+func (service *sessionService) TerminateUserSession(ctx context.Context, userID uint, sessionID string) error {
+	user, err := service.userRepository.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	return service.TerminateSession(ctx, user.Email, sessionID)
+}
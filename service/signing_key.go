@@ -0,0 +1,309 @@
+package service
+
+import (
+	"bytes"
+	"golang-api/dto"
+	"golang-api/entity"
+	"golang-api/util"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type SigningKeyService interface {
+	util.KeyProvider
+	GetSigningKeys() (*dto.SigningKeysResponse, error)
+	RotateSigningKey() (*dto.SigningKeyResponse, error)
+}
+
+// signingKeyService keeps the key ring in sync with the signing_keys table,
+// so every instance picks up rotations made by any other one.
+// The key material is stored encrypted with SIGNING_KEY_ENCRYPTION_KEY, which never enters the database
+type signingKeyService struct {
+	signingKeyRepository entity.SigningKeyRepository
+	ring                 *util.KeyRing
+	encryptionKey        []byte
+	config               util.Config
+	mu                   sync.Mutex
+	loadedAt             time.Time
+}
+
+// NewSigningKeyService loads the key ring. On the first start the table is empty
+// and the key from the configuration is stored as the initial signing key.
+// Keys stored in plaintext by earlier versions are encrypted on the way
+func NewSigningKeyService(signingKeyRepository entity.SigningKeyRepository, bootstrapKey *util.SigningKey, config util.Config) (SigningKeyService, error) {
+	encryptionKey, err := util.NewKeyEncryptionKey(config)
+	if err != nil {
+		return nil, err
+	}
+	service := &signingKeyService{
+		signingKeyRepository: signingKeyRepository,
+		ring:                 util.NewKeyRing(nil, ""),
+		encryptionKey:        encryptionKey,
+		config:               config,
+	}
+
+	signingKeys, err := signingKeyRepository.GetSigningKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(signingKeys) == 0 {
+		keyMaterial, err := util.MarshalKeyMaterial(bootstrapKey)
+		if err != nil {
+			return nil, err
+		}
+		signingKey, err := service.sealedSigningKey(bootstrapKey.ID, bootstrapKey.Method.Alg(), keyMaterial, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		if _, err := signingKeyRepository.CreateSigningKey(signingKey); err != nil {
+			return nil, err
+		}
+	} else if err := service.sealPlaintextKeys(signingKeys); err != nil {
+		return nil, err
+	}
+
+	if err := service.load(); err != nil {
+		return nil, err
+	}
+	service.warnOnConfiguredKey(bootstrapKey)
+	return service, nil
+}
+
+// sealedSigningKey returns the row of a new key, with its material encrypted
+func (service *signingKeyService) sealedSigningKey(keyID string, algorithm string, keyMaterial []byte, notBefore time.Time) (entity.SigningKey, error) {
+	sealed, err := util.SealKeyMaterial(service.encryptionKey, keyID, algorithm, keyMaterial)
+	if err != nil {
+		return entity.SigningKey{}, err
+	}
+	return entity.SigningKey{
+		KeyID:       keyID,
+		Algorithm:   algorithm,
+		KeyMaterial: sealed,
+		NotBefore:   notBefore,
+	}, nil
+}
+
+// sealPlaintextKeys encrypts the keys stored before the key material was encrypted at rest
+func (service *signingKeyService) sealPlaintextKeys(signingKeys []entity.SigningKey) error {
+	for _, signingKey := range signingKeys {
+		if util.IsSealedKeyMaterial(signingKey.KeyMaterial) {
+			continue
+		}
+		sealed, err := util.SealKeyMaterial(service.encryptionKey, signingKey.KeyID, signingKey.Algorithm, []byte(signingKey.KeyMaterial))
+		if err != nil {
+			return err
+		}
+		signingKey.KeyMaterial = sealed
+		if _, err := service.signingKeyRepository.UpdateSigningKey(signingKey); err != nil {
+			return err
+		}
+		log.Printf("Encrypted the stored signing key %s\n", signingKey.KeyID)
+	}
+	return nil
+}
+
+// warnOnConfiguredKey logs when the key of the configuration disagrees with the active key of the table.
+// The configuration only seeds an empty table, tokens keep being signed with the stored keys
+func (service *signingKeyService) warnOnConfiguredKey(configuredKey *util.SigningKey) {
+	activeKey, err := service.ring.SigningKey()
+	if err != nil {
+		log.Printf("Warning: there is no active signing key: %v\n", err)
+		return
+	}
+
+	if activeKey.Method.Alg() != configuredKey.Method.Alg() {
+		log.Printf("Warning: JWT_SIGNING_ALGORITHM is %s but the active signing key %s is %s, rotate the key to switch algorithms\n",
+			configuredKey.Method.Alg(), activeKey.ID, activeKey.Method.Alg())
+		return
+	}
+	activeMaterial, activeErr := util.MarshalKeyMaterial(activeKey)
+	configuredMaterial, configuredErr := util.MarshalKeyMaterial(configuredKey)
+	if activeErr == nil && configuredErr == nil && !bytes.Equal(activeMaterial, configuredMaterial) {
+		log.Printf("Warning: the configured signing key is not the active signing key %s, it only seeds an empty signing_keys table\n", activeKey.ID)
+	}
+}
+
+func (service *signingKeyService) load() error {
+	signingKeys, err := service.signingKeyRepository.GetSigningKeys()
+	if err != nil {
+		return err
+	}
+
+	var ringKeys []util.RingKey
+	for _, signingKey := range signingKeys {
+		ringKey, err := service.toRingKey(signingKey)
+		if err != nil {
+			log.Printf("Skipping signing key %s: %v\n", signingKey.KeyID, err)
+			continue
+		}
+		ringKeys = append(ringKeys, ringKey)
+	}
+
+	// Tokens issued before kid headers existed were signed with the first key
+	legacyKeyID := ""
+	if len(signingKeys) > 0 {
+		legacyKeyID = signingKeys[0].KeyID
+	}
+
+	service.ring.SetKeys(ringKeys, legacyKeyID)
+	service.loadedAt = time.Now()
+	return nil
+}
+
+// refresh reloads the ring once KeyRingRefreshInterval has passed, keeping the current keys if it fails
+func (service *signingKeyService) refresh() {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	if time.Since(service.loadedAt) < service.config.KeyRingRefreshInterval {
+		return
+	}
+	if err := service.load(); err != nil {
+		log.Printf("Failed to reload signing keys: %v\n", err)
+	}
+}
+
+func (service *signingKeyService) SigningKey() (*util.SigningKey, error) {
+	service.refresh()
+	return service.ring.SigningKey()
+}
+
+func (service *signingKeyService) VerificationKey(kid string) (*util.SigningKey, error) {
+	service.refresh()
+	return service.ring.VerificationKey(kid)
+}
+
+func (service *signingKeyService) VerificationKeys() []*util.SigningKey {
+	service.refresh()
+	return service.ring.VerificationKeys()
+}
+
+func (service *signingKeyService) GetSigningKeys() (*dto.SigningKeysResponse, error) {
+	signingKeys, err := service.signingKeyRepository.GetSigningKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	activeKeyID := ""
+	if activeKey, err := service.SigningKey(); err == nil {
+		activeKeyID = activeKey.ID
+	}
+
+	var signingKeysResponse dto.SigningKeysResponse
+	for _, signingKey := range signingKeys {
+		signingKeysResponse = append(signingKeysResponse, newSigningKeyResponse(signingKey, activeKeyID))
+	}
+	return &signingKeysResponse, nil
+}
+
+// RotateSigningKey generates a new key that starts signing after the grace period, leaving time for
+// verifiers to fetch it from the JWKS. The keys in use are retired once every token they may still sign has expired
+func (service *signingKeyService) RotateSigningKey() (*dto.SigningKeyResponse, error) {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	algorithm := service.config.JWTSigningAlgorithm
+	if algorithm == "" {
+		algorithm = util.AlgorithmHS256
+	}
+
+	keyMaterial, err := util.GenerateKeyMaterial(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	// Shared secrets have no thumbprint to derive a kid from
+	keyID := ""
+	if algorithm == util.AlgorithmHS256 {
+		keyID = uuid.New().String()
+	}
+	newKey, err := util.ParseSigningKey(keyID, algorithm, keyMaterial)
+	if err != nil {
+		return nil, err
+	}
+
+	notBefore := time.Now().Add(service.config.KeyRotationGracePeriod)
+	// The old keys are trusted until the longest lived token they signed expires, past the leeway
+	tokenLifetime := service.config.AccessTokenDuration
+	for _, duration := range []time.Duration{service.config.RefreshTokenDuration, service.config.OAuthClientTokenDuration} {
+		if duration > tokenLifetime {
+			tokenLifetime = duration
+		}
+	}
+	retireAfter := notBefore.Add(tokenLifetime + service.config.TokenLeeway)
+
+	signingKeys, err := service.signingKeyRepository.GetSigningKeys()
+	if err != nil {
+		return nil, err
+	}
+	for _, signingKey := range signingKeys {
+		if signingKey.RetireAfter != nil {
+			continue
+		}
+		signingKey.RetireAfter = &retireAfter
+		if _, err := service.signingKeyRepository.UpdateSigningKey(signingKey); err != nil {
+			return nil, err
+		}
+	}
+
+	sealedKey, err := service.sealedSigningKey(newKey.ID, algorithm, keyMaterial, notBefore)
+	if err != nil {
+		return nil, err
+	}
+	signingKey, err := service.signingKeyRepository.CreateSigningKey(sealedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := service.load(); err != nil {
+		return nil, err
+	}
+	return newSigningKeyResponse(*signingKey, ""), nil
+}
+
+// toRingKey decrypts a stored key. Plaintext material is refused, the keys stored before are sealed on startup
+func (service *signingKeyService) toRingKey(signingKey entity.SigningKey) (util.RingKey, error) {
+	keyMaterial, err := util.OpenKeyMaterial(service.encryptionKey, signingKey.KeyID, signingKey.Algorithm, signingKey.KeyMaterial)
+	if err != nil {
+		return util.RingKey{}, err
+	}
+	parsedKey, err := util.ParseSigningKey(signingKey.KeyID, signingKey.Algorithm, keyMaterial)
+	if err != nil {
+		return util.RingKey{}, err
+	}
+
+	ringKey := util.RingKey{
+		SigningKey: parsedKey,
+		NotBefore:  signingKey.NotBefore,
+	}
+	if signingKey.RetireAfter != nil {
+		ringKey.RetireAfter = *signingKey.RetireAfter
+	}
+	return ringKey, nil
+}
+
+func newSigningKeyResponse(signingKey entity.SigningKey, activeKeyID string) *dto.SigningKeyResponse {
+	now := time.Now()
+	status := dto.SigningKeyStatusActive
+	switch {
+	case signingKey.RetireAfter != nil && !now.Before(*signingKey.RetireAfter):
+		status = dto.SigningKeyStatusRetired
+	case signingKey.NotBefore.After(now):
+		status = dto.SigningKeyStatusPending
+	case signingKey.KeyID != activeKeyID:
+		status = dto.SigningKeyStatusRetiring
+	}
+
+	return &dto.SigningKeyResponse{
+		KeyID:       signingKey.KeyID,
+		Algorithm:   signingKey.Algorithm,
+		Status:      status,
+		NotBefore:   signingKey.NotBefore,
+		RetireAfter: signingKey.RetireAfter,
+		CreatedAt:   signingKey.CreatedAt,
+	}
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"golang-api/entity"
+	"golang-api/util"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testSigningKeyConfig() util.Config {
+	return util.Config{
+		JWTSigningAlgorithm:     util.AlgorithmES256,
+		SigningKeyEncryptionKey: strings.Repeat("2a", 32),
+		KeyRingRefreshInterval:  time.Minute,
+		KeyRotationGracePeriod:  time.Hour,
+		AccessTokenDuration:     time.Hour,
+	}
+}
+
+func newTestSigningKey(t *testing.T, algorithm string) (*util.SigningKey, []byte) {
+	t.Helper()
+	keyMaterial, err := util.GenerateKeyMaterial(algorithm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingKey, err := util.ParseSigningKey("", algorithm, keyMaterial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signingKey, keyMaterial
+}
+
+func TestSigningKeysAreEncryptedAtRest(t *testing.T) {
+	bootstrapKey, keyMaterial := newTestSigningKey(t, util.AlgorithmES256)
+	signingKeyRepository := &fakeSigningKeyRepository{}
+
+	service, err := NewSigningKeyService(signingKeyRepository, bootstrapKey, testSigningKeyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.RotateSigningKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, signingKey := range signingKeyRepository.signingKeys {
+		if strings.Contains(signingKey.KeyMaterial, "PRIVATE KEY") || strings.Contains(signingKey.KeyMaterial, string(keyMaterial)) {
+			t.Errorf("key %s is stored in plaintext", signingKey.KeyID)
+		}
+	}
+	if activeKey, err := service.SigningKey(); err != nil || activeKey.ID != bootstrapKey.ID {
+		t.Errorf("active key %v (%v), want the bootstrap key %s until the grace period ends", activeKey, err, bootstrapKey.ID)
+	}
+	if len(service.VerificationKeys()) != 2 {
+		t.Errorf("%d verification keys, want the bootstrap and the rotated key", len(service.VerificationKeys()))
+	}
+
+	// Without the encryption key of the table, no key can be read
+	config := testSigningKeyConfig()
+	config.SigningKeyEncryptionKey = strings.Repeat("2b", 32)
+	other, err := NewSigningKeyService(signingKeyRepository, bootstrapKey, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.SigningKey(); err == nil {
+		t.Errorf("keys were read with another encryption key")
+	}
+}
+
+func TestPlaintextSigningKeysAreSealedOnStartup(t *testing.T) {
+	bootstrapKey, keyMaterial := newTestSigningKey(t, util.AlgorithmES256)
+	signingKeyRepository := &fakeSigningKeyRepository{}
+	signingKeyRepository.CreateSigningKey(entity.SigningKey{
+		KeyID:       bootstrapKey.ID,
+		Algorithm:   util.AlgorithmES256,
+		KeyMaterial: string(keyMaterial),
+		NotBefore:   time.Now().Add(-time.Hour),
+	})
+
+	service, err := NewSigningKeyService(signingKeyRepository, bootstrapKey, testSigningKeyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !util.IsSealedKeyMaterial(signingKeyRepository.signingKeys[0].KeyMaterial) {
+		t.Errorf("the plaintext key was not sealed")
+	}
+	if activeKey, err := service.SigningKey(); err != nil || activeKey.ID != bootstrapKey.ID {
+		t.Errorf("active key %v (%v), want the stored key %s", activeKey, err, bootstrapKey.ID)
+	}
+}
+
+func TestSigningKeyServiceRequiresEncryptionKey(t *testing.T) {
+	bootstrapKey, _ := newTestSigningKey(t, util.AlgorithmES256)
+	config := testSigningKeyConfig()
+	config.SigningKeyEncryptionKey = ""
+
+	if _, err := NewSigningKeyService(&fakeSigningKeyRepository{}, bootstrapKey, config); err == nil {
+		t.Errorf("started without SIGNING_KEY_ENCRYPTION_KEY")
+	}
+}
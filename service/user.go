@@ -1,31 +1,44 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"golang-api/dto"
 	"golang-api/entity"
 	"golang-api/util"
+	"log"
 )
 
+// ErrRoleOutranked is returned when updating a user whose role grants permissions the caller's role lacks
+var ErrRoleOutranked = errors.New("the user's role outranks the caller's role")
+
 type UserService interface {
 	CreateUser(user dto.CreateUserRequest) (*dto.UserResponse, error)
 	GetUsers() (*dto.UsersResponse, error)
 	GetUserByID(ID uint) (*dto.UserResponse, error)
 	UpdateUser(user dto.UpdateUserRequest) (*dto.UserResponse, error)
-	DeleteUser(ID uint) error
+	DeleteUser(ID uint, callerPermissions []string) error
+	CountLegacyPasswordHashes() (int64, error)
 }
 
 type userService struct {
-	userRepository entity.UserRepository
+	userRepository           entity.UserRepository
+	roleRepository           entity.RoleRepository
+	emailVerificationService EmailVerificationService
+	passwordHashers          *util.PasswordHasherRegistry
 }
 
-func NewUserService(repository entity.UserRepository) UserService {
+func NewUserService(repository entity.UserRepository, roleRepository entity.RoleRepository, emailVerificationService EmailVerificationService, passwordHashers *util.PasswordHasherRegistry) UserService {
 	return &userService{
-		userRepository: repository,
+		userRepository:           repository,
+		roleRepository:           roleRepository,
+		emailVerificationService: emailVerificationService,
+		passwordHashers:          passwordHashers,
 	}
 }
 
 func (service *userService) CreateUser(createUserRequest dto.CreateUserRequest) (*dto.UserResponse, error) {
-	hashedPassword, err := util.HashPassword(createUserRequest.Password)
+	hashedPassword, err := service.passwordHashers.Hash(createUserRequest.Password)
 	if err != nil {
 		return nil, err
 	}
@@ -35,6 +48,11 @@ func (service *userService) CreateUser(createUserRequest dto.CreateUserRequest)
 	if err != nil {
 		return nil, err
 	}
+
+	// The account exists either way, a failed mail can be retried through the resend endpoint
+	if err := service.emailVerificationService.SendVerification(context.Background(), *user); err != nil {
+		log.Printf("Failed to start the email verification of %s: %v\n", user.Email, err)
+	}
 	return dto.NewUserResponse(*user), nil
 }
 
@@ -59,8 +77,15 @@ func (service *userService) UpdateUser(updateUserRequest dto.UpdateUserRequest)
 	if err != nil {
 		return nil, err
 	}
-	if updateUserRequest.Email != "" {
-		user.Email = updateUserRequest.Email
+	if err := service.checkRoleRank(updateUserRequest.CallerPermissions, user.Role); err != nil {
+		return nil, err
+	}
+	// A new email only becomes the user's email once verified
+	if updateUserRequest.Email != "" && updateUserRequest.Email != user.Email {
+		if err := service.emailVerificationService.RequestEmailChange(context.Background(), *user, updateUserRequest.Email); err != nil {
+			return nil, err
+		}
+		user.PendingEmail = updateUserRequest.Email
 	}
 	if updateUserRequest.FirstName != "" {
 		user.FirstName = updateUserRequest.FirstName
@@ -69,7 +94,11 @@ func (service *userService) UpdateUser(updateUserRequest dto.UpdateUserRequest)
 		user.LastName = updateUserRequest.LastName
 	}
 	if updateUserRequest.Password != "" {
-		user.Password = updateUserRequest.Password
+		hashedPassword, err := service.passwordHashers.Hash(updateUserRequest.Password)
+		if err != nil {
+			return nil, err
+		}
+		user.Password = hashedPassword
 	}
 
 	user, err = service.userRepository.UpdateUser(*user)
@@ -78,6 +107,36 @@ func (service *userService) UpdateUser(updateUserRequest dto.UpdateUserRequest)
 	}
 	return dto.NewUserResponse(*user), nil
 }
-func (service *userService) DeleteUser(ID uint) error {
+
+// checkRoleRank returns ErrRoleOutranked unless the caller has every permission of the user's role,
+// so an operator cannot take over or delete an admin account
+func (service *userService) checkRoleRank(callerPermissions []string, userRole string) error {
+	role, err := service.roleRepository.GetRoleByName(userRole)
+	if err != nil {
+		return err
+	}
+	if !entity.GrantsAll(callerPermissions, role.Permissions) {
+		return ErrRoleOutranked
+	}
+	return nil
+}
+
+// DeleteUser deletes the user, unless its role outranks the caller or it is the last admin
+func (service *userService) DeleteUser(ID uint, callerPermissions []string) error {
+	user, err := service.userRepository.GetUserByID(ID)
+	if err != nil {
+		return err
+	}
+	if err := service.checkRoleRank(callerPermissions, user.Role); err != nil {
+		return err
+	}
+	if err := checkLastAdmin(service.userRepository, *user); err != nil {
+		return err
+	}
 	return service.userRepository.DeleteUser(ID)
 }
+
+// CountLegacyPasswordHashes counts the users whose hash will be upgraded on their next login
+func (service *userService) CountLegacyPasswordHashes() (int64, error) {
+	return service.userRepository.CountLegacyPasswordHashes(service.passwordHashers.CurrentPrefix())
+}
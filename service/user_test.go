@@ -0,0 +1,48 @@
+package service
+
+import (
+	"errors"
+	"golang-api/entity"
+	"testing"
+)
+
+// operatorWithDelete is a custom role that may delete users without holding every permission
+var operatorWithDelete = []string{entity.PermissionUsersRead, entity.PermissionUsersUpdate, entity.PermissionUsersDelete}
+
+func TestDeleteUserRejectsOutrankingRole(t *testing.T) {
+	userRepository := newFakeUserRepository(
+		entity.User{Email: "admin@example.com", Role: entity.RoleAdmin},
+		entity.User{Email: "second-admin@example.com", Role: entity.RoleAdmin},
+		entity.User{Email: "member@example.com", Role: entity.RoleMember},
+	)
+	service := NewUserService(userRepository, fakeRoleRepository{}, nil, nil)
+
+	if err := service.DeleteUser(1, operatorWithDelete); !errors.Is(err, ErrRoleOutranked) {
+		t.Errorf("deleting an admin: err = %v, want ErrRoleOutranked", err)
+	}
+	if err := service.DeleteUser(3, operatorWithDelete); err != nil {
+		t.Errorf("deleting a member: %v", err)
+	}
+	if userRepository.count() != 2 {
+		t.Errorf("%d users left, want the 2 admins", userRepository.count())
+	}
+}
+
+func TestDeleteUserKeepsLastAdmin(t *testing.T) {
+	userRepository := newFakeUserRepository(
+		entity.User{Email: "admin@example.com", Role: entity.RoleAdmin},
+		entity.User{Email: "second-admin@example.com", Role: entity.RoleAdmin},
+	)
+	service := NewUserService(userRepository, fakeRoleRepository{}, nil, nil)
+	adminPermissions := []string{entity.PermissionAll}
+
+	if err := service.DeleteUser(2, adminPermissions); err != nil {
+		t.Fatalf("deleting one of two admins: %v", err)
+	}
+	if err := service.DeleteUser(1, adminPermissions); !errors.Is(err, ErrLastAdmin) {
+		t.Errorf("deleting the last admin: err = %v, want ErrLastAdmin", err)
+	}
+	if userRepository.count() != 1 {
+		t.Errorf("%d users left, want the last admin", userRepository.count())
+	}
+}
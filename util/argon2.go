@@ -0,0 +1,101 @@
+package util
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+type argon2idParams struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+type argon2idHasher struct {
+	params argon2idParams
+}
+
+// NewArgon2idHasher returns a hasher for argon2id, memory is in KiB. Zero values fall back to the RFC 9106 second recommended option
+func NewArgon2idHasher(memory uint32, iterations uint32, parallelism uint8) PasswordHasher {
+	params := argon2idParams{memory, iterations, parallelism}
+	if params.memory == 0 {
+		params.memory = 64 * 1024
+	}
+	if params.iterations == 0 {
+		params.iterations = 3
+	}
+	if params.parallelism == 0 {
+		params.parallelism = 4
+	}
+	return &argon2idHasher{params}
+}
+
+func (hasher *argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, hasher.params.iterations, hasher.params.memory, hasher.params.parallelism, argon2KeyLength)
+	return hasher.Prefix() + base64.RawStdEncoding.EncodeToString(salt) + "$" + base64.RawStdEncoding.EncodeToString(key), nil
+}
+
+func (hasher *argon2idHasher) Verify(password string, encodedHash string) error {
+	params, salt, key, err := decodeArgon2idHash(encodedHash)
+	if err != nil {
+		return err
+	}
+
+	computed := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(computed, key) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func (hasher *argon2idHasher) Outdated(encodedHash string) bool {
+	params, salt, key, err := decodeArgon2idHash(encodedHash)
+	return err != nil || params != hasher.params || len(salt) != argon2SaltLength || len(key) != argon2KeyLength
+}
+
+func (hasher *argon2idHasher) Prefix() string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$", argon2.Version, hasher.params.memory, hasher.params.iterations, hasher.params.parallelism)
+}
+
+// decodeArgon2idHash parses $argon2id$v=19$m=65536,t=3,p=4$salt$key
+func decodeArgon2idHash(encodedHash string) (argon2idParams, []byte, []byte, error) {
+	var params argon2idParams
+
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 6 || parts[1] != PasswordHashArgon2id {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+	return params, salt, key, nil
+}
@@ -1,19 +1,45 @@
 package util
 
 import (
+	"errors"
+	"fmt"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
-// HashPassword returns the bcrypt hash of the password
-func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+type bcryptHasher struct {
+	cost int
+}
+
+// NewBcryptHasher returns a hasher for bcrypt, kept to verify and upgrade the hashes made before argon2id
+func NewBcryptHasher(cost int) PasswordHasher {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	return &bcryptHasher{cost}
+}
+
+func (hasher *bcryptHasher) Hash(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), hasher.cost)
 	if err != nil {
 		return "", err
 	}
 	return string(hashedPassword), nil
 }
 
-// CheckPassword checks if the provided password is correct or not
-func CheckPassword(password string, hashedPassword string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+func (hasher *bcryptHasher) Verify(password string, encodedHash string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(encodedHash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+func (hasher *bcryptHasher) Outdated(encodedHash string) bool {
+	cost, err := bcrypt.Cost([]byte(encodedHash))
+	return err != nil || cost != hasher.cost
+}
+
+func (hasher *bcryptHasher) Prefix() string {
+	return fmt.Sprintf("$2a$%02d$", hasher.cost)
 }
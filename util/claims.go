@@ -0,0 +1,401 @@
+package util
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Values of the token_use claim, so a refresh token is never taken for an access token or the other way round
+const (
+	TokenUseAccess  = "access_token"
+	TokenUseRefresh = "refresh_token"
+)
+
+// Authentication methods of the amr claim, see RFC 8176. Federated logins are fed, which the RFC leaves out
+const (
+	AMRPassword        = "pwd"
+	AMROneTimePassword = "otp"
+	AMRFederated       = "fed"
+)
+
+// ClaimsPolicy sets the registered claims of RFC 7519 on new tokens and checks them on verification,
+// so a token minted for one environment is not accepted by another sharing its key
+type ClaimsPolicy struct {
+	Issuer string
+	// Audience is set on new tokens, AllowedAudiences are accepted along it
+	Audience         string
+	AllowedAudiences []string
+	// Leeway is the clock skew tolerated on exp, nbf and iat
+	Leeway time.Duration
+	// AcceptLegacyTokens accepts tokens issued before the registered claims, which have no issuer or audience,
+	// and tokens issued before the token_use claim
+	AcceptLegacyTokens bool
+	// TokenUse is set on new tokens and required on verified ones
+	TokenUse string
+}
+
+// NewClaimsPolicy reads the policy of the tokens of the given use from TOKEN_ISSUER, TOKEN_AUDIENCE,
+// TOKEN_ALLOWED_AUDIENCES, TOKEN_LEEWAY and ACCEPT_LEGACY_TOKENS. The issuer defaults to OIDC_ISSUER
+func NewClaimsPolicy(config Config, tokenUse string) ClaimsPolicy {
+	issuer := config.TokenIssuer
+	if issuer == "" {
+		issuer = config.OIDCIssuer
+	}
+
+	allowedAudiences := []string{config.TokenAudience}
+	for _, audience := range strings.Split(config.TokenAllowedAudiences, ",") {
+		if audience = strings.TrimSpace(audience); audience != "" {
+			allowedAudiences = append(allowedAudiences, audience)
+		}
+	}
+
+	return ClaimsPolicy{
+		Issuer:             issuer,
+		Audience:           config.TokenAudience,
+		AllowedAudiences:   allowedAudiences,
+		Leeway:             config.TokenLeeway,
+		AcceptLegacyTokens: config.AcceptLegacyTokens,
+		TokenUse:           tokenUse,
+	}
+}
+
+// newPayload builds the claims of a new token. Times are truncated to the second, as they are encoded
+func (policy ClaimsPolicy) newPayload(subject TokenSubject, duration time.Duration) (*JWTPayload, error) {
+	tokenID, err := uuid.NewUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	principalType := subject.PrincipalType
+	if principalType == "" {
+		principalType = PrincipalUser
+	}
+
+	now := time.Now().Truncate(time.Second)
+	jwtPayload := &JWTPayload{
+		ID:            tokenID,
+		Issuer:        policy.Issuer,
+		Audience:      []string{policy.Audience},
+		TokenUse:      policy.TokenUse,
+		UserID:        subject.UserID,
+		UserEmail:     subject.Email,
+		Role:          subject.Role,
+		Permissions:   subject.Permissions,
+		SessionID:     subject.SessionID,
+		IssuedAt:      now,
+		NotBefore:     now,
+		ExpiredAt:     now.Add(duration),
+		PrincipalType: principalType,
+		ClientID:      subject.ClientID,
+		Scopes:        subject.Scopes,
+		AuthTime:      subject.AuthTime,
+		AMR:           subject.AMR,
+	}
+	if subject.JKT != "" {
+		jwtPayload.Confirmation = &Confirmation{JKT: subject.JKT}
+	}
+
+	return jwtPayload, nil
+}
+
+// validate checks the claims of a token whose signature or encryption was verified
+func (policy ClaimsPolicy) validate(jwtPayload *JWTPayload) error {
+	now := time.Now()
+
+	if jwtPayload.Legacy {
+		if !policy.AcceptLegacyTokens {
+			return ErrInvalidToken
+		}
+		if now.After(jwtPayload.ExpiredAt.Add(policy.Leeway)) {
+			return ErrExpiredToken
+		}
+		return nil
+	}
+
+	if jwtPayload.Issuer != policy.Issuer || !policy.allowsAudience(jwtPayload.Audience) {
+		return ErrInvalidToken
+	}
+	if jwtPayload.TokenUse != policy.TokenUse && !(jwtPayload.Untyped() && policy.AcceptLegacyTokens) {
+		return ErrInvalidToken
+	}
+	if jwtPayload.ExpiredAt.IsZero() || jwtPayload.IssuedAt.After(now.Add(policy.Leeway)) || jwtPayload.NotBefore.After(now.Add(policy.Leeway)) {
+		return ErrInvalidToken
+	}
+	if now.After(jwtPayload.ExpiredAt.Add(policy.Leeway)) {
+		return ErrExpiredToken
+	}
+	return nil
+}
+
+func (policy ClaimsPolicy) allowsAudience(audiences []string) bool {
+	for _, audience := range audiences {
+		for _, allowed := range policy.AllowedAudiences {
+			if audience == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// registeredClaims is the encoding of a JWTPayload. sub is the user ID, or the client ID of service principals
+type registeredClaims struct {
+	ID            string        `json:"jti"`
+	Issuer        string        `json:"iss"`
+	Subject       string        `json:"sub"`
+	Audience      audience      `json:"aud"`
+	TokenUse      string        `json:"token_use,omitempty"`
+	IssuedAt      int64         `json:"iat"`
+	NotBefore     int64         `json:"nbf"`
+	ExpiresAt     int64         `json:"exp"`
+	Email         string        `json:"email,omitempty"`
+	Role          string        `json:"role,omitempty"`
+	Permissions   []string      `json:"permissions"`
+	SessionID     string        `json:"sid,omitempty"`
+	PrincipalType string        `json:"principal_type"`
+	ClientID      string        `json:"client_id,omitempty"`
+	Scopes        []string      `json:"scopes,omitempty"`
+	Confirmation  *Confirmation `json:"cnf,omitempty"`
+	AuthTime      int64         `json:"auth_time,omitempty"`
+	AMR           []string      `json:"amr,omitempty"`
+}
+
+// legacyClaims is how tokens were encoded before the registered claims, accepted until they expire
+type legacyClaims struct {
+	ID            uuid.UUID
+	UserID        uint
+	UserEmail     string
+	Role          string
+	Permissions   []string
+	SessionID     string
+	IssuedAt      time.Time
+	ExpiredAt     time.Time
+	PrincipalType string
+	ClientID      string        `json:",omitempty"`
+	Scopes        []string      `json:",omitempty"`
+	Confirmation  *Confirmation `json:"cnf,omitempty"`
+}
+
+// audience is a single string or an array of strings, see RFC 7519 section 4.1.3
+type audience []string
+
+func (aud *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*aud = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*aud = list
+	return nil
+}
+
+func (jwtPayload *JWTPayload) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jwtPayload.registeredClaims())
+}
+
+func (jwtPayload *JWTPayload) registeredClaims() registeredClaims {
+	claims := registeredClaims{
+		ID:            jwtPayload.ID.String(),
+		Issuer:        jwtPayload.Issuer,
+		Subject:       jwtPayload.Subject(),
+		Audience:      jwtPayload.Audience,
+		TokenUse:      jwtPayload.TokenUse,
+		IssuedAt:      jwtPayload.IssuedAt.Unix(),
+		NotBefore:     jwtPayload.NotBefore.Unix(),
+		ExpiresAt:     jwtPayload.ExpiredAt.Unix(),
+		Email:         jwtPayload.UserEmail,
+		Role:          jwtPayload.Role,
+		Permissions:   jwtPayload.Permissions,
+		SessionID:     jwtPayload.SessionID,
+		PrincipalType: jwtPayload.PrincipalType,
+		ClientID:      jwtPayload.ClientID,
+		Scopes:        jwtPayload.Scopes,
+		Confirmation:  jwtPayload.Confirmation,
+		AMR:           jwtPayload.AMR,
+	}
+	if !jwtPayload.AuthTime.IsZero() {
+		claims.AuthTime = jwtPayload.AuthTime.Unix()
+	}
+	return claims
+}
+
+// UnmarshalJSON decodes the registered claims, or the legacy encoding which is told apart by its ExpiredAt
+func (jwtPayload *JWTPayload) UnmarshalJSON(data []byte) error {
+	var probe struct {
+		ExpiredAt json.RawMessage
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return err
+	}
+	if probe.ExpiredAt != nil {
+		var legacy legacyClaims
+		if err := json.Unmarshal(data, &legacy); err != nil {
+			return err
+		}
+		*jwtPayload = JWTPayload{
+			ID:            legacy.ID,
+			UserID:        legacy.UserID,
+			UserEmail:     legacy.UserEmail,
+			Role:          legacy.Role,
+			Permissions:   legacy.Permissions,
+			SessionID:     legacy.SessionID,
+			IssuedAt:      legacy.IssuedAt,
+			ExpiredAt:     legacy.ExpiredAt,
+			PrincipalType: legacy.PrincipalType,
+			ClientID:      legacy.ClientID,
+			Scopes:        legacy.Scopes,
+			Confirmation:  legacy.Confirmation,
+			Legacy:        true,
+		}
+		return nil
+	}
+
+	var claims registeredClaims
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return err
+	}
+	return jwtPayload.setRegisteredClaims(claims)
+}
+
+func (jwtPayload *JWTPayload) setRegisteredClaims(claims registeredClaims) error {
+	tokenID, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return err
+	}
+	*jwtPayload = JWTPayload{
+		ID:            tokenID,
+		Issuer:        claims.Issuer,
+		Audience:      claims.Audience,
+		TokenUse:      claims.TokenUse,
+		UserEmail:     claims.Email,
+		Role:          claims.Role,
+		Permissions:   claims.Permissions,
+		SessionID:     claims.SessionID,
+		IssuedAt:      time.Unix(claims.IssuedAt, 0),
+		NotBefore:     time.Unix(claims.NotBefore, 0),
+		ExpiredAt:     time.Unix(claims.ExpiresAt, 0),
+		PrincipalType: claims.PrincipalType,
+		ClientID:      claims.ClientID,
+		Scopes:        claims.Scopes,
+		Confirmation:  claims.Confirmation,
+		AMR:           claims.AMR,
+	}
+	if claims.ExpiresAt == 0 {
+		jwtPayload.ExpiredAt = time.Time{}
+	}
+	if claims.AuthTime != 0 {
+		jwtPayload.AuthTime = time.Unix(claims.AuthTime, 0)
+	}
+	if !jwtPayload.IsService() {
+		userID, err := strconv.ParseUint(claims.Subject, 10, 64)
+		if err != nil {
+			return err
+		}
+		jwtPayload.UserID = uint(userID)
+	}
+	return nil
+}
+
+// pasetoClaims is the encoding of a JWTPayload in PASETO tokens, whose aud is a string and exp, iat and nbf are
+// RFC 3339 strings, see https://github.com/paseto-standard/paseto-spec/blob/master/docs/02-Implementation-Guide/04-Claims.md
+type pasetoClaims struct {
+	registeredClaims
+	Audience  pasetoAudience `json:"aud"`
+	IssuedAt  pasetoTime     `json:"iat"`
+	NotBefore pasetoTime     `json:"nbf"`
+	ExpiresAt pasetoTime     `json:"exp"`
+}
+
+// pasetoAudience is written as a single string. Lists are still read, PASETO tokens were issued with them at first
+type pasetoAudience []string
+
+func (aud pasetoAudience) MarshalJSON() ([]byte, error) {
+	if len(aud) == 1 {
+		return json.Marshal(aud[0])
+	}
+	return json.Marshal([]string(aud))
+}
+
+func (aud *pasetoAudience) UnmarshalJSON(data []byte) error {
+	return (*audience)(aud).UnmarshalJSON(data)
+}
+
+// pasetoTime is an RFC 3339 time. Numeric dates are still read, PASETO tokens were issued with them at first
+type pasetoTime int64
+
+func (t pasetoTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Unix(int64(t), 0).UTC().Format(time.RFC3339))
+}
+
+func (t *pasetoTime) UnmarshalJSON(data []byte) error {
+	var numericDate int64
+	if err := json.Unmarshal(data, &numericDate); err == nil {
+		*t = pasetoTime(numericDate)
+		return nil
+	}
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return err
+	}
+	*t = pasetoTime(parsed.Unix())
+	return nil
+}
+
+func marshalPasetoClaims(jwtPayload *JWTPayload) ([]byte, error) {
+	claims := pasetoClaims{
+		registeredClaims: jwtPayload.registeredClaims(),
+		IssuedAt:         pasetoTime(jwtPayload.IssuedAt.Unix()),
+		NotBefore:        pasetoTime(jwtPayload.NotBefore.Unix()),
+		ExpiresAt:        pasetoTime(jwtPayload.ExpiredAt.Unix()),
+	}
+	claims.Audience = pasetoAudience(jwtPayload.Audience)
+	return json.Marshal(claims)
+}
+
+func unmarshalPasetoClaims(message []byte) (*JWTPayload, error) {
+	var claims pasetoClaims
+	if err := json.Unmarshal(message, &claims); err != nil {
+		return nil, err
+	}
+	claims.registeredClaims.Audience = audience(claims.Audience)
+	claims.registeredClaims.IssuedAt = int64(claims.IssuedAt)
+	claims.registeredClaims.NotBefore = int64(claims.NotBefore)
+	claims.registeredClaims.ExpiresAt = int64(claims.ExpiresAt)
+
+	jwtPayload := &JWTPayload{}
+	if err := jwtPayload.setRegisteredClaims(claims.registeredClaims); err != nil {
+		return nil, err
+	}
+	return jwtPayload, nil
+}
+
+// Subject is the sub claim, the stable ID of the user rather than its email, or the client ID of service principals
+func (jwtPayload *JWTPayload) Subject() string {
+	if jwtPayload.IsService() {
+		return jwtPayload.ClientID
+	}
+	return strconv.FormatUint(uint64(jwtPayload.UserID), 10)
+}
+
+// Untyped tells tokens issued before the token_use claim, which may be access or refresh tokens.
+// Only the stored refresh token state tells them apart
+func (jwtPayload *JWTPayload) Untyped() bool {
+	return jwtPayload.TokenUse == ""
+}
+
+// AuthenticatedWithin tells whether the user authenticated within maxAge. Tokens without auth_time never did
+func (jwtPayload *JWTPayload) AuthenticatedWithin(maxAge time.Duration) bool {
+	return !jwtPayload.AuthTime.IsZero() && time.Since(jwtPayload.AuthTime) <= maxAge
+}
@@ -1,6 +1,8 @@
 package util
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
@@ -9,18 +11,87 @@ import (
 // Config stores all configuration of the application.
 // The values are read by viper from a config file or environment variable.
 type Config struct {
-	HTTPServerAddress    string        `mapstructure:"HTTP_SERVER_ADDRESS"`
-	AccessTokenDuration  time.Duration `mapstructure:"ACCESS_TOKEN_DURATION"`
-	RefreshTokenDuration time.Duration `mapstructure:"REFRESH_TOKEN_DURATION"`
-	JWTSecretKey         string        `mapstructure:"JWT_SECRET_KEY"`
-	DBHost               string        `mapstructure:"DB_HOST"`
-	DBDriver             string        `mapstructure:"DB_DRIVER"`
-	DBUser               string        `mapstructure:"DB_USER"`
-	DBPassword           string        `mapstructure:"DB_PASSWORD"`
-	DBName               string        `mapstructure:"DB_NAME"`
-	DBPort               string        `mapstructure:"DB_PORT"`
-	RedisHost            string        `mapstructure:"REDIS_HOST"`
-	RedisPort            string        `mapstructure:"REDIS_PORT"`
+	HTTPServerAddress              string        `mapstructure:"HTTP_SERVER_ADDRESS"`
+	TrustProxyHeaders              bool          `mapstructure:"TRUST_PROXY_HEADERS"`
+	AccessTokenDuration            time.Duration `mapstructure:"ACCESS_TOKEN_DURATION"`
+	RefreshTokenDuration           time.Duration `mapstructure:"REFRESH_TOKEN_DURATION"`
+	JWTSecretKey                   string        `mapstructure:"JWT_SECRET_KEY"`
+	JWTSigningAlgorithm            string        `mapstructure:"JWT_SIGNING_ALGORITHM"`
+	JWTPrivateKeyFile              string        `mapstructure:"JWT_PRIVATE_KEY_FILE"`
+	JWTKeyID                       string        `mapstructure:"JWT_KEY_ID"`
+	KeyRotationGracePeriod         time.Duration `mapstructure:"KEY_ROTATION_GRACE_PERIOD"`
+	KeyRingRefreshInterval         time.Duration `mapstructure:"KEY_RING_REFRESH_INTERVAL"`
+	SigningKeyEncryptionKey        string        `mapstructure:"SIGNING_KEY_ENCRYPTION_KEY"`
+	TokenFormat                    string        `mapstructure:"TOKEN_FORMAT"`
+	PasetoLocalKey                 string        `mapstructure:"PASETO_LOCAL_KEY"`
+	PasetoPrivateKeyFile           string        `mapstructure:"PASETO_PRIVATE_KEY_FILE"`
+	RefreshTokenKey                string        `mapstructure:"REFRESH_TOKEN_KEY"`
+	TokenIssuer                    string        `mapstructure:"TOKEN_ISSUER"`
+	TokenAudience                  string        `mapstructure:"TOKEN_AUDIENCE"`
+	TokenAllowedAudiences          string        `mapstructure:"TOKEN_ALLOWED_AUDIENCES"`
+	TokenLeeway                    time.Duration `mapstructure:"TOKEN_LEEWAY"`
+	AcceptLegacyTokens             bool          `mapstructure:"ACCEPT_LEGACY_TOKENS"`
+	DBHost                         string        `mapstructure:"DB_HOST"`
+	DBDriver                       string        `mapstructure:"DB_DRIVER"`
+	DBUser                         string        `mapstructure:"DB_USER"`
+	DBPassword                     string        `mapstructure:"DB_PASSWORD"`
+	DBName                         string        `mapstructure:"DB_NAME"`
+	DBPort                         string        `mapstructure:"DB_PORT"`
+	RedisHost                      string        `mapstructure:"REDIS_HOST"`
+	RedisPort                      string        `mapstructure:"REDIS_PORT"`
+	SessionMode                    string        `mapstructure:"SESSION_MODE"`
+	CookieSecure                   bool          `mapstructure:"COOKIE_SECURE"`
+	CookieSameSite                 string        `mapstructure:"COOKIE_SAME_SITE"`
+	CookieDomain                   string        `mapstructure:"COOKIE_DOMAIN"`
+	DenylistCacheSize              int           `mapstructure:"DENYLIST_CACHE_SIZE"`
+	DenylistCacheTTL               time.Duration `mapstructure:"DENYLIST_CACHE_TTL"`
+	AdminEmail                     string        `mapstructure:"ADMIN_EMAIL"`
+	MFAIssuer                      string        `mapstructure:"MFA_ISSUER"`
+	MFAChallengeDuration           time.Duration `mapstructure:"MFA_CHALLENGE_DURATION"`
+	PasswordResetDuration          time.Duration `mapstructure:"PASSWORD_RESET_DURATION"`
+	PasswordResetURL               string        `mapstructure:"PASSWORD_RESET_URL"`
+	EmailVerificationDuration      time.Duration `mapstructure:"EMAIL_VERIFICATION_DURATION"`
+	EmailVerificationURL           string        `mapstructure:"EMAIL_VERIFICATION_URL"`
+	RequireEmailVerification       bool          `mapstructure:"REQUIRE_EMAIL_VERIFICATION"`
+	OIDCIssuer                     string        `mapstructure:"OIDC_ISSUER"`
+	OAuthClientTokenDuration       time.Duration `mapstructure:"OAUTH_CLIENT_TOKEN_DURATION"`
+	OAuthAuthorizationCodeDuration time.Duration `mapstructure:"OAUTH_AUTHORIZATION_CODE_DURATION"`
+	DeviceCodeDuration             time.Duration `mapstructure:"DEVICE_CODE_DURATION"`
+	DeviceCodeInterval             time.Duration `mapstructure:"DEVICE_CODE_INTERVAL"`
+	DPoPProofLifetime              time.Duration `mapstructure:"DPOP_PROOF_LIFETIME"`
+	StepUpMaxAge                   time.Duration `mapstructure:"STEP_UP_MAX_AGE"`
+	FederatedProviderNames         string        `mapstructure:"FEDERATED_PROVIDERS"`
+	FederatedLoginDuration         time.Duration `mapstructure:"FEDERATED_LOGIN_DURATION"`
+	FederatedProviders             []FederatedProvider
+	Authenticators                 string        `mapstructure:"AUTHENTICATORS"`
+	LDAPURL                        string        `mapstructure:"LDAP_URL"`
+	LDAPStartTLS                   bool          `mapstructure:"LDAP_START_TLS"`
+	LDAPCAFile                     string        `mapstructure:"LDAP_CA_FILE"`
+	LDAPBindDN                     string        `mapstructure:"LDAP_BIND_DN"`
+	LDAPBindPassword               string        `mapstructure:"LDAP_BIND_PASSWORD"`
+	LDAPBaseDN                     string        `mapstructure:"LDAP_BASE_DN"`
+	LDAPUserFilter                 string        `mapstructure:"LDAP_USER_FILTER"`
+	LDAPGroupAttribute             string        `mapstructure:"LDAP_GROUP_ATTRIBUTE"`
+	LDAPGroupRoles                 string        `mapstructure:"LDAP_GROUP_ROLES"`
+	LDAPTimeout                    time.Duration `mapstructure:"LDAP_TIMEOUT"`
+	PasswordHashAlgorithm          string        `mapstructure:"PASSWORD_HASH_ALGORITHM"`
+	BcryptCost                     int           `mapstructure:"BCRYPT_COST"`
+	Argon2Memory                   uint32        `mapstructure:"ARGON2_MEMORY"`
+	Argon2Iterations               uint32        `mapstructure:"ARGON2_ITERATIONS"`
+	Argon2Parallelism              uint8         `mapstructure:"ARGON2_PARALLELISM"`
+	LoginAttemptWindow             time.Duration `mapstructure:"LOGIN_ATTEMPT_WINDOW"`
+	LoginBackoffThreshold          int64         `mapstructure:"LOGIN_BACKOFF_THRESHOLD"`
+	LoginIPBackoffThreshold        int64         `mapstructure:"LOGIN_IP_BACKOFF_THRESHOLD"`
+	LoginBackoffBase               time.Duration `mapstructure:"LOGIN_BACKOFF_BASE"`
+	LoginBackoffMax                time.Duration `mapstructure:"LOGIN_BACKOFF_MAX"`
+	LoginHardLockThreshold         int64         `mapstructure:"LOGIN_HARD_LOCK_THRESHOLD"`
+	Mailer                         string        `mapstructure:"MAILER"`
+	MailFrom                       string        `mapstructure:"MAIL_FROM"`
+	MailOutboxDir                  string        `mapstructure:"MAIL_OUTBOX_DIR"`
+	SMTPHost                       string        `mapstructure:"SMTP_HOST"`
+	SMTPPort                       string        `mapstructure:"SMTP_PORT"`
+	SMTPUsername                   string        `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword                   string        `mapstructure:"SMTP_PASSWORD"`
 }
 
 // LoadConfig reads configuration from file or environment variables.
@@ -37,5 +108,42 @@ func LoadConfig(path string) (config Config, err error) {
 	}
 
 	err = viper.Unmarshal(&config)
+	if err != nil {
+		return
+	}
+
+	config.FederatedProviders, err = loadFederatedProviders(config.FederatedProviderNames)
 	return
 }
+
+// FederatedProvider is an upstream OpenID Connect provider users can log in with
+type FederatedProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+}
+
+// loadFederatedProviders reads the FEDERATED_<NAME>_ISSUER, _CLIENT_ID and _CLIENT_SECRET settings of each provider name
+func loadFederatedProviders(names string) ([]FederatedProvider, error) {
+	var providers []FederatedProvider
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "FEDERATED_" + strings.ToUpper(name) + "_"
+		provider := FederatedProvider{
+			Name:         name,
+			Issuer:       strings.TrimSuffix(viper.GetString(prefix+"ISSUER"), "/"),
+			ClientID:     viper.GetString(prefix + "CLIENT_ID"),
+			ClientSecret: viper.GetString(prefix + "CLIENT_SECRET"),
+		}
+		if provider.Issuer == "" || provider.ClientID == "" {
+			return nil, fmt.Errorf("federated provider %s requires %sISSUER and %sCLIENT_ID", name, prefix, prefix)
+		}
+		providers = append(providers, provider)
+	}
+	return providers, nil
+}
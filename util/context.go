@@ -0,0 +1,18 @@
+package util
+
+import "context"
+
+type contextKey string
+
+const jwtPayloadContextKey contextKey = "jwtPayload"
+
+// ContextWithJWTPayload returns a copy of ctx carrying the payload of the authenticated token
+func ContextWithJWTPayload(ctx context.Context, jwtPayload *JWTPayload) context.Context {
+	return context.WithValue(ctx, jwtPayloadContextKey, jwtPayload)
+}
+
+// JWTPayloadFromContext returns the payload stored by ContextWithJWTPayload, if any
+func JWTPayloadFromContext(ctx context.Context) (*JWTPayload, bool) {
+	jwtPayload, ok := ctx.Value(jwtPayloadContextKey).(*JWTPayload)
+	return jwtPayload, ok
+}
@@ -0,0 +1,64 @@
+package util
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Session modes. In cookie mode browsers get the refresh token in an HttpOnly cookie instead of the response body
+const (
+	SessionModeBody   = "body"
+	SessionModeCookie = "cookie"
+)
+
+// Cookies of the cookie session mode. The refresh token cookie is only sent to the auth endpoints,
+// the CSRF token cookie is readable by scripts, which echo it in the CSRF header
+const (
+	RefreshTokenCookie = "refresh_token"
+	RefreshCookiePath  = "/api/v1/auth"
+	CSRFTokenCookie    = "csrf_token"
+	CSRFHeader         = "X-CSRF-Token"
+)
+
+// NewSessionCookie returns a cookie of the cookie session mode with the Secure, SameSite and Domain of the configuration.
+// A zero expiresAt deletes the cookie
+func NewSessionCookie(config Config, name string, value string, path string, expiresAt time.Time, httpOnly bool) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   config.CookieDomain,
+		Expires:  expiresAt,
+		Secure:   config.CookieSecure,
+		HttpOnly: httpOnly,
+		SameSite: sameSite(config.CookieSameSite),
+	}
+	if expiresAt.IsZero() {
+		cookie.Expires = time.Unix(0, 0)
+		cookie.MaxAge = -1
+	}
+	return cookie
+}
+
+// ValidCSRFToken checks the double-submitted CSRF token: the header must repeat the cookie, which another site cannot read
+func ValidCSRFToken(r *http.Request) bool {
+	cookie, err := r.Cookie(CSRFTokenCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	header := r.Header.Get(CSRFHeader)
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) == 1
+}
+
+func sameSite(value string) http.SameSite {
+	switch strings.ToLower(value) {
+	case "lax":
+		return http.SameSiteLaxMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteStrictMode
+	}
+}
@@ -0,0 +1,147 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// DPoPHeader carries the proof of possession of RFC 9449 on token and resource requests
+const DPoPHeader = "DPoP"
+
+// ErrInvalidDPoPProof is returned for a missing, malformed, stale or replayed DPoP proof
+var ErrInvalidDPoPProof = errors.New("invalid DPoP proof")
+
+// dpopAlgorithms are the signatures accepted on proofs, the key of a proof is public so shared secrets make no sense
+var dpopAlgorithms = map[string]bool{
+	AlgorithmRS256: true,
+	AlgorithmES256: true,
+	AlgorithmEdDSA: true,
+}
+
+// DPoPSigningAlgorithms lists the algorithms accepted on proofs, as advertised in the discovery document
+func DPoPSigningAlgorithms() []string {
+	return []string{AlgorithmRS256, AlgorithmES256, AlgorithmEdDSA}
+}
+
+// DPoPProof is a verified proof, JKT is the thumbprint of the key that signed it
+type DPoPProof struct {
+	JTI      string
+	JKT      string
+	IssuedAt time.Time
+}
+
+// VerifyDPoPProof checks the signature of the proof with the key of its jwk header, then the method and URI
+// it was made for and its iat, which may be off by maxAge either way. At resource servers accessToken is the token
+// the proof comes with and must match the ath claim, at token endpoints it is empty and ath must be absent
+func VerifyDPoPProof(proof string, method string, uri string, accessToken string, maxAge time.Duration) (*DPoPProof, error) {
+	claims := jwt.MapClaims{}
+	var jwk JWK
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	_, err := parser.ParseWithClaims(proof, claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != "dpop+jwt" {
+			return nil, errors.New("typ must be dpop+jwt")
+		}
+		if !dpopAlgorithms[token.Method.Alg()] {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		header, ok := token.Header["jwk"].(map[string]interface{})
+		if !ok {
+			return nil, errors.New("the jwk header is missing")
+		}
+		if _, ok := header["d"]; ok {
+			return nil, errors.New("the jwk header holds a private key")
+		}
+		encoded, err := json.Marshal(header)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(encoded, &jwk); err != nil {
+			return nil, err
+		}
+		return jwk.PublicKey()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDPoPProof, err)
+	}
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return nil, fmt.Errorf("%w: jti is required", ErrInvalidDPoPProof)
+	}
+	if htm, _ := claims["htm"].(string); htm != method {
+		return nil, fmt.Errorf("%w: htm does not match the request method", ErrInvalidDPoPProof)
+	}
+	expectedURI := normalizeDPoPURI(uri)
+	if htu, _ := claims["htu"].(string); expectedURI == "" || normalizeDPoPURI(htu) != expectedURI {
+		return nil, fmt.Errorf("%w: htu does not match the request URI", ErrInvalidDPoPProof)
+	}
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("%w: iat is required", ErrInvalidDPoPProof)
+	}
+	issuedAt := time.Unix(int64(iat), 0)
+	if age := time.Since(issuedAt); age > maxAge || age < -maxAge {
+		return nil, fmt.Errorf("%w: the proof is too old or issued in the future", ErrInvalidDPoPProof)
+	}
+
+	ath, hasAth := claims["ath"].(string)
+	switch {
+	case accessToken == "" && hasAth:
+		return nil, fmt.Errorf("%w: ath is only allowed along an access token", ErrInvalidDPoPProof)
+	case accessToken != "" && ath != DPoPAccessTokenHash(accessToken):
+		return nil, fmt.Errorf("%w: ath does not match the access token", ErrInvalidDPoPProof)
+	}
+
+	jkt, err := jwk.Thumbprint()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDPoPProof, err)
+	}
+	return &DPoPProof{JTI: jti, JKT: jkt, IssuedAt: issuedAt}, nil
+}
+
+// DPoPChallenge is the WWW-Authenticate value of a request rejected for the DPoP binding of its access token
+func DPoPChallenge(errorCode string) string {
+	return `DPoP error="` + errorCode + `", algs="` + strings.Join(DPoPSigningAlgorithms(), " ") + `"`
+}
+
+// DPoPAccessTokenHash is the ath claim binding a proof to an access token
+func DPoPAccessTokenHash(accessToken string) string {
+	hash := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// DPoPProofHeader returns the proof of the request, empty without one. Sending several proofs is an error
+func DPoPProofHeader(r *http.Request) (string, error) {
+	proofs := r.Header.Values(DPoPHeader)
+	if len(proofs) > 1 {
+		return "", fmt.Errorf("%w: only one DPoP header is allowed", ErrInvalidDPoPProof)
+	}
+	if len(proofs) == 0 {
+		return "", nil
+	}
+	return proofs[0], nil
+}
+
+// DPoPRequestURI is the URI a proof for the request must name. It is built from the public base URL
+// rather than the Host header, which a proxy in front of the server may rewrite
+func DPoPRequestURI(baseURL string, r *http.Request) string {
+	return strings.TrimSuffix(baseURL, "/") + r.URL.EscapedPath()
+}
+
+// normalizeDPoPURI drops the query and fragment, which htu leaves out, and the case of the scheme and host
+func normalizeDPoPURI(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Host == "" {
+		return ""
+	}
+	return strings.ToLower(parsed.Scheme) + "://" + strings.ToLower(parsed.Host) + parsed.EscapedPath()
+}
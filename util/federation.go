@@ -0,0 +1,273 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Different types of error returned when talking to an upstream OpenID Connect provider
+var (
+	ErrInvalidIDToken = errors.New("invalid ID token")
+	ErrUpstreamOIDC   = errors.New("upstream OpenID Connect provider error")
+)
+
+// jwksRefreshInterval bounds how often the keys of a provider are fetched again for an unknown kid
+const jwksRefreshInterval = time.Minute
+
+// upstreamAlgorithms are the ID token signatures accepted from providers. Shared secrets are never accepted
+var upstreamAlgorithms = map[string]bool{
+	AlgorithmRS256: true,
+	AlgorithmES256: true,
+	AlgorithmEdDSA: true,
+}
+
+// FederatedClaims are the claims of a verified upstream ID token
+type FederatedClaims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+}
+
+type providerMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// FederatedOIDCClient runs the authorization code flow against an upstream provider, as a relying party.
+// The discovery document and the keys of the provider are fetched on first use and cached
+type FederatedOIDCClient struct {
+	provider    FederatedProvider
+	redirectURI string
+	httpClient  *http.Client
+
+	mu            sync.Mutex
+	metadata      *providerMetadata
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+func NewFederatedOIDCClient(provider FederatedProvider, redirectURI string, httpClient *http.Client) *FederatedOIDCClient {
+	return &FederatedOIDCClient{
+		provider:    provider,
+		redirectURI: redirectURI,
+		httpClient:  httpClient,
+	}
+}
+
+// AuthorizationURL returns where to send the user, with PKCE and a nonce bound to the ID token
+func (client *FederatedOIDCClient) AuthorizationURL(ctx context.Context, state string, nonce string, codeChallenge string) (string, error) {
+	metadata, err := client.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	authorizationURL, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrUpstreamOIDC, err)
+	}
+	query := authorizationURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", client.provider.ClientID)
+	query.Set("redirect_uri", client.redirectURI)
+	query.Set("scope", "openid email profile")
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	authorizationURL.RawQuery = query.Encode()
+	return authorizationURL.String(), nil
+}
+
+// Exchange trades the authorization code for the tokens of the provider and returns the verified ID token claims
+func (client *FederatedOIDCClient) Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (*FederatedClaims, error) {
+	metadata, err := client.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {client.redirectURI},
+		"code_verifier": {codeVerifier},
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth(url.QueryEscape(client.provider.ClientID), url.QueryEscape(client.provider.ClientSecret))
+
+	var tokenResponse struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := client.do(request, &tokenResponse); err != nil {
+		return nil, err
+	}
+	if tokenResponse.IDToken == "" {
+		return nil, fmt.Errorf("%w: the token response has no id_token", ErrUpstreamOIDC)
+	}
+	return client.VerifyIDToken(ctx, tokenResponse.IDToken, nonce)
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce of an ID token of the provider
+func (client *FederatedOIDCClient) VerifyIDToken(ctx context.Context, idToken string, nonce string) (*FederatedClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if !upstreamAlgorithms[token.Method.Alg()] {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		kid, _ := token.Header["kid"].(string)
+		return client.verificationKey(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if issuer, _ := claims["iss"].(string); issuer != client.provider.Issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %s", ErrInvalidIDToken, issuer)
+	}
+	if !client.hasAudience(claims) {
+		return nil, fmt.Errorf("%w: the token was not issued to this client", ErrInvalidIDToken)
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, fmt.Errorf("%w: the token has no expiry", ErrInvalidIDToken)
+	}
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	federatedClaims := &FederatedClaims{}
+	federatedClaims.Subject, _ = claims["sub"].(string)
+	federatedClaims.Email, _ = claims["email"].(string)
+	federatedClaims.EmailVerified, _ = claims["email_verified"].(bool)
+	federatedClaims.GivenName, _ = claims["given_name"].(string)
+	federatedClaims.FamilyName, _ = claims["family_name"].(string)
+	if federatedClaims.Subject == "" {
+		return nil, fmt.Errorf("%w: the token has no subject", ErrInvalidIDToken)
+	}
+	return federatedClaims, nil
+}
+
+// hasAudience accepts a single audience or a list naming the client, in which case azp must name it too
+func (client *FederatedOIDCClient) hasAudience(claims jwt.MapClaims) bool {
+	switch audience := claims["aud"].(type) {
+	case string:
+		return audience == client.provider.ClientID
+	case []interface{}:
+		for _, value := range audience {
+			if value == client.provider.ClientID {
+				azp, ok := claims["azp"].(string)
+				return len(audience) == 1 || (ok && azp == client.provider.ClientID)
+			}
+		}
+	}
+	return false
+}
+
+func (client *FederatedOIDCClient) discover(ctx context.Context) (*providerMetadata, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.metadata != nil {
+		return client.metadata, nil
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, client.provider.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	metadata := &providerMetadata{}
+	if err := client.do(request, metadata); err != nil {
+		return nil, err
+	}
+	// A mismatch would let another issuer's tokens through, see OpenID Connect Discovery section 4.3
+	if metadata.Issuer != client.provider.Issuer {
+		return nil, fmt.Errorf("%w: discovery returned issuer %s", ErrUpstreamOIDC, metadata.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: incomplete discovery document", ErrUpstreamOIDC)
+	}
+	client.metadata = metadata
+	return metadata, nil
+}
+
+// verificationKey looks up the key by kid, fetching the keys again when the provider may have rotated them
+func (client *FederatedOIDCClient) verificationKey(ctx context.Context, kid string) (interface{}, error) {
+	metadata, err := client.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if key, ok := client.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(client.keysFetchedAt) < jwksRefreshInterval {
+		return nil, ErrKeyNotFound
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, metadata.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var jwkSet JWKSet
+	if err := client.do(request, &jwkSet); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]interface{}, len(jwkSet.Keys))
+	for _, jwk := range jwkSet.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		publicKey, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = publicKey
+	}
+	client.keys = keys
+	client.keysFetchedAt = time.Now()
+
+	key, ok := keys[kid]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return key, nil
+}
+
+func (client *FederatedOIDCClient) do(request *http.Request, response interface{}) error {
+	request.Header.Set("Accept", "application/json")
+	httpResponse, err := client.httpClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUpstreamOIDC, err)
+	}
+	defer httpResponse.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(httpResponse.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUpstreamOIDC, err)
+	}
+	if httpResponse.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s answered %d %s", ErrUpstreamOIDC, request.URL.Path, httpResponse.StatusCode, body)
+	}
+	if err := json.Unmarshal(body, response); err != nil {
+		return fmt.Errorf("%w: %v", ErrUpstreamOIDC, err)
+	}
+	return nil
+}
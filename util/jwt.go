@@ -12,27 +12,55 @@ import (
 
 // Different types of error returned by the VerifyToken function
 var (
-	ErrInvalidToken         = errors.New("token is invalid")
-	ErrExpiredToken         = errors.New("token has expired")
-	minSecretKeySize        = 32
-	authorizationTypeBearer = "bearer"
+	ErrInvalidToken  = errors.New("token is invalid")
+	ErrExpiredToken  = errors.New("token has expired")
+	ErrRevokedToken  = errors.New("token has been revoked")
+	minSecretKeySize = 32
 )
 
-//CreateToken creates a new token for a specific username and duration
-func CreateToken(username string, duration time.Duration, secretKey string) (string, *JWTPayload, error) {
-	if err := secretKeyValidation(secretKey); err != nil {
+// Authorization schemes accepted for access tokens, DPoP is for tokens bound to a key
+const (
+	AuthorizationSchemeBearer = "bearer"
+	AuthorizationSchemeDPoP   = "dpop"
+)
+
+// jwtMaker issues JWTs signed with the keys of a KeyProvider
+type jwtMaker struct {
+	keys   KeyProvider
+	policy ClaimsPolicy
+}
+
+// signedPayload is the jwt.Claims of a JWTPayload. jwt-go never validates it, the ClaimsPolicy does with its leeway
+type signedPayload struct {
+	*JWTPayload
+}
+
+func (signedPayload) Valid() error {
+	return nil
+}
+
+// NewJWTMaker returns a TokenMaker of JWTs, signed and verified with the provider's keys
+func NewJWTMaker(keys KeyProvider, policy ClaimsPolicy) TokenMaker {
+	return &jwtMaker{keys, policy}
+}
+
+//CreateToken creates a new token for a specific subject and duration, signed with the provider's signing key
+func (maker *jwtMaker) CreateToken(subject TokenSubject, duration time.Duration) (string, *JWTPayload, error) {
+	signingKey, err := maker.keys.SigningKey()
+	if err != nil {
 		return "", nil, err
 	}
 	// Set custom and standard claims
-	jwtPayload, err := newJWTPayload(username, duration)
+	jwtPayload, err := maker.policy.newPayload(subject, duration)
 	if err != nil {
 		return "", nil, err
 	}
-	// Create token with claims
-	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwtPayload)
+	// Create token with claims, the kid header tells verifiers which key to use
+	jwtToken := jwt.NewWithClaims(signingKey.Method, signedPayload{jwtPayload})
+	jwtToken.Header["kid"] = signingKey.ID
 
-	// Generate encoded token using the secret signing key
-	token, err := jwtToken.SignedString([]byte(secretKey))
+	// Generate encoded token using the signing key
+	token, err := jwtToken.SignedString(signingKey.PrivateKey)
 	if err != nil {
 		return "", nil, err
 	}
@@ -40,50 +68,49 @@ func CreateToken(username string, duration time.Duration, secretKey string) (str
 }
 
 //VerifyToken checks if the token is valid or not
-func VerifyToken(token string, secretKey string) (*JWTPayload, error) {
-	if err := secretKeyValidation(secretKey); err != nil {
-		return nil, err
-	}
+func (maker *jwtMaker) VerifyToken(token string) (*JWTPayload, error) {
 	keyFunc := func(token *jwt.Token) (interface{}, error) {
-		_, ok := token.Method.(*jwt.SigningMethodHMAC)
-		if !ok {
+		kid, _ := token.Header["kid"].(string)
+		signingKey, err := maker.keys.VerificationKey(kid)
+		if err != nil {
 			return nil, ErrInvalidToken
 		}
-		return []byte(secretKey), nil
-	}
-	jwtToken, err := jwt.ParseWithClaims(token, &JWTPayload{}, keyFunc)
-
-	if err != nil {
-		verr, ok := err.(*jwt.ValidationError)
-		if ok && errors.Is(verr.Inner, ErrExpiredToken) {
-			return nil, ErrExpiredToken
+		// The algorithm is pinned by the key, never taken from the token
+		if token.Method.Alg() != signingKey.Method.Alg() {
+			return nil, ErrInvalidToken
 		}
+		return signingKey.PublicKey, nil
+	}
+	// The claims are checked by the policy, with its leeway, once the signature is verified
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	claims := &signedPayload{&JWTPayload{}}
+	if _, err := parser.ParseWithClaims(token, claims, keyFunc); err != nil {
 		return nil, ErrInvalidToken
 	}
 
-	jwtPayload, ok := jwtToken.Claims.(*JWTPayload)
-	if !ok {
-		return nil, ErrInvalidToken
+	if err := maker.policy.validate(claims.JWTPayload); err != nil {
+		return expiredPayload(claims.JWTPayload, err)
 	}
-	return jwtPayload, nil
+	return claims.JWTPayload, nil
 }
 
-func ValidateBearerHeader(authorizationHeader string) (string, error) {
+// ValidateAuthorizationHeader returns the lower cased scheme and the token of a Bearer or DPoP authorization header
+func ValidateAuthorizationHeader(authorizationHeader string) (string, string, error) {
 	if len(authorizationHeader) == 0 {
-		return "", errors.New("authorization header is not provided")
+		return "", "", errors.New("authorization header is not provided")
 	}
 
 	fields := strings.Fields(authorizationHeader)
 	if len(fields) < 2 {
-		return "", errors.New("invalid authorization header format")
+		return "", "", errors.New("invalid authorization header format")
 	}
 
 	authorizationType := strings.ToLower(fields[0])
-	if authorizationType != authorizationTypeBearer {
+	if authorizationType != AuthorizationSchemeBearer && authorizationType != AuthorizationSchemeDPoP {
 
-		return "", fmt.Errorf("unsupported authorization type %s", authorizationType)
+		return "", "", fmt.Errorf("unsupported authorization type %s", authorizationType)
 	}
-	return fields[1], nil
+	return authorizationType, fields[1], nil
 }
 
 func secretKeyValidation(secretKey string) error {
@@ -93,32 +120,95 @@ func secretKeyValidation(secretKey string) error {
 	return nil
 }
 
+// Kinds of principal a token is issued to
+const (
+	PrincipalUser    = "user"
+	PrincipalService = "service"
+)
+
+// TokenSubject holds the identity embedded into a token.
+// Service principals are OAuth clients, identified by ClientID instead of a user
+type TokenSubject struct {
+	PrincipalType string
+	UserID        uint
+	Email         string
+	Role          string
+	Permissions   []string
+	SessionID     string
+	ClientID      string
+	Scopes        []string
+	// JKT is the thumbprint of the DPoP key the token is bound to, empty for bearer tokens
+	JKT string
+	// AuthTime and AMR tell when and how the user authenticated, refreshed tokens keep those of the login
+	AuthTime time.Time
+	AMR      []string
+}
+
+// Confirmation is the cnf claim of RFC 7800, naming the key a sender constrained token is bound to
+type Confirmation struct {
+	JKT string `json:"jkt"`
+}
+
+// JWTPayload holds the claims of an access or refresh token. It is encoded with the registered claims
+// of RFC 7519, see MarshalJSON
 type JWTPayload struct {
-	ID        uuid.UUID
-	UserEmail string
-	IssuedAt  time.Time
-	ExpiredAt time.Time
+	ID       uuid.UUID
+	Issuer   string
+	Audience []string
+	// TokenUse is the token_use claim, TokenUseAccess or TokenUseRefresh
+	TokenUse string
+	// UserID is the sub claim of user tokens
+	UserID      uint
+	UserEmail   string
+	Role        string
+	Permissions []string
+	SessionID   string
+	IssuedAt    time.Time
+	NotBefore   time.Time
+	ExpiredAt   time.Time
+	// PrincipalType is empty in tokens issued before service principals existed, which were all users
+	PrincipalType string
+	ClientID      string `json:",omitempty"`
+	// Scopes are the scopes the user granted the OAuth client, set along ClientID
+	Scopes []string `json:",omitempty"`
+	// PersonalAccessTokenID is only set when the request was authenticated with a personal access token
+	PersonalAccessTokenID uint `json:",omitempty"`
+	// Confirmation is set on tokens bound to a DPoP key, they are only accepted along a proof signed with it
+	Confirmation *Confirmation `json:"cnf,omitempty"`
+	// AuthTime and AMR are the auth_time and amr claims, set on the tokens of user sessions
+	AuthTime time.Time
+	AMR      []string
+	// Legacy is set on tokens issued before the registered claims, they carry no issuer or audience
+	Legacy bool `json:"-"`
 }
 
-func (jwtPayload *JWTPayload) Valid() error {
-	if time.Now().After(jwtPayload.ExpiredAt) {
-		return ErrExpiredToken
+// TokenType is the token_type of tokens bound to the given DPoP key thumbprint, bearer tokens have none
+func TokenType(jkt string) string {
+	if jkt != "" {
+		return "DPoP"
 	}
-	return nil
+	return "Bearer"
 }
 
-func newJWTPayload(userEmail string, duration time.Duration) (*JWTPayload, error) {
-	tokenID, err := uuid.NewUUID()
-	if err != nil {
-		return nil, err
+// DPoPThumbprint returns the thumbprint of the key the token is bound to, empty for bearer tokens
+func (jwtPayload *JWTPayload) DPoPThumbprint() string {
+	if jwtPayload.Confirmation == nil {
+		return ""
 	}
+	return jwtPayload.Confirmation.JKT
+}
 
-	jwtPayload := &JWTPayload{
-		ID:        tokenID,
-		UserEmail: userEmail,
-		IssuedAt:  time.Now(),
-		ExpiredAt: time.Now().Add(duration),
+// IssuedAtPrecise is when the token was issued, to the 100ns recorded by its version 1 jti.
+// iat is truncated to the second, too coarse to order the token against a revocation
+func (jwtPayload *JWTPayload) IssuedAtPrecise() time.Time {
+	if jwtPayload.ID.Version() != 1 {
+		return jwtPayload.IssuedAt
 	}
+	sec, nsec := jwtPayload.ID.Time().UnixTime()
+	return time.Unix(sec, nsec)
+}
 
-	return jwtPayload, nil
+// IsService tells tokens of OAuth clients apart from tokens of users
+func (jwtPayload *JWTPayload) IsService() bool {
+	return jwtPayload.PrincipalType == PrincipalService
 }
@@ -0,0 +1,159 @@
+package util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Signing algorithms supported for tokens
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// Different types of error returned when loading or looking up signing keys
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	ErrKeyNotFound          = errors.New("signing key not found")
+)
+
+// SigningKey is a key used to sign and verify tokens, published and looked up by its kid header.
+// For HMAC both PrivateKey and PublicKey hold the shared secret
+type SigningKey struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PrivateKey interface{}
+	PublicKey  interface{}
+}
+
+// IsSymmetric reports whether the key is a shared secret that must never be published
+func (signingKey *SigningKey) IsSymmetric() bool {
+	_, ok := signingKey.Method.(*jwt.SigningMethodHMAC)
+	return ok
+}
+
+// KeyProvider supplies the key that signs new tokens and the keys trusted to verify them
+type KeyProvider interface {
+	// SigningKey returns the key new tokens are signed with
+	SigningKey() (*SigningKey, error)
+	// VerificationKey returns the trusted key with the given kid.
+	// Tokens issued before kid headers existed are looked up with an empty kid
+	VerificationKey(kid string) (*SigningKey, error)
+	// VerificationKeys returns every trusted key, used to publish the JWKS
+	VerificationKeys() []*SigningKey
+}
+
+// LoadSigningKey builds the signing key described by the configuration.
+// HS256 uses JWT_SECRET_KEY, the asymmetric algorithms read a PEM private key from JWT_PRIVATE_KEY_FILE
+func LoadSigningKey(config Config) (*SigningKey, error) {
+	algorithm := config.JWTSigningAlgorithm
+	if algorithm == "" {
+		algorithm = AlgorithmHS256
+	}
+
+	if algorithm == AlgorithmHS256 {
+		return ParseSigningKey(config.JWTKeyID, algorithm, []byte(config.JWTSecretKey))
+	}
+
+	keyPEM, err := os.ReadFile(config.JWTPrivateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read private key: %w", err)
+	}
+	return ParseSigningKey(config.JWTKeyID, algorithm, keyPEM)
+}
+
+// ParseSigningKey builds a signing key for the algorithm from a PEM encoded private key, or from the raw secret for HS256.
+// When kid is empty, asymmetric keys are identified by their JWK thumbprint
+func ParseSigningKey(kid string, algorithm string, keyMaterial []byte) (*SigningKey, error) {
+	signingKey := &SigningKey{ID: kid}
+
+	switch algorithm {
+	case AlgorithmHS256:
+		if err := secretKeyValidation(string(keyMaterial)); err != nil {
+			return nil, err
+		}
+		if signingKey.ID == "" {
+			signingKey.ID = "default"
+		}
+		signingKey.Method = jwt.SigningMethodHS256
+		signingKey.PrivateKey = keyMaterial
+		signingKey.PublicKey = keyMaterial
+		return signingKey, nil
+	case AlgorithmRS256:
+		signingKey.Method = jwt.SigningMethodRS256
+	case AlgorithmES256:
+		signingKey.Method = jwt.SigningMethodES256
+	case AlgorithmEdDSA:
+		signingKey.Method = SigningMethodEd25519
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, algorithm)
+	}
+
+	privateKey, err := parsePrivateKeyPEM(keyMaterial)
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		if algorithm != AlgorithmRS256 {
+			return nil, fmt.Errorf("an RSA key cannot be used with %s", algorithm)
+		}
+	case *ecdsa.PrivateKey:
+		if algorithm != AlgorithmES256 || key.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("an ECDSA key on %s cannot be used with %s", key.Curve.Params().Name, algorithm)
+		}
+	case ed25519.PrivateKey:
+		if algorithm != AlgorithmEdDSA {
+			return nil, fmt.Errorf("an Ed25519 key cannot be used with %s", algorithm)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", privateKey)
+	}
+
+	signingKey.PrivateKey = privateKey
+	signingKey.PublicKey = privateKey.(crypto.Signer).Public()
+
+	if signingKey.ID == "" {
+		jwk, err := NewJWK(signingKey)
+		if err != nil {
+			return nil, err
+		}
+		signingKey.ID, err = jwk.Thumbprint()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return signingKey, nil
+}
+
+// parsePrivateKeyPEM accepts PKCS#8 keys as well as the PKCS#1 RSA and SEC 1 EC formats
+func parsePrivateKeyPEM(keyPEM []byte) (interface{}, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("unsupported private key format")
+}
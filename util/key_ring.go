@@ -0,0 +1,198 @@
+package util
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/chacha20"
+)
+
+// RingKey is a signing key together with its validity window.
+// A key signs new tokens from NotBefore on, and is trusted for verification until RetireAfter, if set
+type RingKey struct {
+	*SigningKey
+	NotBefore   time.Time
+	RetireAfter time.Time
+}
+
+func (ringKey RingKey) retired(now time.Time) bool {
+	return !ringKey.RetireAfter.IsZero() && !now.Before(ringKey.RetireAfter)
+}
+
+// KeyRing is a KeyProvider holding one active signing key and any number of keys that are still trusted.
+// The active key is the most recent one whose NotBefore has passed, so promotions happen by themselves as time goes by
+type KeyRing struct {
+	mu          sync.RWMutex
+	keys        []RingKey
+	legacyKeyID string
+}
+
+// NewKeyRing returns a key ring with the given keys. Tokens without a kid header are verified with legacyKeyID
+func NewKeyRing(keys []RingKey, legacyKeyID string) *KeyRing {
+	return &KeyRing{
+		keys:        keys,
+		legacyKeyID: legacyKeyID,
+	}
+}
+
+// SetKeys replaces the keys of the ring
+func (ring *KeyRing) SetKeys(keys []RingKey, legacyKeyID string) {
+	ring.mu.Lock()
+	defer ring.mu.Unlock()
+	ring.keys = keys
+	ring.legacyKeyID = legacyKeyID
+}
+
+func (ring *KeyRing) SigningKey() (*SigningKey, error) {
+	ring.mu.RLock()
+	defer ring.mu.RUnlock()
+
+	now := time.Now()
+	var active *RingKey
+	for i, ringKey := range ring.keys {
+		if ringKey.NotBefore.After(now) || ringKey.retired(now) {
+			continue
+		}
+		if active == nil || ringKey.NotBefore.After(active.NotBefore) {
+			active = &ring.keys[i]
+		}
+	}
+
+	if active == nil {
+		return nil, ErrKeyNotFound
+	}
+	return active.SigningKey, nil
+}
+
+func (ring *KeyRing) VerificationKey(kid string) (*SigningKey, error) {
+	ring.mu.RLock()
+	defer ring.mu.RUnlock()
+
+	if kid == "" {
+		kid = ring.legacyKeyID
+	}
+
+	now := time.Now()
+	for _, ringKey := range ring.keys {
+		if ringKey.ID == kid && !ringKey.retired(now) {
+			return ringKey.SigningKey, nil
+		}
+	}
+	return nil, ErrKeyNotFound
+}
+
+// VerificationKeys includes keys waiting for their NotBefore, so verifiers can cache them before they sign anything
+func (ring *KeyRing) VerificationKeys() []*SigningKey {
+	ring.mu.RLock()
+	defer ring.mu.RUnlock()
+
+	now := time.Now()
+	var signingKeys []*SigningKey
+	for _, ringKey := range ring.keys {
+		if !ringKey.retired(now) {
+			signingKeys = append(signingKeys, ringKey.SigningKey)
+		}
+	}
+	return signingKeys
+}
+
+// GenerateKeyMaterial creates a new random key for the algorithm, returned in the format ParseSigningKey reads
+func GenerateKeyMaterial(algorithm string) ([]byte, error) {
+	var privateKey interface{}
+	var err error
+
+	switch algorithm {
+	case AlgorithmHS256:
+		secret := make([]byte, 48)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		return []byte(base64.RawURLEncoding.EncodeToString(secret)), nil
+	case AlgorithmRS256:
+		privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgorithmES256:
+		privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgorithmEdDSA:
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return MarshalKeyMaterial(&SigningKey{PrivateKey: privateKey})
+}
+
+// MarshalKeyMaterial encodes the private part of a key in the format ParseSigningKey reads
+func MarshalKeyMaterial(signingKey *SigningKey) ([]byte, error) {
+	if secret, ok := signingKey.PrivateKey.([]byte); ok {
+		return secret, nil
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(signingKey.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// Different types of error returned when opening sealed key material
+var (
+	ErrKeyMaterialNotSealed  = errors.New("key material is stored in plaintext")
+	ErrKeyMaterialUnreadable = errors.New("key material cannot be decrypted with SIGNING_KEY_ENCRYPTION_KEY")
+)
+
+// NewKeyEncryptionKey decodes the hex encoded SIGNING_KEY_ENCRYPTION_KEY, which encrypts the stored signing keys
+func NewKeyEncryptionKey(config Config) ([]byte, error) {
+	if config.SigningKeyEncryptionKey == "" {
+		return nil, errors.New("SIGNING_KEY_ENCRYPTION_KEY is not set, generate one with: openssl rand -hex 32")
+	}
+	key, err := hex.DecodeString(config.SigningKeyEncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("SIGNING_KEY_ENCRYPTION_KEY must be hex encoded: %w", err)
+	}
+	if len(key) != chacha20.KeySize {
+		return nil, fmt.Errorf("SIGNING_KEY_ENCRYPTION_KEY must be %d bytes long", chacha20.KeySize)
+	}
+	return key, nil
+}
+
+// SealKeyMaterial encrypts key material as a v4.local PASETO token. The kid and the algorithm are
+// authenticated along it, so sealed material cannot be moved to another key or used with another algorithm
+func SealKeyMaterial(encryptionKey []byte, kid string, algorithm string, keyMaterial []byte) (string, error) {
+	nonce := make([]byte, pasetoNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return pasetoEncrypt(encryptionKey, keyMaterial, nonce, nil, preAuthEncode([]byte(kid), []byte(algorithm)))
+}
+
+// OpenKeyMaterial decrypts key material sealed by SealKeyMaterial
+func OpenKeyMaterial(encryptionKey []byte, kid string, algorithm string, sealed string) ([]byte, error) {
+	if !IsSealedKeyMaterial(sealed) {
+		return nil, ErrKeyMaterialNotSealed
+	}
+	keyMaterial, footer, err := pasetoDecrypt(encryptionKey, sealed, preAuthEncode([]byte(kid), []byte(algorithm)))
+	if err != nil || len(footer) != 0 {
+		return nil, ErrKeyMaterialUnreadable
+	}
+	return keyMaterial, nil
+}
+
+// IsSealedKeyMaterial reports whether the key material was sealed. PEM keys and base64url secrets never start like a PASETO token
+func IsSealedKeyMaterial(keyMaterial string) bool {
+	return strings.HasPrefix(keyMaterial, pasetoLocalHeader)
+}
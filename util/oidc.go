@@ -0,0 +1,53 @@
+package util
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// UserInfo holds the standard OpenID Connect claims describing a user, in ID tokens and at /userinfo.
+// Claims of scopes the client was not granted are left empty
+type UserInfo struct {
+	Subject       string `json:"sub"`
+	Name          string `json:"name,omitempty"`
+	GivenName     string `json:"given_name,omitempty"`
+	FamilyName    string `json:"family_name,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+}
+
+// IDTokenClaims are the claims of an OpenID Connect ID token, issued to the client named in Audience
+type IDTokenClaims struct {
+	UserInfo
+	Issuer    string `json:"iss"`
+	Audience  string `json:"aud"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	AuthTime  int64  `json:"auth_time"`
+	Nonce     string `json:"nonce,omitempty"`
+}
+
+func (claims *IDTokenClaims) Valid() error {
+	if time.Now().Unix() > claims.ExpiresAt {
+		return ErrExpiredToken
+	}
+	return nil
+}
+
+// CreateIDToken signs the ID token with the current signing key. Clients verify it with the published JWKS,
+// which a shared HMAC secret is never part of
+func CreateIDToken(claims IDTokenClaims, keys KeyProvider) (string, error) {
+	signingKey, err := keys.SigningKey()
+	if err != nil {
+		return "", err
+	}
+	if signingKey.IsSymmetric() {
+		return "", errors.New("ID tokens require an asymmetric signing key")
+	}
+
+	jwtToken := jwt.NewWithClaims(signingKey.Method, &claims)
+	jwtToken.Header["kid"] = signingKey.ID
+	return jwtToken.SignedString(signingKey.PrivateKey)
+}
@@ -0,0 +1,262 @@
+package util
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20"
+)
+
+// Headers of the PASETO version 4 purposes, see https://github.com/paseto-standard/paseto-spec
+const (
+	pasetoLocalHeader  = "v4.local."
+	pasetoPublicHeader = "v4.public."
+)
+
+const (
+	pasetoNonceSize = 32
+	pasetoMACSize   = 32
+)
+
+// pasetoLocalMaker encrypts tokens with a shared key, only this server can read or create them
+type pasetoLocalMaker struct {
+	key    []byte
+	policy ClaimsPolicy
+}
+
+// NewPasetoLocalMaker returns a TokenMaker of v4.local tokens, encrypted and authenticated with the 32 byte key
+func NewPasetoLocalMaker(key []byte, policy ClaimsPolicy) (TokenMaker, error) {
+	if len(key) != chacha20.KeySize {
+		return nil, fmt.Errorf("invalid key size: v4.local requires a %d byte key", chacha20.KeySize)
+	}
+	return &pasetoLocalMaker{key, policy}, nil
+}
+
+func (maker *pasetoLocalMaker) CreateToken(subject TokenSubject, duration time.Duration) (string, *JWTPayload, error) {
+	payload, err := maker.policy.newPayload(subject, duration)
+	if err != nil {
+		return "", nil, err
+	}
+	message, err := marshalPasetoClaims(payload)
+	if err != nil {
+		return "", nil, err
+	}
+
+	nonce := make([]byte, pasetoNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	token, err := pasetoEncrypt(maker.key, message, nonce, nil, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, payload, nil
+}
+
+func (maker *pasetoLocalMaker) VerifyToken(token string) (*JWTPayload, error) {
+	message, footer, err := pasetoDecrypt(maker.key, token, nil)
+	// Tokens with a footer are never issued
+	if err != nil || len(footer) != 0 {
+		return nil, ErrInvalidToken
+	}
+	return pasetoPayload(message, maker.policy)
+}
+
+// pasetoEncrypt implements v4.local encryption of the message, authenticating the footer and the implicit assertion along it
+func pasetoEncrypt(key []byte, message []byte, nonce []byte, footer []byte, implicitAssertion []byte) (string, error) {
+	encryptionKey, counterNonce, authenticationKey, err := pasetoSplitKey(key, nonce)
+	if err != nil {
+		return "", err
+	}
+
+	cipher, err := chacha20.NewUnauthenticatedCipher(encryptionKey, counterNonce)
+	if err != nil {
+		return "", err
+	}
+	ciphertext := make([]byte, len(message))
+	cipher.XORKeyStream(ciphertext, message)
+
+	mac, err := pasetoMAC(authenticationKey, nonce, ciphertext, footer, implicitAssertion)
+	if err != nil {
+		return "", err
+	}
+
+	body := append(append(append([]byte{}, nonce...), ciphertext...), mac...)
+	return pasetoToken(pasetoLocalHeader, body, footer), nil
+}
+
+// pasetoDecrypt returns the message and the footer of a v4.local token, once authenticated along the implicit assertion
+func pasetoDecrypt(key []byte, token string, implicitAssertion []byte) ([]byte, []byte, error) {
+	body, footer, err := pasetoBody(token, pasetoLocalHeader)
+	if err != nil || len(body) < pasetoNonceSize+pasetoMACSize {
+		return nil, nil, ErrInvalidToken
+	}
+	nonce := body[:pasetoNonceSize]
+	ciphertext := body[pasetoNonceSize : len(body)-pasetoMACSize]
+	mac := body[len(body)-pasetoMACSize:]
+
+	encryptionKey, counterNonce, authenticationKey, err := pasetoSplitKey(key, nonce)
+	if err != nil {
+		return nil, nil, ErrInvalidToken
+	}
+	expectedMAC, err := pasetoMAC(authenticationKey, nonce, ciphertext, footer, implicitAssertion)
+	if err != nil || subtle.ConstantTimeCompare(mac, expectedMAC) != 1 {
+		return nil, nil, ErrInvalidToken
+	}
+
+	cipher, err := chacha20.NewUnauthenticatedCipher(encryptionKey, counterNonce)
+	if err != nil {
+		return nil, nil, ErrInvalidToken
+	}
+	message := make([]byte, len(ciphertext))
+	cipher.XORKeyStream(message, ciphertext)
+	return message, footer, nil
+}
+
+// pasetoSplitKey derives the encryption key, the XChaCha20 nonce and the authentication key of a token from its nonce
+func pasetoSplitKey(key []byte, nonce []byte) ([]byte, []byte, []byte, error) {
+	encryptionHash, err := blake2b.New(chacha20.KeySize+chacha20.NonceSizeX, key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	encryptionHash.Write([]byte("paseto-encryption-key"))
+	encryptionHash.Write(nonce)
+	derived := encryptionHash.Sum(nil)
+
+	authenticationHash, err := blake2b.New(pasetoMACSize, key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	authenticationHash.Write([]byte("paseto-auth-key-for-aead"))
+	authenticationHash.Write(nonce)
+
+	return derived[:chacha20.KeySize], derived[chacha20.KeySize:], authenticationHash.Sum(nil), nil
+}
+
+// pasetoMAC authenticates the header, nonce, ciphertext, footer and implicit assertion of a v4.local token
+func pasetoMAC(authenticationKey []byte, nonce []byte, ciphertext []byte, footer []byte, implicitAssertion []byte) ([]byte, error) {
+	hash, err := blake2b.New(pasetoMACSize, authenticationKey)
+	if err != nil {
+		return nil, err
+	}
+	hash.Write(preAuthEncode([]byte(pasetoLocalHeader), nonce, ciphertext, footer, implicitAssertion))
+	return hash.Sum(nil), nil
+}
+
+// pasetoPublicMaker signs tokens with an Ed25519 key, anyone holding the public key can verify them
+type pasetoPublicMaker struct {
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+	policy     ClaimsPolicy
+}
+
+// NewPasetoPublicMaker returns a TokenMaker of v4.public tokens signed with the Ed25519 key
+func NewPasetoPublicMaker(privateKey ed25519.PrivateKey, policy ClaimsPolicy) TokenMaker {
+	return &pasetoPublicMaker{privateKey, privateKey.Public().(ed25519.PublicKey), policy}
+}
+
+func (maker *pasetoPublicMaker) CreateToken(subject TokenSubject, duration time.Duration) (string, *JWTPayload, error) {
+	payload, err := maker.policy.newPayload(subject, duration)
+	if err != nil {
+		return "", nil, err
+	}
+	message, err := marshalPasetoClaims(payload)
+	if err != nil {
+		return "", nil, err
+	}
+	return pasetoSign(maker.privateKey, message, nil, nil), payload, nil
+}
+
+func (maker *pasetoPublicMaker) VerifyToken(token string) (*JWTPayload, error) {
+	message, footer, err := pasetoVerify(maker.publicKey, token, nil)
+	// Tokens with a footer are never issued
+	if err != nil || len(footer) != 0 {
+		return nil, ErrInvalidToken
+	}
+	return pasetoPayload(message, maker.policy)
+}
+
+// pasetoSign implements v4.public signing of the message, covering the footer and the implicit assertion along it
+func pasetoSign(privateKey ed25519.PrivateKey, message []byte, footer []byte, implicitAssertion []byte) string {
+	signature := ed25519.Sign(privateKey, preAuthEncode([]byte(pasetoPublicHeader), message, footer, implicitAssertion))
+	body := append(append([]byte{}, message...), signature...)
+	return pasetoToken(pasetoPublicHeader, body, footer)
+}
+
+// pasetoVerify returns the message and the footer of a v4.public token, once its signature is verified along the implicit assertion
+func pasetoVerify(publicKey ed25519.PublicKey, token string, implicitAssertion []byte) ([]byte, []byte, error) {
+	body, footer, err := pasetoBody(token, pasetoPublicHeader)
+	if err != nil || len(body) < ed25519.SignatureSize {
+		return nil, nil, ErrInvalidToken
+	}
+	message := body[:len(body)-ed25519.SignatureSize]
+	signature := body[len(body)-ed25519.SignatureSize:]
+
+	if !ed25519.Verify(publicKey, preAuthEncode([]byte(pasetoPublicHeader), message, footer, implicitAssertion), signature) {
+		return nil, nil, ErrInvalidToken
+	}
+	return message, footer, nil
+}
+
+// pasetoToken encodes the body, and the footer when there is one, after the header
+func pasetoToken(header string, body []byte, footer []byte) string {
+	token := header + base64.RawURLEncoding.EncodeToString(body)
+	if len(footer) != 0 {
+		token += "." + base64.RawURLEncoding.EncodeToString(footer)
+	}
+	return token
+}
+
+// pasetoBody decodes the body and the optional footer of a token of the expected version and purpose.
+// Decoding is strict, a token must have a single encoding or its trailing bits could be altered unnoticed
+func pasetoBody(token string, header string) ([]byte, []byte, error) {
+	if !strings.HasPrefix(token, header) {
+		return nil, nil, ErrInvalidToken
+	}
+	parts := strings.Split(strings.TrimPrefix(token, header), ".")
+	if len(parts) > 2 {
+		return nil, nil, ErrInvalidToken
+	}
+	body, err := base64.RawURLEncoding.Strict().DecodeString(parts[0])
+	if err != nil {
+		return nil, nil, ErrInvalidToken
+	}
+	var footer []byte
+	if len(parts) == 2 {
+		if footer, err = base64.RawURLEncoding.Strict().DecodeString(parts[1]); err != nil {
+			return nil, nil, ErrInvalidToken
+		}
+	}
+	return body, footer, nil
+}
+
+// pasetoPayload decodes the claims of an authenticated token and checks them against the policy
+func pasetoPayload(message []byte, policy ClaimsPolicy) (*JWTPayload, error) {
+	payload, err := unmarshalPasetoClaims(message)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if err := policy.validate(payload); err != nil {
+		return expiredPayload(payload, err)
+	}
+	return payload, nil
+}
+
+// preAuthEncode is the PAE function of the PASETO spec, encoding the pieces so their boundaries cannot be forged
+func preAuthEncode(pieces ...[]byte) []byte {
+	encoded := make([]byte, 8, 8+len(pieces)*8)
+	binary.LittleEndian.PutUint64(encoded, uint64(len(pieces)))
+	for _, piece := range pieces {
+		length := make([]byte, 8)
+		binary.LittleEndian.PutUint64(length, uint64(len(piece)))
+		encoded = append(append(encoded, length...), piece...)
+	}
+	return encoded
+}
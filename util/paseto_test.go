@@ -0,0 +1,197 @@
+package util
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pasetoVector is a test of testdata/paseto_v4.json, the official vectors of
+// https://github.com/paseto-standard/test-vectors
+type pasetoVector struct {
+	Name              string  `json:"name"`
+	ExpectFail        bool    `json:"expect-fail"`
+	Key               string  `json:"key"`
+	Nonce             string  `json:"nonce"`
+	PublicKey         string  `json:"public-key"`
+	SecretKey         string  `json:"secret-key"`
+	Token             string  `json:"token"`
+	Payload           *string `json:"payload"`
+	Footer            string  `json:"footer"`
+	ImplicitAssertion string  `json:"implicit-assertion"`
+}
+
+func loadPasetoVectors(t *testing.T) []pasetoVector {
+	t.Helper()
+	data, err := os.ReadFile("testdata/paseto_v4.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors struct {
+		Tests []pasetoVector `json:"tests"`
+	}
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatal(err)
+	}
+	return vectors.Tests
+}
+
+func mustDecodeHex(t *testing.T, value string) []byte {
+	t.Helper()
+	decoded, err := hex.DecodeString(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func TestPasetoV4Vectors(t *testing.T) {
+	for _, vector := range loadPasetoVectors(t) {
+		t.Run(vector.Name, func(t *testing.T) {
+			footer, implicitAssertion := []byte(vector.Footer), []byte(vector.ImplicitAssertion)
+
+			var message, tokenFooter []byte
+			var err error
+			if vector.Key != "" {
+				key := mustDecodeHex(t, vector.Key)
+				message, tokenFooter, err = pasetoDecrypt(key, vector.Token, implicitAssertion)
+				if !vector.ExpectFail {
+					token, err := pasetoEncrypt(key, []byte(*vector.Payload), mustDecodeHex(t, vector.Nonce), footer, implicitAssertion)
+					if err != nil || token != vector.Token {
+						t.Errorf("encrypted to %s (%v), want %s", token, err, vector.Token)
+					}
+				}
+			} else {
+				message, tokenFooter, err = pasetoVerify(ed25519.PublicKey(mustDecodeHex(t, vector.PublicKey)), vector.Token, implicitAssertion)
+				if !vector.ExpectFail {
+					token := pasetoSign(ed25519.PrivateKey(mustDecodeHex(t, vector.SecretKey)), []byte(*vector.Payload), footer, implicitAssertion)
+					if token != vector.Token {
+						t.Errorf("signed as %s, want %s", token, vector.Token)
+					}
+				}
+			}
+
+			if vector.ExpectFail {
+				if err == nil {
+					t.Errorf("token accepted, want it rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("token rejected: %v", err)
+			}
+			if string(message) != *vector.Payload || !bytes.Equal(tokenFooter, footer) {
+				t.Errorf("got payload %s and footer %q, want %s and %q", message, tokenFooter, *vector.Payload, vector.Footer)
+			}
+		})
+	}
+}
+
+func testPasetoPolicy() ClaimsPolicy {
+	return ClaimsPolicy{Issuer: "https://api.example.com", Audience: "golang-api", AllowedAudiences: []string{"golang-api"}, TokenUse: TokenUseAccess}
+}
+
+func TestPasetoClaimsAreRFC3339(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	maker := NewPasetoPublicMaker(privateKey, testPasetoPolicy())
+
+	token, payload, err := maker.CreateToken(TokenSubject{UserID: 7, Email: "alice@example.com", SessionID: "session"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, pasetoPublicHeader))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(body[:len(body)-ed25519.SignatureSize], &claims); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]time.Time{"iat": payload.IssuedAt, "nbf": payload.NotBefore, "exp": payload.ExpiredAt} {
+		value, ok := claims[name].(string)
+		if !ok {
+			t.Errorf("%s = %v, want an RFC 3339 string", name, claims[name])
+			continue
+		}
+		if parsed, err := time.Parse(time.RFC3339, value); err != nil || !parsed.Equal(want) {
+			t.Errorf("%s = %s, want %s", name, value, want.UTC().Format(time.RFC3339))
+		}
+	}
+	if claims["aud"] != "golang-api" {
+		t.Errorf("aud = %v, want the string golang-api", claims["aud"])
+	}
+
+	verified, err := maker.VerifyToken(token)
+	if err != nil {
+		t.Fatalf("VerifyToken: %v", err)
+	}
+	if !verified.ExpiredAt.Equal(payload.ExpiredAt) || verified.UserID != 7 || verified.SessionID != "session" {
+		t.Errorf("verified %+v, want %+v", verified, payload)
+	}
+}
+
+func TestPasetoAcceptsNumericDates(t *testing.T) {
+	key := bytes.Repeat([]byte{0x2a}, 32)
+	policy := testPasetoPolicy()
+	maker, err := NewPasetoLocalMaker(key, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Claims as the first PASETO tokens encoded them, with the numeric dates and the aud list of JWTs
+	payload, err := policy.newPayload(TokenSubject{UserID: 7, Email: "alice@example.com"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := pasetoEncrypt(key, message, bytes.Repeat([]byte{1}, pasetoNonceSize), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verified, err := maker.VerifyToken(token)
+	if err != nil {
+		t.Fatalf("VerifyToken: %v", err)
+	}
+	if !verified.ExpiredAt.Equal(payload.ExpiredAt) || verified.Audience[0] != "golang-api" {
+		t.Errorf("verified %+v, want %+v", verified, payload)
+	}
+}
+
+func TestPasetoRejectsFooter(t *testing.T) {
+	key := bytes.Repeat([]byte{0x2a}, 32)
+	policy := testPasetoPolicy()
+	maker, err := NewPasetoLocalMaker(key, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := policy.newPayload(TokenSubject{UserID: 7, Email: "alice@example.com"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := marshalPasetoClaims(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := pasetoEncrypt(key, message, bytes.Repeat([]byte{1}, pasetoNonceSize), []byte(`{"kid":"other"}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := maker.VerifyToken(token); err != ErrInvalidToken {
+		t.Errorf("token with a footer: err = %v, want ErrInvalidToken", err)
+	}
+}
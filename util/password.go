@@ -0,0 +1,95 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Password hashing algorithms, named by their PHC string identifier
+const (
+	PasswordHashArgon2id = "argon2id"
+	PasswordHashBcrypt   = "bcrypt"
+)
+
+// Different types of error returned when checking a password
+var (
+	ErrPasswordMismatch    = errors.New("password does not match")
+	ErrUnknownPasswordHash = errors.New("unknown password hash format")
+)
+
+// PasswordHasher hashes passwords into PHC strings, $id$params$salt$hash, for a single algorithm
+type PasswordHasher interface {
+	// Hash encodes the password with a random salt and the current parameters
+	Hash(password string) (string, error)
+	// Verify returns ErrPasswordMismatch when the password does not match the encoded hash
+	Verify(password string, encodedHash string) error
+	// Outdated reports whether the encoded hash was made with other parameters than the current ones
+	Outdated(encodedHash string) bool
+	// Prefix is the start shared by every hash made with the current parameters
+	Prefix() string
+}
+
+// PasswordHasherRegistry verifies hashes of every known algorithm and hashes new passwords with the preferred one
+type PasswordHasherRegistry struct {
+	preferred PasswordHasher
+	hashers   map[string]PasswordHasher
+}
+
+// NewPasswordHasherRegistry builds the hashers with the parameters of the configuration, preferring argon2id by default
+func NewPasswordHasherRegistry(config Config) (*PasswordHasherRegistry, error) {
+	bcryptHasher := NewBcryptHasher(config.BcryptCost)
+	argon2idHasher := NewArgon2idHasher(config.Argon2Memory, config.Argon2Iterations, config.Argon2Parallelism)
+
+	registry := &PasswordHasherRegistry{
+		hashers: map[string]PasswordHasher{
+			// bcrypt predates PHC strings, its versions are identified by 2a, 2b and 2y
+			"2a":                 bcryptHasher,
+			"2b":                 bcryptHasher,
+			"2y":                 bcryptHasher,
+			PasswordHashArgon2id: argon2idHasher,
+		},
+	}
+
+	switch config.PasswordHashAlgorithm {
+	case PasswordHashArgon2id, "":
+		registry.preferred = argon2idHasher
+	case PasswordHashBcrypt:
+		registry.preferred = bcryptHasher
+	default:
+		return nil, fmt.Errorf("unsupported password hash algorithm %s", config.PasswordHashAlgorithm)
+	}
+	return registry, nil
+}
+
+// Hash encodes the password with the preferred hasher
+func (registry *PasswordHasherRegistry) Hash(password string) (string, error) {
+	return registry.preferred.Hash(password)
+}
+
+// Verify checks the password against a hash of any known algorithm.
+// needsRehash is set when the password matches a hash the preferred hasher would not produce anymore
+func (registry *PasswordHasherRegistry) Verify(password string, encodedHash string) (needsRehash bool, err error) {
+	hasher, ok := registry.hashers[passwordHashID(encodedHash)]
+	if !ok {
+		return false, ErrUnknownPasswordHash
+	}
+
+	if err := hasher.Verify(password, encodedHash); err != nil {
+		return false, err
+	}
+	return hasher != registry.preferred || hasher.Outdated(encodedHash), nil
+}
+
+// CurrentPrefix is the start of every up to date hash, anything else is a legacy hash
+func (registry *PasswordHasherRegistry) CurrentPrefix() string {
+	return registry.preferred.Prefix()
+}
+
+func passwordHashID(encodedHash string) string {
+	parts := strings.SplitN(encodedHash, "$", 3)
+	if len(parts) < 3 || parts[0] != "" {
+		return ""
+	}
+	return parts[1]
+}
@@ -0,0 +1,27 @@
+package util
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP returns the address of the client. X-Forwarded-For is only honoured
+// when trustProxyHeaders is set, as any client can send it. Only its right-most entry,
+// appended by the trusted proxy, is used, the ones before it come from the client
+func ClientIP(r *http.Request, trustProxyHeaders bool) string {
+	if trustProxyHeaders {
+		if forwardedFor := r.Header.Values("X-Forwarded-For"); len(forwardedFor) > 0 {
+			entries := strings.Split(forwardedFor[len(forwardedFor)-1], ",")
+			if clientIP := strings.TrimSpace(entries[len(entries)-1]); clientIP != "" {
+				return clientIP
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,112 @@
+package util
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Token formats selectable with TOKEN_FORMAT
+const (
+	TokenFormatJWT          = "jwt"
+	TokenFormatPasetoLocal  = "paseto.v4.local"
+	TokenFormatPasetoPublic = "paseto.v4.public"
+)
+
+// TokenMaker creates and verifies the access or the refresh tokens, whatever their format.
+// VerifyToken returns ErrExpiredToken along the payload of expired tokens, which tells the session they belonged to,
+// and ErrInvalidToken for anything else it rejects
+type TokenMaker interface {
+	CreateToken(subject TokenSubject, duration time.Duration) (string, *JWTPayload, error)
+	VerifyToken(token string) (*JWTPayload, error)
+}
+
+// expiredPayload keeps the verified payload of an expired token and drops it on any other error
+func expiredPayload(payload *JWTPayload, err error) (*JWTPayload, error) {
+	if err == ErrExpiredToken {
+		return payload, err
+	}
+	return nil, err
+}
+
+// NewTokenMaker returns the TokenMaker of the configured TOKEN_FORMAT. JWTs are signed with the keys of the provider,
+// v4.local tokens use the hex encoded PASETO_LOCAL_KEY and v4.public tokens the Ed25519 key of PASETO_PRIVATE_KEY_FILE.
+// ID tokens are JWTs in every format. The registered claims follow the ClaimsPolicy of the config
+func NewTokenMaker(config Config, keys KeyProvider) (TokenMaker, error) {
+	policy := NewClaimsPolicy(config, TokenUseAccess)
+	switch config.TokenFormat {
+	case "", TokenFormatJWT:
+		return NewJWTMaker(keys, policy), nil
+	case TokenFormatPasetoLocal:
+		key, err := hex.DecodeString(config.PasetoLocalKey)
+		if err != nil {
+			return nil, fmt.Errorf("PASETO_LOCAL_KEY must be hex encoded: %w", err)
+		}
+		return NewPasetoLocalMaker(key, policy)
+	case TokenFormatPasetoPublic:
+		keyPEM, err := os.ReadFile(config.PasetoPrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read PASETO private key: %w", err)
+		}
+		privateKey, err := parsePrivateKeyPEM(keyPEM)
+		if err != nil {
+			return nil, err
+		}
+		ed25519Key, ok := privateKey.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("v4.public requires an Ed25519 key, got %T", privateKey)
+		}
+		return NewPasetoPublicMaker(ed25519Key, policy), nil
+	default:
+		return nil, fmt.Errorf("unsupported TOKEN_FORMAT %s", config.TokenFormat)
+	}
+}
+
+// refreshTokenMaker issues refresh tokens as v4.local tokens under their own key, so they are opaque to clients
+// and no access token key can forge them. Untyped tokens issued before were made by the access token maker
+type refreshTokenMaker struct {
+	encrypted    TokenMaker
+	accessTokens TokenMaker
+	acceptLegacy bool
+}
+
+// NewRefreshTokenMaker returns the TokenMaker of refresh tokens, encrypted with the hex encoded REFRESH_TOKEN_KEY.
+// While ACCEPT_LEGACY_TOKENS is set, it also accepts untyped tokens of accessTokens
+func NewRefreshTokenMaker(config Config, accessTokens TokenMaker) (TokenMaker, error) {
+	if config.RefreshTokenKey == "" {
+		return nil, errors.New("REFRESH_TOKEN_KEY is not set, generate one with: openssl rand -hex 32")
+	}
+	key, err := hex.DecodeString(config.RefreshTokenKey)
+	if err != nil {
+		return nil, fmt.Errorf("REFRESH_TOKEN_KEY must be hex encoded: %w", err)
+	}
+	encrypted, err := NewPasetoLocalMaker(key, NewClaimsPolicy(config, TokenUseRefresh))
+	if err != nil {
+		return nil, fmt.Errorf("REFRESH_TOKEN_KEY: %w", err)
+	}
+	return &refreshTokenMaker{encrypted, accessTokens, config.AcceptLegacyTokens}, nil
+}
+
+func (maker *refreshTokenMaker) CreateToken(subject TokenSubject, duration time.Duration) (string, *JWTPayload, error) {
+	return maker.encrypted.CreateToken(subject, duration)
+}
+
+func (maker *refreshTokenMaker) VerifyToken(token string) (*JWTPayload, error) {
+	payload, err := maker.encrypted.VerifyToken(token)
+	if err != ErrInvalidToken || !maker.acceptLegacy {
+		return payload, err
+	}
+
+	// Typed access tokens are never refresh tokens, untyped ones still need a stored refresh token state
+	payload, err = maker.accessTokens.VerifyToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if !payload.Untyped() {
+		return nil, ErrInvalidToken
+	}
+	return payload, nil
+}